@@ -0,0 +1,149 @@
+package sshkeys
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Authentication methods of RFC 4252, RFC 4256 and RFC 4462.
+const (
+	AuthMethodNone                = "none"
+	AuthMethodPublicKey           = "publickey"
+	AuthMethodPassword            = "password"
+	AuthMethodKeyboardInteractive = "keyboard-interactive"
+	AuthMethodGSSAPIWithMIC       = "gssapi-with-mic"
+)
+
+// AuthMethods are the authentication methods a server allows for a user before any credentials were sent.
+type AuthMethods struct {
+	User string `json:"user"`
+	// Methods are the allowed methods, sorted by name.
+	// Only publickey, password, keyboard-interactive and gssapi-with-mic can be detected.
+	Methods []string `json:"methods"`
+	// Banner is the text of SSH_MSG_USERAUTH_BANNER.
+	Banner string `json:"banner,omitempty"`
+	// NoneAccepted is set if the server accepted the none authentication, i.e. no credentials are needed.
+	NoneAccepted bool `json:"none_accepted,omitempty"`
+}
+
+// AcceptsPasswords reports whether the server allows password or keyboard-interactive authentication,
+// or no authentication at all.
+func (a *AuthMethods) AcceptsPasswords() bool {
+	return a.NoneAccepted || a.Allows(AuthMethodPassword) || a.Allows(AuthMethodKeyboardInteractive)
+}
+
+// Allows reports whether method is allowed.
+func (a *AuthMethods) Allows(method string) bool {
+	return containsString(a.Methods, method)
+}
+
+// errAuthProbe stops an authentication method once it is known that the server allows it.
+var errAuthProbe = errors.New("auth method probe")
+
+// GetAuthMethods completes the key exchange with host and attempts the none authentication as user
+// to learn the allowed authentication methods and the banner. No credentials are sent.
+// publickey and password are detected without sending a request, keyboard-interactive and gssapi-with-mic
+// are started in their own connection and aborted before any credentials are requested.
+// A method is only reported if the server starts it, keyboard-interactive once the server sends a challenge
+// and gssapi-with-mic once the server accepts the Kerberos V5 mechanism.
+func GetAuthMethods(ctx context.Context, host, user string) (*AuthMethods, error) {
+	result := AuthMethods{User: user, Methods: []string{}}
+	record := func(method string) {
+		if !containsString(result.Methods, method) {
+			result.Methods = append(result.Methods, method)
+		}
+	}
+
+	// the callbacks are only called if the server allows the method
+	accepted, err := authenticate(ctx, host, user, &result.Banner,
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			record(AuthMethodPublicKey)
+			return nil, nil
+		}),
+		ssh.PasswordCallback(func() (string, error) {
+			record(AuthMethodPassword)
+			return "", errAuthProbe
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if accepted {
+		result.NoneAccepted = true
+		return &result, nil
+	}
+
+	for _, auth := range []ssh.AuthMethod{
+		ssh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+			record(AuthMethodKeyboardInteractive)
+			return nil, errAuthProbe
+		}),
+		ssh.GSSAPIWithMICAuthMethod(probeGSSAPIClient{record: record}, host),
+	} {
+		var banner string
+		if _, err := authenticate(ctx, host, user, &banner, auth); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(result.Methods)
+	return &result, nil
+}
+
+// authenticate attempts the authentication with methods, it reports whether the authentication succeeded.
+// Authentication failures are not returned as error.
+func authenticate(ctx context.Context, host, user string, banner *string, methods ...ssh.AuthMethod) (bool, error) {
+	conn, stop, err := dialContext(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	defer stop()
+	// the host key callback is called once the key exchange is verified, i.e. right before the authentication
+	kexDone := false
+	config := ssh.ClientConfig{
+		User: user,
+		Auth: methods,
+		BannerCallback: func(message string) error {
+			*banner = message
+			return nil
+		},
+		// the authentication methods are scanned, the host is not trusted
+		HostKeyCallback: func(string, net.Addr, ssh.PublicKey) error {
+			kexDone = true
+			return nil
+		},
+	}
+	sshConn, _, _, err := ssh.NewClientConn(conn, host, &config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if kexDone {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, sshConn.Close()
+}
+
+// probeGSSAPIClient records that the server accepted the gssapi-with-mic mechanism and aborts the authentication
+// before a security context is created.
+type probeGSSAPIClient struct {
+	record func(method string)
+}
+
+func (c probeGSSAPIClient) InitSecContext(string, []byte, bool) ([]byte, bool, error) {
+	c.record(AuthMethodGSSAPIWithMIC)
+	return nil, false, errAuthProbe
+}
+
+func (probeGSSAPIClient) GetMIC([]byte) ([]byte, error) {
+	return nil, errAuthProbe
+}
+
+func (probeGSSAPIClient) DeleteSecContext() error {
+	return nil
+}
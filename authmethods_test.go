@@ -0,0 +1,166 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveAuth accepts connections on l and authenticates them with config.
+func serveAuth(l net.Listener, config *ssh.ServerConfig) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+			if err != nil {
+				return
+			}
+			defer sshConn.Close()
+			go ssh.DiscardRequests(reqs)
+			for ch := range chans {
+				_ = ch.Reject(ssh.Prohibited, "")
+			}
+		}()
+	}
+}
+
+// denyGSSAPIServer accepts the Kerberos V5 mechanism and denies every security context.
+type denyGSSAPIServer struct{}
+
+func (denyGSSAPIServer) AcceptSecContext([]byte) ([]byte, string, bool, error) {
+	return nil, "", false, errors.New("denied")
+}
+
+func (denyGSSAPIServer) VerifyMIC([]byte, []byte) error {
+	return errors.New("denied")
+}
+
+func (denyGSSAPIServer) DeleteSecContext() error {
+	return nil
+}
+
+func TestGetAuthMethods(t *testing.T) {
+	t.Parallel()
+	hostKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		config   ssh.ServerConfig
+		methods  []string
+		password bool
+	}{
+		{
+			name: "publickey",
+			config: ssh.ServerConfig{
+				PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+					return nil, errors.New("denied")
+				},
+				BannerCallback: func(conn ssh.ConnMetadata) string {
+					return "Authorized access only, " + conn.User() + "\n"
+				},
+			},
+			methods: []string{sshkeys.AuthMethodPublicKey},
+		},
+		{
+			name: "password",
+			config: ssh.ServerConfig{
+				PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+					return nil, errors.New("denied")
+				},
+				PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+					return nil, errors.New("denied")
+				},
+			},
+			methods:  []string{sshkeys.AuthMethodPassword, sshkeys.AuthMethodPublicKey},
+			password: true,
+		},
+		{
+			name: "keyboard-interactive",
+			config: ssh.ServerConfig{
+				KeyboardInteractiveCallback: func(_ ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+					if _, err := challenge("", "", []string{"Password: "}, []bool{false}); err != nil {
+						return nil, err
+					}
+					return nil, errors.New("denied")
+				},
+			},
+			methods:  []string{sshkeys.AuthMethodKeyboardInteractive},
+			password: true,
+		},
+		{
+			name: "gssapi-with-mic",
+			config: ssh.ServerConfig{
+				PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+					return nil, errors.New("denied")
+				},
+				GSSAPIWithMICConfig: &ssh.GSSAPIWithMICConfig{
+					AllowLogin: func(ssh.ConnMetadata, string) (*ssh.Permissions, error) {
+						return nil, errors.New("denied")
+					},
+					Server: denyGSSAPIServer{},
+				},
+			},
+			methods: []string{sshkeys.AuthMethodGSSAPIWithMIC, sshkeys.AuthMethodPublicKey},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			test.config.AddHostKey(hostKey)
+			go serveAuth(l, &test.config)
+
+			methods, err := sshkeys.GetAuthMethods(context.Background(), l.Addr().String(), "auditor")
+			require.NoError(t, err)
+			require.Equal(t, "auditor", methods.User)
+			require.Equal(t, test.methods, methods.Methods)
+			require.False(t, methods.NoneAccepted)
+			require.Equal(t, test.password, methods.AcceptsPasswords())
+			if test.config.BannerCallback != nil {
+				require.Equal(t, "Authorized access only, auditor\n", methods.Banner)
+			}
+		})
+	}
+}
+
+func TestGetAuthMethodsNoneAccepted(t *testing.T) {
+	t.Parallel()
+	hostKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	config := ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+	go serveAuth(l, &config)
+
+	methods, err := sshkeys.GetAuthMethods(context.Background(), l.Addr().String(), "root")
+	require.NoError(t, err)
+	require.True(t, methods.NoneAccepted)
+	require.True(t, methods.AcceptsPasswords())
+}
+
+func TestGetAuthMethodsUnreachable(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	_, err = sshkeys.GetAuthMethods(context.Background(), addr, "root")
+	require.Error(t, err)
+}
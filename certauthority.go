@@ -0,0 +1,209 @@
+package sshkeys
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertAuthorityGroup are the hosts whose host certificates are signed by the same CA.
+type CertAuthorityGroup struct {
+	CAType              string `json:"ca_type"`
+	CAFingerprintSHA256 string `json:"ca_fingerprint_sha256"`
+	// CAKey is the CA public key in authorized_keys format.
+	CAKey string `json:"ca_key"`
+	// Hosts are the scanned hosts that presented a certificate of the CA.
+	Hosts []string `json:"hosts"`
+	// Principals are the principals of all certificates of the CA.
+	Principals []string `json:"principals"`
+	// Patterns are the known_hosts host patterns that were inferred from the hosts and the principals,
+	// see InferHostPatterns.
+	Patterns []string `json:"patterns"`
+	// KnownHostsLine is the @cert-authority known_hosts line that trusts the CA for Patterns.
+	KnownHostsLine string `json:"known_hosts_line"`
+}
+
+// GroupCertAuthorities groups the host certificates of results by the CA that signed them.
+// The groups are sorted by the number of hosts, the CA that signed the certificates of most hosts comes first.
+// Results without host certificates are ignored, nil is returned if no result has a host certificate.
+func GroupCertAuthorities(results ...HostResult) []CertAuthorityGroup {
+	type group struct {
+		CertAuthorityGroup
+		// names are the hosts and the principals, together with the port of the host that presented the certificate.
+		names []HostPort
+	}
+	groups := make(map[string]*group)
+	for i := range results {
+		host, port := certAuthorityHost(&results[i])
+		for j := range results[i].Keys {
+			if results[i].Keys[j].Certificate == nil || results[i].Keys[j].Certificate.CertType != "host" {
+				continue
+			}
+			key, err := results[i].Keys[j].PublicKey()
+			if err != nil {
+				continue
+			}
+			cert, ok := key.(*ssh.Certificate)
+			if !ok {
+				continue
+			}
+			fingerprint := ssh.FingerprintSHA256(cert.SignatureKey)
+			g, ok := groups[fingerprint]
+			if !ok {
+				caKey, err := AuthorizedKey(cert.SignatureKey)
+				if err != nil {
+					continue
+				}
+				g = &group{
+					CertAuthorityGroup: CertAuthorityGroup{
+						CAType:              cert.SignatureKey.Type(),
+						CAFingerprintSHA256: fingerprint,
+						CAKey:               caKey,
+					},
+				}
+				groups[fingerprint] = g
+			}
+			if !containsString(g.Hosts, results[i].Host) {
+				g.Hosts = append(g.Hosts, results[i].Host)
+			}
+			for _, principal := range cert.ValidPrincipals {
+				if !containsString(g.Principals, principal) {
+					g.Principals = append(g.Principals, principal)
+				}
+				g.names = append(g.names, HostPort{Name: principal, Port: port})
+			}
+			if host != "" {
+				g.names = append(g.names, HostPort{Name: host, Port: port})
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	result := make([]CertAuthorityGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.Hosts)
+		sort.Strings(g.Principals)
+		if g.Principals == nil {
+			g.Principals = []string{}
+		}
+		g.Patterns = InferHostPatterns(g.names)
+		g.KnownHostsLine = CertAuthorityMarker + " " + strings.Join(g.Patterns, ",") + " " + g.CAKey
+		result = append(result, g.CertAuthorityGroup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Hosts) != len(result[j].Hosts) {
+			return len(result[i].Hosts) > len(result[j].Hosts)
+		}
+		return result[i].CAFingerprintSHA256 < result[j].CAFingerprintSHA256
+	})
+	return result
+}
+
+// certAuthorityHost returns the name and the port the result was scanned with.
+// The name is empty if the host was specified as ip, ips are only trusted if they are a principal.
+func certAuthorityHost(result *HostResult) (host, port string) {
+	if result.Target != nil {
+		host, port = result.Target.Host, result.Target.Port
+	} else {
+		var err error
+		if host, port, err = net.SplitHostPort(result.Address); err != nil {
+			return "", DefaultPort
+		}
+	}
+	if result.HostKeyAlias != "" {
+		host = result.HostKeyAlias
+	}
+	if net.ParseIP(host) != nil {
+		host = ""
+	}
+	return host, port
+}
+
+// HostPort is a host name, or ip, together with the port it was scanned on.
+type HostPort struct {
+	Name string
+	Port string
+}
+
+// InferHostPatterns returns the known_hosts patterns for hosts.
+// Names with at least three labels are replaced by a wildcard for their parent domain if at least two names share
+// the parent, e.g. web01.example.com and web02.example.com become *.example.com.
+// Other names, ips and names that already contain wildcards are kept as they are.
+// Every pattern keeps the port of its hosts, ports other than 22 use the [pattern]:port form.
+// If a host has no port, 22 is used.
+func InferHostPatterns(hosts []HostPort) []string {
+	normalized := make([]HostPort, 0, len(hosts))
+	// parents contains the distinct names of every parent domain
+	parents := make(map[string]map[string]bool)
+	for i := range hosts {
+		host := HostPort{
+			Name: strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hosts[i].Name), ".")),
+			Port: hosts[i].Port,
+		}
+		if host.Name == "" {
+			continue
+		}
+		if host.Port == "" {
+			host.Port = DefaultPort
+		}
+		normalized = append(normalized, host)
+		if parent := wildcardParent(host.Name); parent != "" {
+			if parents[parent] == nil {
+				parents[parent] = make(map[string]bool)
+			}
+			parents[parent][host.Name] = true
+		}
+	}
+
+	var bases []HostPort
+	for _, base := range normalized {
+		if parent := wildcardParent(base.Name); len(parents[parent]) >= 2 { //nolint: gomnd // a wildcard needs two hosts
+			base.Name = "*." + parent
+		}
+		if !containsHostPort(bases, base) {
+			bases = append(bases, base)
+		}
+	}
+	sort.Slice(bases, func(i, j int) bool {
+		if bases[i].Name != bases[j].Name {
+			return bases[i].Name < bases[j].Name
+		}
+		return bases[i].Port < bases[j].Port
+	})
+
+	patterns := make([]string, 0, len(bases))
+	for _, base := range bases {
+		if base.Port == DefaultPort {
+			patterns = append(patterns, base.Name)
+			continue
+		}
+		patterns = append(patterns, "["+base.Name+"]:"+base.Port)
+	}
+	return patterns
+}
+
+// wildcardParent returns the parent domain of name if name can be replaced by a wildcard for it,
+// that are names with at least three labels that are no ip and contain no wildcards.
+func wildcardParent(name string) string {
+	if net.ParseIP(name) != nil || strings.ContainsAny(name, "*?") {
+		return ""
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 3 { //nolint: gomnd // host and a domain of two labels
+		return ""
+	}
+	return strings.Join(labels[1:], ".")
+}
+
+func containsHostPort(hosts []HostPort, host HostPort) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
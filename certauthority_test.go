@@ -0,0 +1,111 @@
+package sshkeys_test
+
+import (
+	"crypto/elliptic"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestInferHostPatterns(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		hosts    []sshkeys.HostPort
+		patterns []string
+	}{
+		{
+			[]sshkeys.HostPort{{Name: "web01.example.com"}, {Name: "web02.example.com"}},
+			[]string{"*.example.com"},
+		},
+		{
+			[]sshkeys.HostPort{{Name: "web01.example.com"}, {Name: "db01.example.org"}, {Name: "localhost"}},
+			[]string{"db01.example.org", "localhost", "web01.example.com"},
+		},
+		{
+			[]sshkeys.HostPort{{Name: "web01.eu.example.com"}, {Name: "WEB02.eu.example.com."}, {Name: "web01.eu.example.com", Port: "22"}},
+			[]string{"*.eu.example.com"},
+		},
+		{
+			[]sshkeys.HostPort{{Name: "example.com"}, {Name: "10.0.0.1"}, {Name: "*.example.net"}},
+			[]string{"*.example.net", "10.0.0.1", "example.com"},
+		},
+		{
+			[]sshkeys.HostPort{{Name: "web01.example.com", Port: "22"}, {Name: "web02.example.com", Port: "2222"}},
+			[]string{"*.example.com", "[*.example.com]:2222"},
+		},
+		{
+			[]sshkeys.HostPort{{Name: "web01.example.com", Port: "2222"}, {Name: "10.0.0.1", Port: "22"}},
+			[]string{"10.0.0.1", "[web01.example.com]:2222"},
+		},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.patterns, sshkeys.InferHostPatterns(test.hosts), test.hosts)
+	}
+}
+
+func newTestCertResult(t *testing.T, host string, cert *xssh.Certificate) sshkeys.HostResult {
+	t.Helper()
+	target, err := sshkeys.ParseTarget(host)
+	require.NoError(t, err)
+	key, err := sshkeys.NewKeyResult(cert)
+	require.NoError(t, err)
+	key.Algorithms = []string{cert.Type()}
+	return sshkeys.HostResult{Host: host, Address: target.Address(), Target: &target, Keys: []sshkeys.KeyResult{key}}
+}
+
+func TestGroupCertAuthorities(t *testing.T) {
+	t.Parallel()
+	ca, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	otherCA, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	inAYear := time.Now().Add(365 * 24 * time.Hour)
+
+	plainKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	plainResult, err := sshkeys.NewKeyResult(plainKey.PublicKey())
+	require.NoError(t, err)
+
+	results := []sshkeys.HostResult{
+		newTestCertResult(t, "web01.example.com", newTestHostCert(t, ca, xssh.HostCert, []string{"web01.example.com"}, inAYear)),
+		newTestCertResult(t, "web02.example.com", newTestHostCert(t, ca, xssh.HostCert, []string{"web02.example.com", "10.0.0.2"}, inAYear)),
+		newTestCertResult(t, "db01.example.org:2222", newTestHostCert(t, otherCA, xssh.HostCert, []string{"db01.example.org"}, inAYear)),
+		newTestCertResult(t, "user.example.com", newTestHostCert(t, otherCA, xssh.UserCert, []string{"user.example.com"}, inAYear)),
+		{Host: "plain.example.com", Address: "plain.example.com:22", Keys: []sshkeys.KeyResult{plainResult}},
+	}
+	groups := sshkeys.GroupCertAuthorities(results...)
+	require.Len(t, groups, 2)
+
+	caKey := strings.TrimSpace(string(xssh.MarshalAuthorizedKey(ca.PublicKey())))
+	require.Equal(t, xssh.FingerprintSHA256(ca.PublicKey()), groups[0].CAFingerprintSHA256)
+	require.Equal(t, caKey, groups[0].CAKey)
+	require.Equal(t, []string{"web01.example.com", "web02.example.com"}, groups[0].Hosts)
+	require.Equal(t, []string{"10.0.0.2", "web01.example.com", "web02.example.com"}, groups[0].Principals)
+	require.Equal(t, []string{"*.example.com", "10.0.0.2"}, groups[0].Patterns)
+	require.Equal(t, "@cert-authority *.example.com,10.0.0.2 "+caKey, groups[0].KnownHostsLine)
+
+	require.Equal(t, xssh.FingerprintSHA256(otherCA.PublicKey()), groups[1].CAFingerprintSHA256)
+	require.Equal(t, []string{"db01.example.org:2222"}, groups[1].Hosts)
+	require.Equal(t, []string{"[db01.example.org]:2222"}, groups[1].Patterns)
+
+	require.Nil(t, sshkeys.GroupCertAuthorities(results[4]))
+
+	// the generated lines trust the CAs for the scanned hosts
+	var knownHosts string
+	for _, group := range groups {
+		knownHosts += group.KnownHostsLine + "\n"
+	}
+	authorities, err := sshkeys.ParseCertAuthorities(strings.NewReader(knownHosts))
+	require.NoError(t, err)
+	verifier := sshkeys.HostCertVerifier{Authorities: authorities}
+	for i := 0; i < 3; i++ {
+		key, err := results[i].Keys[0].PublicKey()
+		require.NoError(t, err)
+		verification := verifier.Verify(results[i].Target.Host+":"+results[i].Target.Port, key.(*xssh.Certificate))
+		require.True(t, verification.Valid, verification.Error)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// defaultUser returns the name of the current user, like ssh does if no user was specified.
+func defaultUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// loadSigners returns the keys of the identity file and (if useAgent is set) of the ssh-agent.
+// The returned function closes the connection to the agent.
+func loadSigners(identityFile string, useAgent bool) ([]ssh.Signer, func(), error) {
+	var signers []ssh.Signer
+	closeFn := func() {}
+	if identityFile != "" {
+		buf, err := os.ReadFile(identityFile)
+		if err != nil {
+			return nil, closeFn, fmt.Errorf("unable to read identity file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(buf)
+		if err != nil {
+			var missingErr *ssh.PassphraseMissingError
+			if errors.As(err, &missingErr) {
+				return nil, closeFn, errors.New("identity file is encrypted, add it to the ssh-agent and use -agent")
+			}
+			return nil, closeFn, fmt.Errorf("unable to parse identity file: %w", err)
+		}
+		signers = append(signers, signer)
+	}
+	if useAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, closeFn, errors.New("SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, closeFn, fmt.Errorf("unable to connect to ssh-agent: %w", err)
+		}
+		closeFn = func() { _ = conn.Close() }
+		agentSigners, err := agent.NewClient(conn).Signers()
+		if err != nil {
+			closeFn()
+			return nil, func() {}, fmt.Errorf("unable to get keys from ssh-agent: %w", err)
+		}
+		signers = append(signers, agentSigners...)
+	}
+	if len(signers) == 0 {
+		closeFn()
+		return nil, func() {}, errors.New("no keys to authenticate with")
+	}
+	return signers, closeFn, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Eun/sshkeys"
+)
+
+const (
+	diffExitNoChanges = 0
+	diffExitChanges   = 1
+	diffExitTrouble   = 2
+)
+
+// savedScan is the json representation of a single host as written by -output=json of older versions.
+type savedScan struct {
+	Host      string
+	Algorithm string
+	Encoding  string
+	Banner    string
+	Keys      map[string]string
+	Error     string
+}
+
+func printDiffUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s diff [options] <old.json> <new.json>\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Compares two scans that were saved with -output=json or -output=ndjson.")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if the scans are equal, 1 if they differ and 2 on errors.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -o=console")
+	fmt.Fprintln(os.Stderr, "    -output=console")
+	fmt.Fprintln(os.Stderr, "       Output format, valid formats are: console, json")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -all")
+	fmt.Fprintln(os.Stderr, "       Also report hosts without changes")
+	fmt.Fprintln(os.Stderr)
+}
+
+func runDiff(args []string) int {
+	var outputOpt string
+	var allOpt bool
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.Usage = printDiffUsage
+	flags.StringVar(&outputOpt, "output", "", "")
+	flags.StringVar(&outputOpt, "o", "", "")
+	flags.BoolVar(&allOpt, "all", false, "")
+	if err := flags.Parse(args); err != nil {
+		return diffExitTrouble
+	}
+	if flags.NArg() != 2 { //nolint: gomnd // old and new file
+		printDiffUsage()
+		return diffExitTrouble
+	}
+
+	oldScans, oldFormat, err := readScanFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return diffExitTrouble
+	}
+	newScans, newFormat, err := readScanFile(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return diffExitTrouble
+	}
+	if oldFormat != "" && newFormat != "" && oldFormat != newFormat {
+		fmt.Fprintf(os.Stderr, "scans were saved with different algorithms or encodings (%s and %s)\n", oldFormat, newFormat)
+		return diffExitTrouble
+	}
+
+	diffs := sshkeys.DiffScans(oldScans, newScans)
+	exitCode := diffExitNoChanges
+	report := make([]sshkeys.HostDiff, 0, len(diffs))
+	for i := range diffs {
+		if diffs[i].HasChanges() {
+			exitCode = diffExitChanges
+		} else if !allOpt {
+			continue
+		}
+		report = append(report, diffs[i])
+	}
+
+	switch parseOutput(outputOpt) {
+	case outputJSON:
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %+v", err)
+			return diffExitTrouble
+		}
+	default:
+		for i := range report {
+			printHostDiff(os.Stdout, &report[i])
+		}
+	}
+	return exitCode
+}
+
+func printHostDiff(w io.Writer, d *sshkeys.HostDiff) {
+	switch {
+	case d.HostAdded:
+		fmt.Fprintf(w, "%s (new host)\n", d.Host)
+	case d.HostRemoved:
+		fmt.Fprintf(w, "%s (removed host)\n", d.Host)
+	default:
+		fmt.Fprintln(w, d.Host)
+	}
+	if !d.HasChanges() {
+		fmt.Fprintln(w, "  no changes")
+		return
+	}
+	if d.BannerChanged() {
+		fmt.Fprintf(w, "  banner: %q -> %q\n", d.OldBanner, d.NewBanner)
+	}
+	if d.OldError != d.NewError {
+		fmt.Fprintf(w, "  error: %q -> %q\n", d.OldError, d.NewError)
+	}
+	for _, c := range d.Added {
+		fmt.Fprintf(w, "  + %s %s\n", c.Algorithm, c.New)
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(w, "  - %s %s\n", c.Algorithm, c.Old)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(w, "  ~ %s %s -> %s\n", c.Algorithm, c.Old, c.New)
+	}
+}
+
+// readScanFile reads a file that contains reports (-output=json), host records (-output=ndjson),
+// scans of older versions or an array of them.
+// It also returns the algorithm and encoding the keys were printed with.
+func readScanFile(name string) (scans []sshkeys.HostScan, format string, err error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read %s: %w", name, err)
+	}
+
+	var values []json.RawMessage
+	buf = bytes.TrimSpace(buf)
+	if len(buf) > 0 && buf[0] == '[' {
+		err = json.Unmarshal(buf, &values)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		for {
+			var v json.RawMessage
+			if err = dec.Decode(&v); err != nil {
+				break
+			}
+			values = append(values, v)
+		}
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to decode %s: %w", name, err)
+	}
+
+	var saved []savedScan
+	for _, v := range values {
+		var versioned struct {
+			SchemaVersion *int            `json:"schema_version"`
+			Hosts         json.RawMessage `json:"hosts"`
+		}
+		if err := json.Unmarshal(v, &versioned); err != nil {
+			return nil, "", fmt.Errorf("unable to decode %s: %w", name, err)
+		}
+		if versioned.SchemaVersion == nil {
+			var s savedScan
+			if err := json.Unmarshal(v, &s); err != nil {
+				return nil, "", fmt.Errorf("unable to decode %s: %w", name, err)
+			}
+			saved = append(saved, s)
+			continue
+		}
+		if *versioned.SchemaVersion > sshkeys.SchemaVersion {
+			return nil, "", fmt.Errorf("%s: schema version %d is not supported, upgrade sshkeys", name, *versioned.SchemaVersion)
+		}
+		var report sshkeys.Report
+		if versioned.Hosts == nil {
+			// a single line of -output=ndjson
+			var record sshkeys.HostRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return nil, "", fmt.Errorf("unable to decode %s: %w", name, err)
+			}
+			report.Hosts = []sshkeys.HostResult{record.HostResult}
+		} else if err := json.Unmarshal(v, &report); err != nil {
+			return nil, "", fmt.Errorf("unable to decode %s: %w", name, err)
+		}
+		for i := range report.Hosts {
+			scan := report.Hosts[i].HostScan()
+			saved = append(saved, savedScan{
+				Host:      scan.Host,
+				Algorithm: "authorized_keys",
+				Banner:    scan.Banner,
+				Keys:      scan.Keys,
+				Error:     scan.Error,
+			})
+		}
+	}
+
+	scans = make([]sshkeys.HostScan, 0, len(saved))
+	for _, s := range saved {
+		if s.Error == "" && s.Keys == nil {
+			return nil, "", fmt.Errorf("%s: scan of %s does not contain the algorithm of each key, rescan with a newer version",
+				name, s.Host)
+		}
+		scans = append(scans, sshkeys.HostScan{
+			Host:   s.Host,
+			Banner: s.Banner,
+			Keys:   s.Keys,
+			Error:  s.Error,
+		})
+	}
+	format, err = scanFormat(name, saved)
+	if err != nil {
+		return nil, "", err
+	}
+	return scans, format, nil
+}
+
+// scanFormat makes sure all hosts in a file were printed with the same algorithm and encoding.
+func scanFormat(name string, saved []savedScan) (string, error) {
+	var format string
+	for _, s := range saved {
+		if s.Error != "" {
+			continue
+		}
+		f := s.Algorithm + "/" + s.Encoding
+		if format == "" {
+			format = f
+			continue
+		}
+		if format != f {
+			return "", fmt.Errorf("%s: hosts were saved with different algorithms or encodings", name)
+		}
+	}
+	return format, nil
+}
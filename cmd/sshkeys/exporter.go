@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultModuleName = "default"
+
+// exporterModule configures how targets are probed, it is selected with the module parameter of /probe.
+type exporterModule struct {
+	Timeout    time.Duration `yaml:"timeout"`
+	Concurrent int           `yaml:"concurrent"`
+	Algorithms []string      `yaml:"algorithms"`
+	// ExpectedFingerprints contains the SHA256 fingerprints (SHA256:...) of the host keys that are expected.
+	ExpectedFingerprints []string `yaml:"expected_fingerprints"`
+}
+
+type exporterConfig struct {
+	Modules map[string]*exporterModule `yaml:"modules"`
+}
+
+func defaultExporterModule() *exporterModule {
+	return &exporterModule{
+		Timeout:    10 * time.Second, //nolint: gomnd // allow constant
+		Concurrent: 4,                //nolint: gomnd // allow constant
+		Algorithms: sshkeys.DefaultKeyAlgorithms(),
+	}
+}
+
+func loadExporterConfig(name string) (*exporterConfig, error) {
+	config := exporterConfig{
+		Modules: map[string]*exporterModule{},
+	}
+	if name != "" {
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config: %w", err)
+		}
+		if err := yaml.Unmarshal(buf, &config); err != nil {
+			return nil, fmt.Errorf("unable to decode config: %w", err)
+		}
+	}
+
+	defaults := defaultExporterModule()
+	for name, module := range config.Modules {
+		if module == nil {
+			config.Modules[name] = defaultExporterModule()
+			continue
+		}
+		if module.Timeout <= 0 {
+			module.Timeout = defaults.Timeout
+		}
+		if module.Concurrent <= 0 {
+			module.Concurrent = defaults.Concurrent
+		}
+		if len(module.Algorithms) == 0 {
+			module.Algorithms = defaults.Algorithms
+		}
+	}
+	if _, ok := config.Modules[defaultModuleName]; !ok {
+		config.Modules[defaultModuleName] = defaults
+	}
+	return &config, nil
+}
+
+type exporter struct {
+	config    *exporterConfig
+	startTime time.Time
+
+	mu     sync.Mutex
+	probes map[[2]string]uint64 // module, result -> count
+}
+
+func printExporterUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s exporter [options]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Runs a prometheus exporter that probes targets on /probe?target=host:22&module=default.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -l=:9312")
+	fmt.Fprintln(os.Stderr, "    -listen=:9312")
+	fmt.Fprintln(os.Stderr, "       Address to listen on")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -config=")
+	fmt.Fprintln(os.Stderr, "       YAML file with the probe modules")
+	fmt.Fprintln(os.Stderr)
+}
+
+func runExporter(args []string) int {
+	var listenOpt string
+	var configOpt string
+	flags := flag.NewFlagSet("exporter", flag.ContinueOnError)
+	flags.Usage = printExporterUsage
+	flags.StringVar(&listenOpt, "listen", ":9312", "")
+	flags.StringVar(&listenOpt, "l", ":9312", "")
+	flags.StringVar(&configOpt, "config", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	config, err := loadExporterConfig(configOpt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	e := &exporter{
+		config:    config,
+		startTime: time.Now(),
+		probes:    make(map[[2]string]uint64),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/probe", e.probeHandler)
+	mux.HandleFunc("/metrics", e.metricsHandler)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	return serveHTTP(ctx, listenOpt, mux)
+}
+
+// serveHTTP serves handler on addr until ctx is done.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) int {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second, //nolint: gomnd // allow constant
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second) //nolint: gomnd // allow constant
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func (e *exporter) countProbe(module string, success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	e.mu.Lock()
+	e.probes[[2]string{module, result}]++
+	e.mu.Unlock()
+}
+
+func (e *exporter) probeHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = defaultModuleName
+	}
+	module, ok := e.config.Modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	addr, err := dialAddress(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), module.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := sshkeys.Scan(ctx, addr, sshkeys.ScanOptions{
+		ConcurrentWorkers: module.Concurrent,
+		Timeout:           module.Timeout,
+		Algorithms:        module.Algorithms,
+	})
+	duration := time.Since(start)
+	var keys map[string]ssh.PublicKey
+	if err == nil {
+		keys, err = keysByAlgorithm(result.Keys)
+	}
+	success := err == nil && len(keys) > 0
+	e.countProbe(moduleName, success)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metricsWriter{w: w}
+	m.gauge("probe_success", "Whether the probe was successful.", boolToFloat(success))
+	m.gauge("probe_duration_seconds", "How long the probe took to complete in seconds.", duration.Seconds())
+	if err != nil {
+		return
+	}
+	m.gauge("probe_ssh_handshake_duration_seconds", "How long fetching all host keys took in seconds.",
+		(time.Duration(result.Timings.TotalMS-result.Timings.BannerMS) * time.Millisecond).Seconds())
+	m.gauge("probe_ssh_banner_info", "The ssh version banner of the target.", 1, "banner", result.Banner)
+	writeErrorMetrics(&m, result.Errors)
+	writeKeyMetrics(&m, keys, module.ExpectedFingerprints)
+}
+
+// keysByAlgorithm returns the keys of a scan result by the algorithms that returned them.
+func keysByAlgorithm(results []sshkeys.KeyResult) (map[string]ssh.PublicKey, error) {
+	keys := make(map[string]ssh.PublicKey)
+	for i := range results {
+		key, err := results[i].PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		for _, algo := range results[i].Algorithms {
+			keys[algo] = key
+		}
+	}
+	return keys, nil
+}
+
+// writeErrorMetrics writes a sample for every algorithm, or check like server-algorithms, that failed.
+func writeErrorMetrics(m *metricsWriter, errs map[string]string) {
+	if len(errs) == 0 {
+		return
+	}
+	m.header("probe_ssh_algorithm_failed", "gauge", "Whether fetching the host key with the algorithm failed.")
+	for _, algo := range errorAlgorithms(errs) {
+		m.sample("probe_ssh_algorithm_failed", 1, "algorithm", algo)
+	}
+}
+
+func writeKeyMetrics(m *metricsWriter, keys map[string]ssh.PublicKey, expectedFingerprints []string) {
+	algorithms := make([]string, 0, len(keys))
+	for algo := range keys {
+		algorithms = append(algorithms, algo)
+	}
+	sort.Strings(algorithms)
+
+	// count every distinct key only once, the rsa algorithms all return the same key
+	keysByType := make(map[string]map[string]struct{})
+	for _, algo := range algorithms {
+		key := keys[algo]
+		if keysByType[key.Type()] == nil {
+			keysByType[key.Type()] = make(map[string]struct{})
+		}
+		keysByType[key.Type()][ssh.FingerprintSHA256(key)] = struct{}{}
+	}
+	types := make([]string, 0, len(keysByType))
+	for keyType := range keysByType {
+		types = append(types, keyType)
+	}
+	sort.Strings(types)
+	m.header("probe_ssh_host_keys", "gauge", "Number of distinct host keys by key type.")
+	for _, keyType := range types {
+		m.sample("probe_ssh_host_keys", float64(len(keysByType[keyType])), "type", keyType)
+	}
+
+	if len(expectedFingerprints) > 0 {
+		expected := make(map[string]struct{}, len(expectedFingerprints))
+		for _, fp := range expectedFingerprints {
+			expected[fp] = struct{}{}
+		}
+		m.header("probe_ssh_host_key_expected", "gauge", "Whether the host key matches one of the expected fingerprints.")
+		for _, algo := range algorithms {
+			fp := ssh.FingerprintSHA256(keys[algo])
+			_, ok := expected[fp]
+			m.sample("probe_ssh_host_key_expected", boolToFloat(ok),
+				"algorithm", algo, "type", keys[algo].Type(), "fingerprint", fp)
+		}
+	}
+
+	headerWritten := false
+	for _, algo := range algorithms {
+		cert, ok := keys[algo].(*ssh.Certificate)
+		if !ok {
+			continue
+		}
+		if !headerWritten {
+			m.header("probe_ssh_host_certificate_expiry_timestamp_seconds", "gauge",
+				"Unix timestamp at which the host certificate expires.")
+			headerWritten = true
+		}
+		expiry := math.Inf(1)
+		if cert.ValidBefore != ssh.CertTimeInfinity {
+			expiry = float64(cert.ValidBefore)
+		}
+		m.sample("probe_ssh_host_certificate_expiry_timestamp_seconds", expiry,
+			"algorithm", algo, "key_id", cert.KeyId, "fingerprint", ssh.FingerprintSHA256(cert.Key))
+	}
+}
+
+func (e *exporter) metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metricsWriter{w: w}
+
+	m.gauge("sshkeys_exporter_build_info", "Build information of the exporter.", 1,
+		"version", version, "commit", commit, "date", date, "goversion", runtime.Version())
+
+	e.mu.Lock()
+	probeKeys := make([][2]string, 0, len(e.probes))
+	for k := range e.probes {
+		probeKeys = append(probeKeys, k)
+	}
+	sort.Slice(probeKeys, func(i, j int) bool {
+		if probeKeys[i][0] != probeKeys[j][0] {
+			return probeKeys[i][0] < probeKeys[j][0]
+		}
+		return probeKeys[i][1] < probeKeys[j][1]
+	})
+	m.header("sshkeys_exporter_probes_total", "counter", "Number of probes by module and result.")
+	for _, k := range probeKeys {
+		m.sample("sshkeys_exporter_probes_total", float64(e.probes[k]), "module", k[0], "result", k[1])
+	}
+	e.mu.Unlock()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	m.gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.",
+		float64(e.startTime.UnixNano())/float64(time.Second))
+	m.gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	m.gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(stats.Alloc))
+	m.gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(stats.HeapInuse))
+	m.gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(stats.Sys))
+	m.header("go_memstats_mallocs_total", "counter", "Total number of mallocs.")
+	m.sample("go_memstats_mallocs_total", float64(stats.Mallocs))
+	m.header("go_gc_cycles_total", "counter", "Number of completed GC cycles.")
+	m.sample("go_gc_cycles_total", float64(stats.NumGC))
+}
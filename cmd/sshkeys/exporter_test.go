@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+var durationSample = regexp.MustCompile(`(?m)^(probe_(?:ssh_handshake_)?duration_seconds) \S+$`)
+
+// probe requests /probe with query and returns the exposition output with the durations masked.
+func probe(t *testing.T, e *exporter, query string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	e.probeHandler(w, httptest.NewRequest(http.MethodGet, "/probe?"+query, nil))
+	return w.Code, durationSample.ReplaceAllString(w.Body.String(), "$1 <duration>")
+}
+
+func newTestExporter(t *testing.T, modules map[string]*exporterModule) *exporter {
+	t.Helper()
+	config, err := loadExporterConfig("")
+	require.NoError(t, err)
+	for name, module := range modules {
+		config.Modules[name] = module
+	}
+	return &exporter{
+		config:    config,
+		startTime: time.Now(),
+		probes:    make(map[[2]string]uint64),
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	t.Parallel()
+	edSigner, ecSigner := newTestSigners(t)
+	edFingerprint := xssh.FingerprintSHA256(edSigner.PublicKey())
+	ecFingerprint := xssh.FingerprintSHA256(ecSigner.PublicKey())
+	target := net.JoinHostPort("127.0.0.1", startTestServer(t, edSigner, ecSigner))
+
+	e := newTestExporter(t, map[string]*exporterModule{
+		"expected": {
+			Timeout:              10 * time.Second,
+			Concurrent:           2,
+			Algorithms:           []string{xssh.KeyAlgoED25519, xssh.KeyAlgoECDSA256},
+			ExpectedFingerprints: []string{edFingerprint},
+		},
+	})
+
+	code, body := probe(t, e, "module=expected&target="+target)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `# HELP probe_success Whether the probe was successful.
+# TYPE probe_success gauge
+probe_success 1
+# HELP probe_duration_seconds How long the probe took to complete in seconds.
+# TYPE probe_duration_seconds gauge
+probe_duration_seconds <duration>
+# HELP probe_ssh_handshake_duration_seconds How long fetching all host keys took in seconds.
+# TYPE probe_ssh_handshake_duration_seconds gauge
+probe_ssh_handshake_duration_seconds <duration>
+# HELP probe_ssh_banner_info The ssh version banner of the target.
+# TYPE probe_ssh_banner_info gauge
+probe_ssh_banner_info{banner="`+testServerVersion+`"} 1
+# HELP probe_ssh_host_keys Number of distinct host keys by key type.
+# TYPE probe_ssh_host_keys gauge
+probe_ssh_host_keys{type="ecdsa-sha2-nistp256"} 1
+probe_ssh_host_keys{type="ssh-ed25519"} 1
+# HELP probe_ssh_host_key_expected Whether the host key matches one of the expected fingerprints.
+# TYPE probe_ssh_host_key_expected gauge
+probe_ssh_host_key_expected{algorithm="ecdsa-sha2-nistp256",type="ecdsa-sha2-nistp256",fingerprint="`+ecFingerprint+`"} 0
+probe_ssh_host_key_expected{algorithm="ssh-ed25519",type="ssh-ed25519",fingerprint="`+edFingerprint+`"} 1
+`, body)
+
+	// a port that does not accept connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedTarget := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	code, body = probe(t, e, "target="+closedTarget)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `# HELP probe_success Whether the probe was successful.
+# TYPE probe_success gauge
+probe_success 0
+# HELP probe_duration_seconds How long the probe took to complete in seconds.
+# TYPE probe_duration_seconds gauge
+probe_duration_seconds <duration>
+`, body)
+
+	code, _ = probe(t, e, "module=expected")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = probe(t, e, "module=unknown&target="+target)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	w := httptest.NewRecorder()
+	e.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, w.Body.String(), `# TYPE sshkeys_exporter_probes_total counter
+sshkeys_exporter_probes_total{module="default",result="failure"} 1
+sshkeys_exporter_probes_total{module="expected",result="success"} 1
+`)
+}
+
+func TestWriteErrorMetrics(t *testing.T) {
+	t.Parallel()
+	var sb strings.Builder
+	writeErrorMetrics(&metricsWriter{w: &sb}, nil)
+	require.Empty(t, sb.String())
+
+	writeErrorMetrics(&metricsWriter{w: &sb}, map[string]string{
+		xssh.KeyAlgoRSASHA512:         "i/o timeout",
+		sshkeys.ServerAlgorithmsError: "connection reset by peer",
+		xssh.KeyAlgoED25519:           "handshake failed",
+	})
+	require.Equal(t, `# HELP probe_ssh_algorithm_failed Whether fetching the host key with the algorithm failed.
+# TYPE probe_ssh_algorithm_failed gauge
+probe_ssh_algorithm_failed{algorithm="rsa-sha2-512"} 1
+probe_ssh_algorithm_failed{algorithm="server-algorithms"} 1
+probe_ssh_algorithm_failed{algorithm="ssh-ed25519"} 1
+`, sb.String())
+}
+
+func TestWriteKeyMetrics(t *testing.T) {
+	t.Parallel()
+	edSigner, ecSigner := newTestSigners(t)
+	edFingerprint := xssh.FingerprintSHA256(edSigner.PublicKey())
+	ecFingerprint := xssh.FingerprintSHA256(ecSigner.PublicKey())
+
+	cert := &xssh.Certificate{
+		Key:         edSigner.PublicKey(),
+		CertType:    xssh.HostCert,
+		KeyId:       "host \"a\"",
+		ValidBefore: 1700000000,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ecSigner))
+	infiniteCert := &xssh.Certificate{
+		Key:         ecSigner.PublicKey(),
+		CertType:    xssh.HostCert,
+		KeyId:       "host-b",
+		ValidBefore: xssh.CertTimeInfinity,
+	}
+	require.NoError(t, infiniteCert.SignCert(rand.Reader, ecSigner))
+
+	tests := []struct {
+		name     string
+		keys     map[string]xssh.PublicKey
+		expected []string
+		output   string
+	}{
+		{
+			name: "no expected fingerprints",
+			keys: map[string]xssh.PublicKey{
+				xssh.KeyAlgoED25519:  edSigner.PublicKey(),
+				xssh.KeyAlgoECDSA256: ecSigner.PublicKey(),
+			},
+			output: `# HELP probe_ssh_host_keys Number of distinct host keys by key type.
+# TYPE probe_ssh_host_keys gauge
+probe_ssh_host_keys{type="ecdsa-sha2-nistp256"} 1
+probe_ssh_host_keys{type="ssh-ed25519"} 1
+`,
+		},
+		{
+			name: "unexpected fingerprint",
+			keys: map[string]xssh.PublicKey{
+				xssh.KeyAlgoECDSA256: ecSigner.PublicKey(),
+			},
+			expected: []string{edFingerprint},
+			output: `# HELP probe_ssh_host_keys Number of distinct host keys by key type.
+# TYPE probe_ssh_host_keys gauge
+probe_ssh_host_keys{type="ecdsa-sha2-nistp256"} 1
+# HELP probe_ssh_host_key_expected Whether the host key matches one of the expected fingerprints.
+# TYPE probe_ssh_host_key_expected gauge
+probe_ssh_host_key_expected{algorithm="ecdsa-sha2-nistp256",type="ecdsa-sha2-nistp256",fingerprint="` + ecFingerprint + `"} 0
+`,
+		},
+		{
+			name: "certificates",
+			keys: map[string]xssh.PublicKey{
+				xssh.CertAlgoED25519v01:  cert,
+				xssh.CertAlgoECDSA256v01: infiniteCert,
+				xssh.KeyAlgoED25519:      edSigner.PublicKey(),
+			},
+			expected: []string{edFingerprint},
+			output: `# HELP probe_ssh_host_keys Number of distinct host keys by key type.
+# TYPE probe_ssh_host_keys gauge
+probe_ssh_host_keys{type="ecdsa-sha2-nistp256-cert-v01@openssh.com"} 1
+probe_ssh_host_keys{type="ssh-ed25519"} 1
+probe_ssh_host_keys{type="ssh-ed25519-cert-v01@openssh.com"} 1
+# HELP probe_ssh_host_key_expected Whether the host key matches one of the expected fingerprints.
+# TYPE probe_ssh_host_key_expected gauge
+probe_ssh_host_key_expected{algorithm="ecdsa-sha2-nistp256-cert-v01@openssh.com",type="ecdsa-sha2-nistp256-cert-v01@openssh.com",fingerprint="` + xssh.FingerprintSHA256(infiniteCert) + `"} 0
+probe_ssh_host_key_expected{algorithm="ssh-ed25519",type="ssh-ed25519",fingerprint="` + edFingerprint + `"} 1
+probe_ssh_host_key_expected{algorithm="ssh-ed25519-cert-v01@openssh.com",type="ssh-ed25519-cert-v01@openssh.com",fingerprint="` + xssh.FingerprintSHA256(cert) + `"} 0
+# HELP probe_ssh_host_certificate_expiry_timestamp_seconds Unix timestamp at which the host certificate expires.
+# TYPE probe_ssh_host_certificate_expiry_timestamp_seconds gauge
+probe_ssh_host_certificate_expiry_timestamp_seconds{algorithm="ecdsa-sha2-nistp256-cert-v01@openssh.com",key_id="host-b",fingerprint="` + ecFingerprint + `"} +Inf
+probe_ssh_host_certificate_expiry_timestamp_seconds{algorithm="ssh-ed25519-cert-v01@openssh.com",key_id="host \"a\"",fingerprint="` + edFingerprint + `"} 1.7e+09
+`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var sb strings.Builder
+			writeKeyMetrics(&metricsWriter{w: &sb}, test.keys, test.expected)
+			require.Equal(t, test.output, sb.String())
+		})
+	}
+}
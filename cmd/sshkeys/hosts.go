@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// hostFlags are the options the subcommands that check a list of hosts have in common.
+type hostFlags struct {
+	file       string
+	output     string
+	parallel   int
+	concurrent int
+	timeout    string
+}
+
+// register adds -o/-output, -p/-parallel and -t/-timeout to flags.
+// fileNames are the names of the flag with the hosts file, e.g. file and f, there is none if fileNames is empty.
+func (h *hostFlags) register(flags *flag.FlagSet, fileNames ...string) {
+	flags.StringVar(&h.output, "output", "", "")
+	flags.StringVar(&h.output, "o", "", "")
+	for _, name := range fileNames {
+		flags.StringVar(&h.file, name, "", "")
+	}
+	flags.IntVar(&h.parallel, "parallel", 1, "")
+	flags.IntVar(&h.parallel, "p", 1, "")
+	flags.StringVar(&h.timeout, "timeout", "60s", "")
+	flags.StringVar(&h.timeout, "t", "60s", "")
+}
+
+// registerConcurrent adds -c/-concurrent for the subcommands that fetch the keys of a host over several connections.
+func (h *hostFlags) registerConcurrent(flags *flag.FlagSet) {
+	flags.IntVar(&h.concurrent, "concurrent", 4, "") //nolint: gomnd // allow constant
+	flags.IntVar(&h.concurrent, "c", 4, "")          //nolint: gomnd // allow constant
+}
+
+// printConcurrentUsage prints the usage of the flags hostFlags.registerConcurrent added.
+func printConcurrentUsage() {
+	fmt.Fprintln(os.Stderr, "    -c=4")
+	fmt.Fprintln(os.Stderr, "    -concurrent=4")
+	fmt.Fprintln(os.Stderr, "       Concurrent workers per host")
+	fmt.Fprintln(os.Stderr)
+}
+
+// printHostFlagsUsage prints the usage of the flags hostFlags.register added with fileNames.
+func printHostFlagsUsage(fileNames ...string) {
+	fmt.Fprintln(os.Stderr, "    -o=console")
+	fmt.Fprintln(os.Stderr, "    -output=console")
+	fmt.Fprintln(os.Stderr, "       Output format, valid formats are: console, json")
+	fmt.Fprintln(os.Stderr)
+	if len(fileNames) > 0 {
+		for _, name := range fileNames {
+			fmt.Fprintf(os.Stderr, "    -%s=\n", name)
+		}
+		fmt.Fprintln(os.Stderr, "       File with the hosts, - reads from stdin")
+		fmt.Fprintln(os.Stderr)
+	}
+	fmt.Fprintln(os.Stderr, "    -p=1")
+	fmt.Fprintln(os.Stderr, "    -parallel=1")
+	fmt.Fprintln(os.Stderr, "       Hosts that are scanned at the same time")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -t=60s")
+	fmt.Fprintln(os.Stderr, "    -timeout=60s")
+	fmt.Fprintln(os.Stderr, "       Connection timeout")
+	fmt.Fprintln(os.Stderr)
+}
+
+// hosts returns args followed by the hosts of the hosts file.
+func (h *hostFlags) hosts(args []string) ([]string, error) {
+	if h.file == "" {
+		return args, nil
+	}
+	fileHosts, err := readHostsFile(h.file)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, fileHosts...), nil
+}
+
+// parse returns the output format, either outputConsole or outputJSON, and the timeout.
+// command is the name of the subcommand that is reported for unsupported output formats.
+func (h *hostFlags) parse(command string) (int, time.Duration, error) {
+	output := parseOutput(h.output)
+	if output != outputConsole && output != outputJSON {
+		return 0, 0, fmt.Errorf("'%s' is not supported by %s", h.output, command)
+	}
+	timeout, err := time.ParseDuration(h.timeout)
+	if err != nil {
+		return 0, 0, fmt.Errorf("'%s' is not a duration", h.timeout)
+	}
+	return output, timeout, nil
+}
+
+// forEachHost calls scan for every host with its index, at most parallel hosts are scanned at the same time.
+// It returns once every host was scanned.
+func forEachHost(ctx context.Context, hosts []string, parallel int, scan func(ctx context.Context, i int, host string)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			scan(ctx, i, hosts[i])
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachHost(t *testing.T) {
+	t.Parallel()
+	hosts := []string{"a", "b", "c", "d", "e"}
+	for _, parallel := range []int{0, 1, 2, 10} {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		scanned := make([]string, len(hosts))
+		forEachHost(context.Background(), hosts, parallel, func(_ context.Context, i int, host string) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			scanned[i] = host
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+		require.Equal(t, hosts, scanned)
+		expected := parallel
+		if expected < 1 {
+			expected = 1
+		}
+		if expected > len(hosts) {
+			expected = len(hosts)
+		}
+		require.LessOrEqual(t, maxRunning, expected, "parallel %d", parallel)
+	}
+}
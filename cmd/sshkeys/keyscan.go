@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	keyscanExitFound    = 0
+	keyscanExitNotFound = 1
+)
+
+// keyscanType is a key type of ssh-keyscan -t with the host key algorithms ssh-keyscan offers for it,
+// the server uses the first algorithm it supports.
+type keyscanType struct {
+	name           string
+	algorithms     []string
+	certAlgorithms []string
+}
+
+// keyscanTypes are the key types in the order ssh-keyscan scans them.
+var keyscanTypes = []keyscanType{
+	{"dsa", []string{ssh.KeyAlgoDSA}, []string{ssh.CertAlgoDSAv01}},
+	{
+		"rsa",
+		[]string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+		[]string{ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01},
+	},
+	{
+		"ecdsa",
+		[]string{ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521},
+		[]string{ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01},
+	},
+	{"ed25519", []string{ssh.KeyAlgoED25519}, []string{ssh.CertAlgoED25519v01}},
+	{"ecdsa-sk", []string{ssh.KeyAlgoSKECDSA256}, []string{ssh.CertAlgoSKECDSA256v01}},
+	{"ed25519-sk", []string{ssh.KeyAlgoSKED25519}, []string{ssh.CertAlgoSKED25519v01}},
+}
+
+// keyscanDefaultTypes are the types ssh-keyscan scans if -t is not set.
+const keyscanDefaultTypes = "rsa,ecdsa,ed25519,ecdsa-sk,ed25519-sk"
+
+// keyscanTarget is an address ssh-keyscan connects to and the names its keys are printed for.
+type keyscanTarget struct {
+	address string
+	names   []string
+}
+
+type keyscanOptions struct {
+	types      []keyscanType
+	port       string
+	network    string
+	timeout    time.Duration
+	concurrent int
+	certs      bool
+	hash       bool
+}
+
+// keyscanConnection is the result of the connection for a key type.
+type keyscanConnection struct {
+	key     ssh.PublicKey
+	version string
+	err     error
+}
+
+func printKeyscanUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s keyscan [-46cHv] [-f file] [-p port] [-T timeout] [-t type] [host | addrlist namelist]\n",
+		filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Prints the host keys like ssh-keyscan: the keys are written to stdout in the known_hosts format,")
+	fmt.Fprintln(os.Stderr, "every key type is scanned with a connection of its own, the version of every connection is written")
+	fmt.Fprintln(os.Stderr, "to stderr as # host:port version.")
+	fmt.Fprintln(os.Stderr, "Hosts are scanned in parallel, the output is written in the order of the hosts.")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if a key was found and 1 otherwise.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -4, -6")
+	fmt.Fprintln(os.Stderr, "       Use IPv4 or IPv6 addresses only")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -c")
+	fmt.Fprintln(os.Stderr, "       Print host certificates instead of keys")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -f=")
+	fmt.Fprintln(os.Stderr, "       File with hosts or addrlist namelist pairs, - reads from stdin, can be repeated")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -H")
+	fmt.Fprintln(os.Stderr, "       Hash the host names")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -p=22")
+	fmt.Fprintln(os.Stderr, "       Port to connect to")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -T=5")
+	fmt.Fprintln(os.Stderr, "       Connection timeout in seconds or as duration")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "    -t=%s\n", keyscanDefaultTypes)
+	fmt.Fprintln(os.Stderr, "       Key types to scan: dsa, rsa, ecdsa, ed25519, ecdsa-sk, ed25519-sk")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -v")
+	fmt.Fprintln(os.Stderr, "       Print connection errors")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -parallel=16")
+	fmt.Fprintln(os.Stderr, "       Hosts that are scanned at the same time")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -concurrent=4")
+	fmt.Fprintln(os.Stderr, "       Concurrent connections per host")
+	fmt.Fprintln(os.Stderr)
+}
+
+func runKeyscan(args []string) int {
+	return keyscanMain(args, os.Stdout, os.Stderr)
+}
+
+// keyscanMain is runKeyscan with the writers the keys and the comments are written to.
+func keyscanMain(args []string, stdout, stderr io.Writer) int {
+	var portOpt, timeoutOpt, typesOpt string
+	var ipv4Opt, ipv6Opt, verboseOpt bool
+	var files []string
+	var parallelOpt int
+	var options keyscanOptions
+	flags := flag.NewFlagSet("keyscan", flag.ContinueOnError)
+	flags.Usage = printKeyscanUsage
+	flags.BoolVar(&ipv4Opt, "4", false, "")
+	flags.BoolVar(&ipv6Opt, "6", false, "")
+	flags.BoolVar(&options.certs, "c", false, "")
+	flags.BoolVar(&options.hash, "H", false, "")
+	flags.BoolVar(&verboseOpt, "v", false, "")
+	flags.Func("f", "", func(s string) error {
+		files = append(files, s)
+		return nil
+	})
+	flags.StringVar(&portOpt, "p", "22", "")
+	flags.StringVar(&timeoutOpt, "T", "5", "")
+	flags.StringVar(&typesOpt, "t", keyscanDefaultTypes, "")
+	flags.IntVar(&parallelOpt, "parallel", 16, "")         //nolint: gomnd // default
+	flags.IntVar(&options.concurrent, "concurrent", 4, "") //nolint: gomnd // default
+	if err := flags.Parse(expandGetoptArgs(flags, args)); err != nil {
+		return keyscanExitNotFound
+	}
+	if port, err := strconv.ParseUint(portOpt, 10, 16); err != nil || port == 0 {
+		fmt.Fprintf(stderr, "Bad port '%s'\n", portOpt)
+		return keyscanExitNotFound
+	}
+	options.port = portOpt
+	var err error
+	if options.timeout, err = parseKeyscanTimeout(timeoutOpt); err != nil {
+		fmt.Fprintf(stderr, "Bad timeout '%s'\n", timeoutOpt)
+		return keyscanExitNotFound
+	}
+	if options.types, err = parseKeyscanTypes(typesOpt); err != nil {
+		fmt.Fprintln(stderr, err)
+		return keyscanExitNotFound
+	}
+	options.network = "ip"
+	switch {
+	case ipv4Opt && !ipv6Opt:
+		options.network = "ip4"
+	case ipv6Opt && !ipv4Opt:
+		options.network = "ip6"
+	}
+
+	// like ssh-keyscan the files are read before the hosts of the arguments
+	var targets []keyscanTarget
+	for _, file := range files {
+		fileTargets, err := readKeyscanFile(file)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return keyscanExitNotFound
+		}
+		targets = append(targets, fileTargets...)
+	}
+	for _, arg := range flags.Args() {
+		targets = append(targets, parseKeyscanLine(arg)...)
+	}
+	if len(targets) == 0 {
+		printKeyscanUsage()
+		return keyscanExitNotFound
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	// every target writes into its own buffers, which are flushed in the order of the targets
+	type output struct {
+		stdout, stderr bytes.Buffer
+		found          bool
+		done           chan struct{}
+	}
+	outputs := make([]*output, len(targets))
+	for i := range outputs {
+		outputs[i] = &output{done: make(chan struct{})}
+	}
+	hosts := make([]string, len(targets))
+	for i := range targets {
+		hosts[i] = targets[i].address
+	}
+	go forEachHost(ctx, hosts, parallelOpt, func(ctx context.Context, i int, _ string) {
+		out := outputs[i]
+		defer close(out.done)
+		out.found = keyscan(ctx, &targets[i], &options, &out.stdout, &out.stderr, verboseOpt)
+	})
+
+	exitCode := keyscanExitNotFound
+	for _, out := range outputs {
+		<-out.done
+		_, _ = io.Copy(stderr, &out.stderr)
+		_, _ = io.Copy(stdout, &out.stdout)
+		if out.found {
+			exitCode = keyscanExitFound
+		}
+	}
+	return exitCode
+}
+
+// keyscan scans target and writes the keys to stdout and the versions and errors to stderr like ssh-keyscan does.
+// It reports whether a key was found.
+func keyscan(
+	ctx context.Context,
+	target *keyscanTarget,
+	options *keyscanOptions,
+	stdout, stderr io.Writer,
+	verbose bool,
+) bool {
+	address, err := resolveKeyscanAddress(ctx, target.address, options.network)
+	if err != nil {
+		fmt.Fprintf(stderr, "getaddrinfo %s: %s\n", target.address, err)
+		return false
+	}
+	address = net.JoinHostPort(address, options.port)
+
+	// like ssh-keyscan every type is scanned with a connection that offers all algorithms of the type
+	connections := make([]keyscanConnection, len(options.types))
+	addresses := make([]string, len(options.types))
+	for i := range addresses {
+		addresses[i] = address
+	}
+	forEachHost(ctx, addresses, options.concurrent, func(ctx context.Context, i int, address string) {
+		ctx, cancel := context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+		c := &connections[i]
+		c.key, c.version, c.err = sshkeys.GetHostKey(ctx, address, options.types[i].keyAlgorithms(options.certs)...)
+	})
+
+	found := false
+	for _, c := range connections {
+		if c.version == "" {
+			var dnsErr *net.DNSError
+			if errors.As(c.err, &dnsErr) {
+				fmt.Fprintf(stderr, "getaddrinfo %s: %s\n", target.address, dnsErr.Err)
+				return found
+			}
+			// ssh-keyscan is silent about hosts that do not answer unless it is verbose
+			if verbose && c.err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", target.address, c.err)
+			}
+			continue
+		}
+		fmt.Fprintf(stderr, "# %s:%s %s\n", target.address, options.port, c.version)
+		if c.err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", target.address, c.err)
+			continue
+		}
+		if c.key == nil {
+			continue
+		}
+		found = true
+		line := ssh.MarshalAuthorizedKey(c.key)
+		if options.certs {
+			// ssh-keyscan prints certificates without host
+			_, _ = stdout.Write(line)
+			continue
+		}
+		for _, name := range keyscanHostNames(target.names, options.port, options.hash) {
+			fmt.Fprintf(stdout, "%s %s", name, line)
+		}
+	}
+	return found
+}
+
+func (t *keyscanType) keyAlgorithms(certs bool) []string {
+	if certs {
+		return t.certAlgorithms
+	}
+	return t.algorithms
+}
+
+// keyscanHostNames returns the known_hosts names the keys of a target with names are printed for, like ssh-keyscan:
+// names are lowercased and [host]:port is used for other ports than 22. The names share one line on port 22,
+// they are printed on lines of their own if they are hashed or on other ports.
+func keyscanHostNames(names []string, port string, hash bool) []string {
+	if !hash && port == "22" {
+		return []string{strings.ToLower(strings.Join(names, ","))}
+	}
+	hosts := make([]string, 0, len(names))
+	for _, name := range names {
+		host := name
+		if port != "22" {
+			host = "[" + host + "]:" + port
+		}
+		host = strings.ToLower(host)
+		if hash {
+			host = knownhosts.HashHostname(host)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// resolveKeyscanAddress resolves host to an address of network (ip, ip4 or ip6).
+// Hosts are only resolved if the network is restricted, otherwise they are resolved when connecting.
+func resolveKeyscanAddress(ctx context.Context, host, network string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil || network == "ip" {
+		if ip != nil && (network == "ip4" && ip.To4() == nil || network == "ip6" && ip.To4() != nil) {
+			return "", errors.New("address family for hostname not supported")
+		}
+		return host, nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return "", errors.New(dnsErr.Err)
+		}
+		return "", err
+	}
+	return ips[0].String(), nil
+}
+
+// parseKeyscanTypes parses the types of -t, they can be named by type (ed25519) or by algorithm (ssh-ed25519).
+// The returned types are in the order of keyscanTypes.
+func parseKeyscanTypes(s string) ([]keyscanType, error) {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, t := range keyscanTypes {
+			for _, algo := range append([]string{t.name}, t.algorithms...) {
+				if name == algo {
+					selected[t.name] = true
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown key type \"%s\"", name) //nolint: stylecheck // like ssh-keyscan
+		}
+	}
+	var types []keyscanType
+	for _, t := range keyscanTypes {
+		if selected[t.name] {
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+// parseKeyscanTimeout parses the seconds of -T, durations like 1m are accepted as well.
+func parseKeyscanTimeout(s string) (time.Duration, error) {
+	var timeout time.Duration
+	if seconds, err := strconv.ParseUint(s, 10, 32); err == nil {
+		timeout = time.Duration(seconds) * time.Second
+	} else if timeout, err = time.ParseDuration(s); err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, errors.New("timeout must be positive")
+	}
+	return timeout, nil
+}
+
+// parseKeyscanLine parses a host argument or a line of a hosts file: a comma separated list of addresses,
+// optionally followed by a comma separated list of names that are printed instead of the addresses.
+func parseKeyscanLine(line string) []keyscanTarget {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	var names []string
+	if len(fields) > 1 {
+		names = strings.Split(fields[1], ",")
+	}
+	var targets []keyscanTarget
+	for _, address := range strings.Split(fields[0], ",") {
+		if address == "" {
+			continue
+		}
+		target := keyscanTarget{address: address, names: names}
+		if target.names == nil {
+			target.names = []string{address}
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func readKeyscanFile(file string) ([]keyscanTarget, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open hosts file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var targets []keyscanTarget
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		targets = append(targets, parseKeyscanLine(line)...)
+	}
+	return targets, scanner.Err()
+}
+
+// expandGetoptArgs splits combined single letter options of flags like getopt does:
+// -Hc becomes -H -c and -p2222 becomes -p 2222. Parsing stops at the first argument that is no option.
+func expandGetoptArgs(flags *flag.FlagSet, args []string) []string {
+	takesValue := func(name string) bool {
+		f := flags.Lookup(name)
+		if f == nil {
+			return false
+		}
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return !ok || !b.IsBoolFlag()
+	}
+	var expanded []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return append(expanded, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if hasValue || len(name) == 1 || flags.Lookup(name) != nil {
+			expanded = append(expanded, arg)
+			if !hasValue && takesValue(name) && i+1 < len(args) {
+				i++
+				expanded = append(expanded, args[i])
+			}
+			continue
+		}
+		for j := 0; j < len(name); j++ {
+			letter := name[j : j+1]
+			expanded = append(expanded, "-"+letter)
+			if !takesValue(letter) {
+				continue
+			}
+			if j+1 < len(name) {
+				expanded = append(expanded, name[j+1:])
+			} else if i+1 < len(args) {
+				i++
+				expanded = append(expanded, args[i])
+			}
+			break
+		}
+	}
+	return expanded
+}
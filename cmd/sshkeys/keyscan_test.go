@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyscan(t *testing.T) {
+	t.Parallel()
+	edSigner, ecSigner := newTestSigners(t)
+	port := startTestServer(t, edSigner, ecSigner)
+	ed := authorizedKey(edSigner.PublicKey())
+	ec := authorizedKey(ecSigner.PublicKey())
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdout string
+		stderr string
+		exit   int
+	}{
+		{
+			name:   "types are scanned in the order of ssh-keyscan",
+			args:   []string{"-t", "ed25519,ecdsa", "-p", port, "127.0.0.1"},
+			stdout: "[127.0.0.1]:" + port + " " + ec + "[127.0.0.1]:" + port + " " + ed,
+			stderr: strings.Repeat("# 127.0.0.1:"+port+" "+testServerVersion+"\n", 2),
+		},
+		{
+			name:   "one connection per type",
+			args:   []string{"-t", "ecdsa", "-concurrent", "1", "-p", port, "127.0.0.1"},
+			stdout: "[127.0.0.1]:" + port + " " + ec,
+			stderr: "# 127.0.0.1:" + port + " " + testServerVersion + "\n",
+		},
+		{
+			name:   "host names are lowercased",
+			args:   []string{"-t", "ed25519", "-p" + port, "LocalHost"},
+			stdout: "[localhost]:" + port + " " + ed,
+			stderr: "# LocalHost:" + port + " " + testServerVersion + "\n",
+		},
+		{
+			name:   "addrlist and namelist",
+			args:   []string{"-t", "ssh-ed25519", "-p", port, "127.0.0.1,localhost", "127.0.0.1 Web1,web2"},
+			stdout: "[127.0.0.1]:" + port + " " + ed + "[localhost]:" + port + " " + ed + "[web1]:" + port + " " + ed + "[web2]:" + port + " " + ed,
+			stderr: "# 127.0.0.1:" + port + " " + testServerVersion + "\n" +
+				"# localhost:" + port + " " + testServerVersion + "\n" +
+				"# 127.0.0.1:" + port + " " + testServerVersion + "\n",
+		},
+		{
+			name:   "no certificates",
+			args:   []string{"-c", "-t", "ed25519", "-p", port, "127.0.0.1"},
+			stderr: "# 127.0.0.1:" + port + " " + testServerVersion + "\n",
+			exit:   keyscanExitNotFound,
+		},
+		{
+			name:   "unknown type",
+			args:   []string{"-t", "rsa1", "127.0.0.1"},
+			stderr: "Unknown key type \"rsa1\"\n",
+			exit:   keyscanExitNotFound,
+		},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		exit := keyscanMain(test.args, &stdout, &stderr)
+		require.Equal(t, test.exit, exit, test.name)
+		require.Equal(t, test.stdout, stdout.String(), test.name)
+		require.Equal(t, test.stderr, stderr.String(), test.name)
+	}
+}
+
+func TestKeyscanHashed(t *testing.T) {
+	t.Parallel()
+	edSigner, _ := newTestSigners(t)
+	port := startTestServer(t, edSigner)
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, keyscanExitFound, keyscanMain([]string{"-Ht", "ed25519", "-p", port, "127.0.0.1 web1,web2"}, &stdout, &stderr))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		require.True(t, strings.HasPrefix(line, "|1|"), line)
+	}
+	f := sshkeys.ParseKnownHostsFile(stdout.Bytes())
+	for _, host := range []string{"web1", "web2"} {
+		entries := f.Lookup(net.JoinHostPort(host, port))
+		require.Len(t, entries, 1, host)
+		require.True(t, entries[0].Hashed)
+		require.Equal(t, edSigner.PublicKey().Marshal(), entries[0].Key.Marshal())
+	}
+}
+
+func TestKeyscanHostNames(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, []string{"web1,web2"}, keyscanHostNames([]string{"Web1", "web2"}, "22", false))
+	require.Equal(t, []string{"[web1]:2222", "[web2]:2222"}, keyscanHostNames([]string{"Web1", "web2"}, "2222", false))
+
+	hashed := keyscanHostNames([]string{"Web1", "web2"}, "22", true)
+	require.Len(t, hashed, 2)
+	f := sshkeys.ParseKnownHostsFile([]byte(hashed[0] + " " + "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAHgmP/2aQi4cop/0tYdWE8h0z7OFYbwL7TStykYfc6J\n"))
+	require.Len(t, f.Lookup("web1"), 1)
+}
+
+func TestExpandGetoptArgs(t *testing.T) {
+	t.Parallel()
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Bool("H", false, "")
+	flags.Bool("c", false, "")
+	flags.String("p", "22", "")
+	flags.String("t", "", "")
+	flags.Int("parallel", 1, "")
+	require.Equal(t,
+		[]string{"-p", "2222", "-H", "-c", "-t", "rsa", "-parallel", "4", "-t", "-H", "host", "-c"},
+		expandGetoptArgs(flags, []string{"-p2222", "-Hct", "rsa", "-parallel", "4", "-t", "-H", "host", "-c"}),
+	)
+}
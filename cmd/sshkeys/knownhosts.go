@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxSymlinks limits the symlinks that are followed to the known_hosts file.
+const maxSymlinks = 40
+
+const (
+	updateKnownHostsExitOK      = 0
+	updateKnownHostsExitFailed  = 1
+	updateKnownHostsExitTrouble = 2
+)
+
+// updateKnownHostsHost is the json representation of the update of a single host.
+type updateKnownHostsHost struct {
+	Host    string                     `json:"host"`
+	Address string                     `json:"address,omitempty"`
+	Changes []sshkeys.KnownHostsChange `json:"changes"`
+	Error   string                     `json:"error,omitempty"`
+
+	keys []ssh.PublicKey
+}
+
+func printUpdateKnownHostsUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s update-known-hosts [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Scans the hosts and updates their keys in a known_hosts file in place: outdated keys are replaced,")
+	fmt.Fprintln(os.Stderr, "missing keys are added and keys the hosts no longer offer are removed. Hashed hosts are found and stay hashed.")
+	fmt.Fprintln(os.Stderr, "Other hosts, comments, @cert-authority and @revoked lines and wildcard patterns are not changed.")
+	fmt.Fprintln(os.Stderr, "Hosts that can not be scanned are not changed.")
+	fmt.Fprintln(os.Stderr, "Exits with 0 on success, 1 if a host could not be scanned and 2 on errors.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -file=~/.ssh/known_hosts")
+	fmt.Fprintln(os.Stderr, "       known_hosts file to update, it is created if it does not exist")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -H")
+	fmt.Fprintln(os.Stderr, "       Hash the host names of added lines (like HashKnownHosts)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -n")
+	fmt.Fprintln(os.Stderr, "    -dry-run")
+	fmt.Fprintln(os.Stderr, "       Print the changes as unified diff instead of writing the file, json output contains it in diff")
+	fmt.Fprintln(os.Stderr)
+	printConcurrentUsage()
+	printHostFlagsUsage("hosts")
+}
+
+func defaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+func runUpdateKnownHosts(args []string) int {
+	var fileOpt string
+	var hashOpt, dryRunOpt bool
+	var hostOpts hostFlags
+	flags := flag.NewFlagSet("update-known-hosts", flag.ContinueOnError)
+	flags.Usage = printUpdateKnownHostsUsage
+	flags.StringVar(&fileOpt, "file", defaultKnownHostsFile(), "")
+	flags.BoolVar(&hashOpt, "H", false, "")
+	flags.BoolVar(&dryRunOpt, "dry-run", false, "")
+	flags.BoolVar(&dryRunOpt, "n", false, "")
+	hostOpts.register(flags, "hosts")
+	hostOpts.registerConcurrent(flags)
+	if err := flags.Parse(args); err != nil {
+		return updateKnownHostsExitTrouble
+	}
+	hosts, err := hostOpts.hosts(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return updateKnownHostsExitTrouble
+	}
+	if len(hosts) == 0 || fileOpt == "" {
+		printUpdateKnownHostsUsage()
+		return updateKnownHostsExitTrouble
+	}
+	output, timeout, err := hostOpts.parse("update-known-hosts")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return updateKnownHostsExitTrouble
+	}
+	data, err := os.ReadFile(fileOpt)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "unable to read known_hosts: %s\n", err)
+		return updateKnownHostsExitTrouble
+	}
+	knownHosts := sshkeys.ParseKnownHostsFile(data)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	results := make([]updateKnownHostsHost, len(hosts))
+	forEachHost(ctx, hosts, hostOpts.parallel, func(ctx context.Context, i int, host string) {
+		results[i] = scanKnownHost(ctx, host, hostOpts.concurrent, timeout)
+	})
+
+	// the hosts are updated in the order they were specified, so added lines do not depend on the scan order
+	exitCode := updateKnownHostsExitOK
+	for i := range results {
+		if results[i].Error != "" {
+			exitCode = updateKnownHostsExitFailed
+			continue
+		}
+		results[i].Changes = knownHosts.Update(results[i].Address, results[i].keys, hashOpt)
+		if results[i].Changes == nil {
+			results[i].Changes = []sshkeys.KnownHostsChange{}
+		}
+	}
+
+	var diff string
+	if dryRunOpt {
+		diff = knownHosts.Diff(fileOpt)
+	} else if knownHosts.Changed() {
+		if err := writeFileAtomic(fileOpt, knownHosts.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to write known_hosts: %s\n", err)
+			return updateKnownHostsExitTrouble
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			SchemaVersion int                    `json:"schema_version"`
+			DryRun        bool                   `json:"dry_run,omitempty"`
+			Diff          string                 `json:"diff,omitempty"`
+			Hosts         []updateKnownHostsHost `json:"hosts"`
+		}{sshkeys.SchemaVersion, dryRunOpt, diff, results}); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %s\n", err)
+			return updateKnownHostsExitTrouble
+		}
+		return exitCode
+	}
+	fmt.Print(diff)
+	for i := range results {
+		if results[i].Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", results[i].Host, results[i].Error)
+			continue
+		}
+		if dryRunOpt {
+			continue
+		}
+		if len(results[i].Changes) == 0 {
+			fmt.Printf("%s: up to date\n", results[i].Host)
+		}
+		for _, change := range results[i].Changes {
+			fmt.Println(change.String())
+		}
+	}
+	return exitCode
+}
+
+// scanKnownHost fetches the keys of host, all algorithms have to succeed so no key is removed by accident.
+func scanKnownHost(ctx context.Context, host string, concurrent int, timeout time.Duration) updateKnownHostsHost {
+	result := updateKnownHostsHost{Host: host, Changes: []sshkeys.KnownHostsChange{}}
+	target, err := sshkeys.ParseTarget(host)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Address = target.Address()
+	keys, err := sshkeys.GetKeys(ctx, result.Address, concurrent, timeout, plainKeyAlgorithms()...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, algo := range plainKeyAlgorithms() {
+		if key, ok := keys[algo]; ok {
+			result.keys = append(result.keys, key)
+		}
+	}
+	if len(result.keys) == 0 {
+		result.Error = "no host keys found"
+	}
+	return result
+}
+
+// writeFileAtomic replaces file with data: data is written to a temporary file in the same directory,
+// which is renamed to file. The mode of an existing file is kept, new files are created with 0644.
+// If file is a symlink the target is replaced, so the link stays intact.
+func writeFileAtomic(file string, data []byte) error {
+	file, err := resolveSymlink(file)
+	if err != nil {
+		return err
+	}
+	mode := fs.FileMode(0o644) //nolint: gomnd // like ssh creates known_hosts
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+const (
+	auditKnownHostsExitOK       = 0
+	auditKnownHostsExitOutdated = 1
+	auditKnownHostsExitTrouble  = 2
+)
+
+// Status of a host in the audit-known-hosts report.
+const (
+	auditStatusOK          = "ok"
+	auditStatusOutdated    = "outdated"
+	auditStatusUnreachable = "unreachable"
+)
+
+// auditKnownHostsHost is the json representation of the audit of a single host.
+type auditKnownHostsHost struct {
+	sshkeys.KnownHostsAudit
+	Address string `json:"address,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+func printAuditKnownHostsUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s audit-known-hosts [options] [known_hosts]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Scans every host of a known_hosts file (~/.ssh/known_hosts by default) and reports stale keys the host")
+	fmt.Fprintln(os.Stderr, "no longer offers, missing keys, especially of stronger types, and hosts that do not answer.")
+	fmt.Fprintln(os.Stderr, "Hashed entries are audited if one of the -hosts matches them, wildcard patterns and markers are skipped.")
+	fmt.Fprintln(os.Stderr, "The file is not changed, see update-known-hosts.")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if all hosts are up to date, 1 if a host is outdated or unreachable and 2 on errors.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -hosts=")
+	fmt.Fprintln(os.Stderr, "       File with candidate hosts for hashed entries, - reads from stdin")
+	fmt.Fprintln(os.Stderr)
+	printConcurrentUsage()
+	printHostFlagsUsage()
+}
+
+func runAuditKnownHosts(args []string) int {
+	var hostsOpt string
+	var hostOpts hostFlags
+	flags := flag.NewFlagSet("audit-known-hosts", flag.ContinueOnError)
+	flags.Usage = printAuditKnownHostsUsage
+	flags.StringVar(&hostsOpt, "hosts", "", "")
+	hostOpts.register(flags)
+	hostOpts.registerConcurrent(flags)
+	if err := flags.Parse(args); err != nil {
+		return auditKnownHostsExitTrouble
+	}
+	file := defaultKnownHostsFile()
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		file = flags.Arg(0)
+	default:
+		printAuditKnownHostsUsage()
+		return auditKnownHostsExitTrouble
+	}
+	var candidates []string
+	if hostsOpt != "" {
+		var err error
+		if candidates, err = readHostsFile(hostsOpt); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return auditKnownHostsExitTrouble
+		}
+	}
+	output, timeout, err := hostOpts.parse("audit-known-hosts")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return auditKnownHostsExitTrouble
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read known_hosts: %s\n", err)
+		return auditKnownHostsExitTrouble
+	}
+	knownHosts := sshkeys.ParseKnownHostsFile(data)
+	hosts, unmatched := knownHosts.Hosts(candidates...)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	results := make([]auditKnownHostsHost, len(hosts))
+	forEachHost(ctx, hosts, hostOpts.parallel, func(ctx context.Context, i int, host string) {
+		scan := scanKnownHost(ctx, host, hostOpts.concurrent, timeout)
+		results[i] = auditKnownHostsHost{
+			KnownHostsAudit: knownHosts.Audit(host, scan.keys),
+			Address:         scan.Address,
+			Status:          auditStatusOK,
+		}
+		switch {
+		case scan.Error != "":
+			// an unreachable host offers no keys, so nothing is stale or missing
+			results[i].Stale = nil
+			results[i].Missing = nil
+			results[i].Status = auditStatusUnreachable
+			results[i].Error = scan.Error
+		case !results[i].UpToDate():
+			results[i].Status = auditStatusOutdated
+		}
+	})
+
+	exitCode := auditKnownHostsExitOK
+	for i := range results {
+		if results[i].Status != auditStatusOK {
+			exitCode = auditKnownHostsExitOutdated
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			SchemaVersion   int                   `json:"schema_version"`
+			UnmatchedHashed int                   `json:"unmatched_hashed"`
+			Hosts           []auditKnownHostsHost `json:"hosts"`
+		}{sshkeys.SchemaVersion, unmatched, results}); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %s\n", err)
+			return auditKnownHostsExitTrouble
+		}
+		return exitCode
+	}
+	for i := range results {
+		printAuditKnownHost(&results[i])
+	}
+	if unmatched > 0 {
+		fmt.Fprintf(os.Stderr, "# %d hashed entries did not match any of the -hosts and were not audited\n", unmatched)
+	}
+	return exitCode
+}
+
+func printAuditKnownHost(result *auditKnownHostsHost) {
+	switch result.Status {
+	case auditStatusUnreachable:
+		fmt.Printf("%s: unreachable: %s\n", result.Host, result.Error)
+		return
+	case auditStatusOK:
+		fmt.Printf("%s: up to date\n", result.Host)
+		return
+	}
+	for _, key := range result.Stale {
+		fmt.Printf("%s: stale %s %s (line %d)\n", result.Host, key.Type, key.FingerprintSHA256, key.Line)
+	}
+	for _, key := range result.Missing {
+		stronger := ""
+		if key.Stronger {
+			stronger = " (stronger)"
+		}
+		fmt.Printf("%s: missing %s %s%s\n", result.Host, key.Type, key.FingerprintSHA256, stronger)
+	}
+}
+
+// resolveSymlink returns the file file links to, file is returned if it is no symlink.
+// Links to files that do not exist yet are followed as well.
+func resolveSymlink(file string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(file)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	for i := 0; i < maxSymlinks; i++ {
+		target, err := os.Readlink(file)
+		if err != nil {
+			// file does not exist or is no symlink
+			return file, nil //nolint: nilerr // a missing file is created
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(file), target)
+		}
+		file = target
+	}
+	return "", fmt.Errorf("too many links: %s", file)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+func printKRLUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s krl [options] <krl file> <spec file>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s krl -l <krl file>\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Writes an OpenSSH key revocation list (like ssh-keygen -k) from spec files, - reads from stdin.")
+	fmt.Fprintln(os.Stderr, "Every line of a spec file is a public key or certificate, which is revoked, or one of:")
+	fmt.Fprintln(os.Stderr, "    serial: <serial>[-<serial>]   revokes certificates of -ca by serial")
+	fmt.Fprintln(os.Stderr, "    id: <key id>                  revokes certificates of -ca by key id")
+	fmt.Fprintln(os.Stderr, "    key: <public key>             revokes the key")
+	fmt.Fprintln(os.Stderr, "    sha1: <public key>            revokes the key by its SHA1 hash")
+	fmt.Fprintln(os.Stderr, "    sha256: <public key>          revokes the key by its SHA256 hash")
+	fmt.Fprintln(os.Stderr, "    hash: SHA256:<fingerprint>    revokes the key of the fingerprint")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -ca=")
+	fmt.Fprintln(os.Stderr, "       Public key file of the CA of serial: and id: lines, they apply to all CAs if empty")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -comment=")
+	fmt.Fprintln(os.Stderr, "       Comment of the KRL")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -version=0")
+	fmt.Fprintln(os.Stderr, "       Version of the KRL")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -u")
+	fmt.Fprintln(os.Stderr, "       Add the revocations to the existing KRL instead of replacing it")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -l")
+	fmt.Fprintln(os.Stderr, "       List the revocations of the KRL in the spec format")
+	fmt.Fprintln(os.Stderr)
+}
+
+func runKRL(args []string) int {
+	var caOpt, commentOpt string
+	var versionOpt uint64
+	var updateOpt, listOpt bool
+	flags := flag.NewFlagSet("krl", flag.ContinueOnError)
+	flags.Usage = printKRLUsage
+	flags.StringVar(&caOpt, "ca", "", "")
+	flags.StringVar(&commentOpt, "comment", "", "")
+	flags.Uint64Var(&versionOpt, "version", 0, "")
+	flags.BoolVar(&updateOpt, "u", false, "")
+	flags.BoolVar(&listOpt, "l", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if listOpt {
+		if flags.NArg() != 1 {
+			printKRLUsage()
+			return 1
+		}
+		krl, err := loadKRL(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		writeKRLSpec(os.Stdout, krl)
+		return 0
+	}
+	if flags.NArg() < 2 { //nolint: gomnd // krl and spec file
+		printKRLUsage()
+		return 1
+	}
+
+	krl := &sshkeys.KRL{}
+	if updateOpt {
+		var err error
+		if krl, err = loadKRL(flags.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	var ca ssh.PublicKey
+	if caOpt != "" {
+		buf, err := os.ReadFile(caOpt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read ca: %s\n", err)
+			return 1
+		}
+		if ca, _, _, _, err = ssh.ParseAuthorizedKey(buf); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to parse ca: %s\n", err)
+			return 1
+		}
+	}
+	for _, file := range flags.Args()[1:] {
+		if err := readKRLSpecFile(krl, ca, file); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	krl.GeneratedDate = time.Now()
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "comment":
+			krl.Comment = commentOpt
+		case "version":
+			krl.Version = versionOpt
+		}
+	})
+	if err := os.WriteFile(flags.Arg(0), krl.Marshal(), 0o644); err != nil { //nolint: gosec,gomnd // public file
+		fmt.Fprintf(os.Stderr, "unable to write krl: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func loadKRL(file string) (*sshkeys.KRL, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read krl: %w", err)
+	}
+	krl, err := sshkeys.ParseKRL(buf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse krl: %w", err)
+	}
+	return krl, nil
+}
+
+func readKRLSpecFile(krl *sshkeys.KRL, ca ssh.PublicKey, file string) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("unable to open spec: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := addKRLSpec(krl, ca, line); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// addKRLSpec adds a line of the ssh-keygen KRL specification to krl.
+func addKRLSpec(krl *sshkeys.KRL, ca ssh.PublicKey, line string) error {
+	directive, value, found := strings.Cut(line, ":")
+	if !found || strings.ContainsAny(directive, " \t") {
+		key, err := parseSpecKey(line)
+		if err != nil {
+			return err
+		}
+		krl.RevokeKey(key)
+		return nil
+	}
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(directive) {
+	case "serial":
+		minText, maxText, isRange := strings.Cut(value, "-")
+		min, err := strconv.ParseUint(strings.TrimSpace(minText), 0, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a serial", value)
+		}
+		max := min
+		if isRange {
+			if max, err = strconv.ParseUint(strings.TrimSpace(maxText), 0, 64); err != nil {
+				return fmt.Errorf("'%s' is not a serial range", value)
+			}
+		}
+		return krl.RevokeSerials(ca, min, max)
+	case "id":
+		krl.RevokeKeyID(ca, value)
+	case "key", "sha1", "sha256":
+		key, err := parseSpecKey(value)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(directive) {
+		case "sha1":
+			krl.RevokeSHA1(key)
+		case "sha256":
+			krl.RevokeSHA256(key)
+		default:
+			krl.RevokeKey(key)
+		}
+	case "hash":
+		return krl.RevokeFingerprintSHA256(value)
+	default:
+		return fmt.Errorf("unknown directive '%s'", directive)
+	}
+	return nil
+}
+
+func parseSpecKey(text string) (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key: %w", err)
+	}
+	return key, nil
+}
+
+// writeKRLSpec writes the revocations of krl in the spec format, sha1 hashes can not be expressed and are comments.
+func writeKRLSpec(w io.Writer, krl *sshkeys.KRL) {
+	fmt.Fprintf(w, "# version: %d\n", krl.Version)
+	if !krl.GeneratedDate.IsZero() {
+		fmt.Fprintf(w, "# generated: %s\n", krl.GeneratedDate.Format(time.RFC3339))
+	}
+	if krl.Comment != "" {
+		fmt.Fprintf(w, "# comment: %s\n", krl.Comment)
+	}
+	for _, key := range krl.Keys {
+		fmt.Fprintf(w, "key: %s", ssh.MarshalAuthorizedKey(key))
+	}
+	for _, hash := range krl.SHA1 {
+		fmt.Fprintf(w, "# sha1 hash: %s\n", hex.EncodeToString(hash))
+	}
+	for _, hash := range krl.SHA256 {
+		fmt.Fprintf(w, "hash: SHA256:%s\n", base64.RawStdEncoding.EncodeToString(hash))
+	}
+	for _, certs := range krl.Certificates {
+		if certs.CA != nil {
+			fmt.Fprintf(w, "# ca: %s", ssh.MarshalAuthorizedKey(certs.CA))
+		} else {
+			fmt.Fprintln(w, "# ca: any")
+		}
+		for _, serials := range certs.Serials {
+			if serials.Min == serials.Max {
+				fmt.Fprintf(w, "serial: %d\n", serials.Min)
+				continue
+			}
+			fmt.Fprintf(w, "serial: %d-%d\n", serials.Min, serials.Max)
+		}
+		for _, id := range certs.KeyIDs {
+			fmt.Fprintf(w, "id: %s\n", id)
+		}
+	}
+}
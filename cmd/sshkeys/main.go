@@ -2,19 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Eun/sshkeys"
-	"github.com/asaskevich/govalidator"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -23,6 +20,22 @@ var encodingOption string
 var outputOption string
 var timeoutOption string
 var concurrentOption int
+var parallelOption int
+var formatOption string
+var templateOption string
+var fileOption string
+var sshConfigOption string
+var nativeOption bool
+var userOption string
+var identityOption string
+var agentOption bool
+var authMethodsOption bool
+var verifyAlgorithmsOption bool
+var gexOption bool
+var krlOption string
+
+// sshConfig is set if hosts should be resolved with -ssh-config.
+var sshConfig *sshkeys.SSHConfig
 
 // generated by goreleaser.
 var version string
@@ -41,6 +54,12 @@ const (
 const (
 	outputConsole = 0
 	outputJSON    = 1
+	outputNDJSON  = 2
+	outputCSV     = 3
+	outputYAML    = 4
+	outputTable   = 5
+	// outputCertAuthority writes @cert-authority known_hosts lines for the CAs of the host certificates.
+	outputCertAuthority = 6
 )
 
 func setupFlags() {
@@ -54,10 +73,40 @@ func setupFlags() {
 	flag.StringVar(&timeoutOption, "t", "60s", "")
 	flag.IntVar(&concurrentOption, "concurrent", 4, "") //nolint: gomnd // allow constant
 	flag.IntVar(&concurrentOption, "c", 4, "")          //nolint: gomnd // allow constant
+	flag.IntVar(&parallelOption, "parallel", 1, "")
+	flag.IntVar(&parallelOption, "p", 1, "")
+	flag.StringVar(&formatOption, "format", "", "")
+	flag.StringVar(&templateOption, "template", "", "")
+	flag.StringVar(&fileOption, "file", "", "")
+	flag.StringVar(&fileOption, "f", "", "")
+	flag.StringVar(&sshConfigOption, "ssh-config", "", "")
+	flag.BoolVar(&nativeOption, "native", false, "")
+	flag.StringVar(&userOption, "user", "", "")
+	flag.StringVar(&userOption, "u", "", "")
+	flag.StringVar(&identityOption, "identity", "", "")
+	flag.StringVar(&identityOption, "i", "", "")
+	flag.BoolVar(&agentOption, "agent", false, "")
+	flag.BoolVar(&authMethodsOption, "auth-methods", false, "")
+	flag.BoolVar(&verifyAlgorithmsOption, "verify-algorithms", false, "")
+	flag.BoolVar(&gexOption, "gex", false, "")
+	flag.StringVar(&krlOption, "krl", "", "")
 }
 
 func printUsage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [options] <host>\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s [options] -f <file>\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s audit-known-hosts [options] [known_hosts]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s diff [options] <old.json> <new.json>\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s exporter [options]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s keyscan [-46cHv] [-f file] [-p port] [-T timeout] [-t type] [host | addrlist namelist]\n",
+		filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s krl [options] <krl file> <spec file>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s profiles [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s serve [options]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s sign -ca-key <file> [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s terrapin [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s update-known-hosts [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s verify -ca <file> [options] <host>...\n", filepath.Base(os.Args[0]))
 	fmt.Fprintln(os.Stderr, "Options:")
 	fmt.Fprintln(os.Stderr, "    -a authorized_keys")
 	fmt.Fprintln(os.Stderr, "    -algorithm=authorized_keys")
@@ -71,12 +120,66 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "    -o=console")
 	fmt.Fprintln(os.Stderr, "    -output=console")
-	fmt.Fprintln(os.Stderr, "       Output format, valid formats are: console, json")
+	fmt.Fprintln(os.Stderr, "       Output format, valid formats are: console, json, ndjson, csv, yaml, table, cert-authority")
+	fmt.Fprintln(os.Stderr, "       json writes a versioned report with all fingerprints, -algorithm and -encoding are ignored")
+	fmt.Fprintln(os.Stderr, "       ndjson writes one json object per host as soon as the host was scanned")
+	fmt.Fprintln(os.Stderr, "       csv, yaml and table write one row per host and algorithm")
+	fmt.Fprintln(os.Stderr, "       cert-authority groups the host certificates by CA and writes a known_hosts @cert-authority line")
+	fmt.Fprintln(os.Stderr, "       per CA, the host patterns are inferred from the hosts and the principals (e.g. *.example.com)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -format=")
+	fmt.Fprintln(os.Stderr, "       Go template that is executed for every key, e.g. '{{.Host}} {{.Type}} {{.FingerprintSHA256}}'")
+	fmt.Fprintln(os.Stderr, "       overrides -output")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -template=")
+	fmt.Fprintln(os.Stderr, "       File with a Go template that is executed once for all hosts ({{range .Hosts}}{{range .Keys}}...)")
+	fmt.Fprintln(os.Stderr, "       overrides -output and -format")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -f=")
+	fmt.Fprintln(os.Stderr, "    -file=")
+	fmt.Fprintln(os.Stderr, "       File with the hosts to scan (one target per line, # starts a comment), - reads from stdin")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -ssh-config=")
+	fmt.Fprintln(os.Stderr, "       Resolve hosts with a ssh_config file (e.g. ~/.ssh/config): HostName, Port and HostKeyAlias are used")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -native=false")
+	fmt.Fprintln(os.Stderr, "       Fetch the keys of advertised host key algorithms that are not supported by golang.org/x/crypto/ssh")
+	fmt.Fprintln(os.Stderr, "       (e.g. ssh-ed448, x509v3-*) with a minimal built-in key exchange")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -i=")
+	fmt.Fprintln(os.Stderr, "    -identity=")
+	fmt.Fprintln(os.Stderr, "       Private key file for the authenticated scan: after the authentication all host keys")
+	fmt.Fprintln(os.Stderr, "       the server announces with hostkeys-00@openssh.com are fetched and proven")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -agent")
+	fmt.Fprintln(os.Stderr, "       Use the keys of the ssh-agent (SSH_AUTH_SOCK) for the authenticated scan")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -u=")
+	fmt.Fprintln(os.Stderr, "    -user=")
+	fmt.Fprintln(os.Stderr, "       User for the authenticated scan and -auth-methods, defaults to the current user")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -auth-methods")
+	fmt.Fprintln(os.Stderr, "       Discover the authentication methods the server allows for -user and its banner,")
+	fmt.Fprintln(os.Stderr, "       no credentials are sent")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -verify-algorithms")
+	fmt.Fprintln(os.Stderr, "       Open one handshake per advertised kex, cipher and MAC algorithm and report which ones work")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -gex")
+	fmt.Fprintln(os.Stderr, "       Request Diffie-Hellman group exchange groups of different sizes and flag moduli")
+	fmt.Fprintln(os.Stderr, "       under 2048 bits and primes that are not safe primes")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -krl=")
+	fmt.Fprintln(os.Stderr, "       OpenSSH key revocation list (see sshkeys krl), keys and certificates it revokes are flagged")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "    -c=4")
 	fmt.Fprintln(os.Stderr, "    -concurrent=4")
 	fmt.Fprintln(os.Stderr, "       Concurrent workers")
 	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -p=1")
+	fmt.Fprintln(os.Stderr, "    -parallel=1")
+	fmt.Fprintln(os.Stderr, "       Hosts that are scanned at the same time")
+	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "    -t=60s")
 	fmt.Fprintln(os.Stderr, "    -timeout=60s")
 	fmt.Fprintln(os.Stderr, "       Connection timeout")
@@ -85,20 +188,61 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "sshkeys %s %s %s https://github.com/Eun/sshkeys", version, commit, date)
 }
 
+// subCommands maps the name of each sub command to its entry point.
+var subCommands = map[string]func(args []string) int{
+	"audit-known-hosts":  runAuditKnownHosts,
+	"diff":               runDiff,
+	"exporter":           runExporter,
+	"keyscan":            runKeyscan,
+	"krl":                runKRL,
+	"profiles":           runProfiles,
+	"serve":              runServe,
+	"sign":               runSign,
+	"terrapin":           runTerrapin,
+	"update-known-hosts": runUpdateKnownHosts,
+	"verify":             runVerify,
+}
+
 func main() {
 	os.Exit(run())
 }
 func run() int {
+	if len(os.Args) > 1 {
+		if subCommand, ok := subCommands[os.Args[1]]; ok {
+			return subCommand(os.Args[2:])
+		}
+	}
+
 	setupFlags()
 	flag.Usage = printUsage
 	flag.Parse()
 	args := flag.Args()
+	if fileOption != "" {
+		fileHosts, err := readHostsFile(fileOption)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		args = append(args, fileHosts...)
+	}
 	if len(args) == 0 {
 		printUsage()
 		return 1
 	}
 
-	host := strings.TrimSpace(args[0])
+	hosts := make([]string, 0, len(args))
+	for _, arg := range args {
+		hosts = append(hosts, strings.TrimSpace(arg))
+	}
+
+	if sshConfigOption != "" {
+		var err error
+		sshConfig, err = sshkeys.LoadSSHConfig(sshConfigOption)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load ssh config: %s\n", err)
+			return 1
+		}
+	}
 	algorithm := parseAlgorithm(&algorithmOption)
 
 	var encoding sshkeys.Encoding
@@ -116,90 +260,138 @@ func run() int {
 		return 1
 	}
 
-	internalHost := host
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
-	if !govalidator.IsDialString(host) {
-		if !govalidator.IsHost(host) {
-			return exitWithMessage(output, host, fmt.Sprintf("'%s' is not a valid hostname", host))
+	var writer resultWriter
+	if formatOption != "" || templateOption != "" {
+		writer, err = newTemplateWriter(formatOption, templateOption, len(hosts) > 1)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		internalHost = net.JoinHostPort(internalHost, "22")
+	} else {
+		writer = newResultWriter(output, algorithm, encoding, len(hosts) > 1)
 	}
-
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	keys, err := sshkeys.GetKeys(ctx, internalHost, concurrentOption, timeout, sshkeys.DefaultKeyAlgorithms()...)
-	cancel()
-	if err != nil {
-		return exitWithMessage(output, host, err.Error())
+	options := sshkeys.ScanOptions{
+		ConcurrentWorkers: concurrentOption,
+		Timeout:           timeout,
+		Algorithms:        sshkeys.DefaultKeyAlgorithms(),
+		Native:            nativeOption,
+		VerifyAlgorithms:  verifyAlgorithmsOption,
+		ProbeGEX:          gexOption,
 	}
-
-	printableKeys := make([]string, 0, len(keys))
-	for _, key := range keys {
-		printableKey, marshalErr := keyToString(key, algorithm, encoding)
-		if marshalErr != nil {
-			return exitWithMessage(output, host, marshalErr.Error())
+	if krlOption != "" {
+		if options.KRL, err = loadKRL(krlOption); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if userOption == "" {
+		userOption = defaultUser()
+	}
+	if authMethodsOption {
+		options.AuthMethodsUser = userOption
+	}
+	if identityOption != "" || agentOption {
+		signers, closeAgent, err := loadSigners(identityOption, agentOption)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		addToResult := true
-		for _, k := range printableKeys {
-			if k == printableKey {
-				addToResult = false
-				break
-			}
+		defer closeAgent()
+		options.Auth = &sshkeys.AuthOptions{
+			User:    userOption,
+			Signers: signers,
 		}
-		if !addToResult {
-			continue
+	}
+	exitCode := scanHosts(ctx, hosts, parallelOption, options, writer)
+	if err := writer.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return exitCode
+}
+
+// scanHosts scans parallel hosts at the same time and writes each result as soon as it is available.
+// It returns 1 if any host or algorithm failed.
+func scanHosts(ctx context.Context, hosts []string, parallel int, options sshkeys.ScanOptions, writer resultWriter) int {
+	var mu sync.Mutex
+	exitCode := 0
+	setExitCode := func(code int) {
+		mu.Lock()
+		if code > exitCode {
+			exitCode = code
 		}
-		printableKeys = append(printableKeys, printableKey)
+		mu.Unlock()
 	}
 
-	sort.Slice(printableKeys, func(i, j int) bool {
-		return printableKeys[i] < printableKeys[j]
+	forEachHost(ctx, hosts, parallel, func(ctx context.Context, _ int, host string) {
+		result := scanHost(ctx, host, options)
+		if result.Error != "" || len(result.Errors) > 0 {
+			setExitCode(1)
+		}
+		if err := writer.Write(result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			setExitCode(1)
+		}
 	})
+	return exitCode
+}
+
+// scanHost scans a single host, errors are reported in the result.
+func scanHost(ctx context.Context, host string, options sshkeys.ScanOptions) *sshkeys.HostResult {
+	target, err := sshkeys.ParseTarget(host)
+	if err != nil {
+		return sshkeys.NewFailedResult(host, "", err)
+	}
+	addr, alias, err := resolveHost(&target)
+	if err != nil {
+		return sshkeys.NewFailedResult(host, "", err)
+	}
+	result, _ := sshkeys.Scan(ctx, addr, options)
+	result.Host = host
+	result.HostKeyAlias = alias
+	result.Target = &target
+	return result
+}
 
-	return exitWithSuccess(output, host, printableKeys)
+// resolveHost returns the address to dial and the HostKeyAlias of target.
+// If -ssh-config was specified the HostName, Port and HostKeyAlias of the config are used,
+// a port in target takes precedence over the configured port.
+func resolveHost(target *sshkeys.Target) (address, alias string, err error) {
+	if sshConfig == nil {
+		return target.Address(), "", nil
+	}
+	hostConfig := sshConfig.Resolve(target.Host)
+	if !target.DefaultPort {
+		hostConfig.Port = target.Port
+	}
+	address, err = dialAddress(hostConfig.Address())
+	return address, hostConfig.HostKeyAlias, err
 }
 
-func exitWithSuccess(output int, host string, printableKeys []string) int {
-	switch output {
-	case outputJSON:
-		err := json.NewEncoder(os.Stdout).Encode(struct {
-			Host       string
-			Algorithm  string
-			Encoding   string
-			PublicKeys []string
-		}{
-			Host:       host,
-			Algorithm:  algorithmOption,
-			Encoding:   encodingOption,
-			PublicKeys: printableKeys,
-		})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "unable to encode json: %+v", err)
-		}
-	default:
-		for i := 0; i < len(printableKeys); i++ {
-			fmt.Println(printableKeys[i])
-		}
+// readHostsFile reads the hosts of file, - reads from stdin.
+func readHostsFile(file string) ([]string, error) {
+	if file == "-" {
+		return sshkeys.ReadTargets(os.Stdin)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open hosts file: %w", err)
 	}
-	return 0
+	defer f.Close()
+	return sshkeys.ReadTargets(f)
 }
 
-func exitWithMessage(output int, host, s string) int {
-	switch output {
-	case outputJSON:
-		err := json.NewEncoder(os.Stdout).Encode(struct {
-			Host  string
-			Error string
-		}{
-			Host:  host,
-			Error: s,
-		})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "unable to encode json: %+v", err)
-		}
-	default:
-		fmt.Fprintln(os.Stderr, s)
+// dialAddress returns the host:port address for host, port 22 is used if host has no port.
+// The user and path of user@host, scp like and ssh:// targets are ignored.
+func dialAddress(host string) (string, error) {
+	target, err := sshkeys.ParseTarget(host)
+	if err != nil {
+		return "", err
 	}
-	return 1
+	return target.Address(), nil
 }
 
 func keyToString(key ssh.PublicKey, algorithm fingerPrintAlgo, encoding sshkeys.Encoding) (string, error) {
@@ -253,6 +445,16 @@ func parseOutput(output string) int {
 	switch strings.ToLower(strings.TrimSpace(output)) {
 	case "json":
 		return outputJSON
+	case "ndjson":
+		return outputNDJSON
+	case "csv":
+		return outputCSV
+	case "yaml":
+		return outputYAML
+	case "table":
+		return outputTable
+	case "cert-authority":
+		return outputCertAuthority
 	// case "console":
 	//	fallthrough
 	default:
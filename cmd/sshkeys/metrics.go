@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// metricsWriter writes metrics in the prometheus text exposition format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+// header writes the HELP and TYPE lines of a metric.
+func (m *metricsWriter) header(name, metricType, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(m.w, "# TYPE %s %s\n", name, metricType)
+}
+
+// sample writes a single sample, labels are passed as name, value pairs.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 1 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i])
+			sb.WriteString(`="`)
+			sb.WriteString(escapeLabelValue(labels[i+1]))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	sb.WriteByte('\n')
+	_, _ = io.WriteString(m.w, sb.String())
+}
+
+// gauge writes a metric that consists of a single sample.
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	m.header(name, "gauge", help)
+	m.sample(name, value, labels...)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// resultWriter writes the results of the scanned hosts.
+// Write is called as soon as a host was scanned, Close after all hosts were scanned.
+type resultWriter interface {
+	Write(result *sshkeys.HostResult) error
+	Close() error
+}
+
+func newResultWriter(output int, algorithm fingerPrintAlgo, encoding sshkeys.Encoding, multipleHosts bool) resultWriter {
+	switch output {
+	case outputJSON:
+		return &jsonWriter{w: os.Stdout}
+	case outputNDJSON:
+		return &ndjsonWriter{enc: sshkeys.NewNDJSONEncoder(os.Stdout)}
+	case outputCSV:
+		return &rowWriter{w: os.Stdout, format: writeCSVRows, stream: true, algorithm: algorithm, encoding: encoding}
+	case outputYAML:
+		return &rowWriter{w: os.Stdout, format: writeYAMLRows, algorithm: algorithm, encoding: encoding}
+	case outputTable:
+		return &rowWriter{w: os.Stdout, format: writeTableRows, algorithm: algorithm, encoding: encoding}
+	case outputCertAuthority:
+		return &certAuthorityWriter{w: os.Stdout, errW: os.Stderr}
+	default:
+		return &consoleWriter{
+			w:          os.Stdout,
+			errW:       os.Stderr,
+			algorithm:  algorithm,
+			encoding:   encoding,
+			prefixHost: multipleHosts,
+		}
+	}
+}
+
+// consoleWriter prints the keys in the format selected by -algorithm and -encoding.
+// Failed hosts and algorithms are printed to stderr.
+type consoleWriter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	errW       io.Writer
+	algorithm  fingerPrintAlgo
+	encoding   sshkeys.Encoding
+	prefixHost bool
+	// postQuantum is printed on Close in multi-host runs.
+	postQuantum sshkeys.PostQuantumSummary
+}
+
+func (c *consoleWriter) Write(result *sshkeys.HostResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := ""
+	if c.prefixHost {
+		prefix = result.Host + " "
+	}
+	c.postQuantum.Add(result)
+	if result.Target != nil && result.Target.Stripped() {
+		fmt.Fprintln(c.errW, "# "+result.Target.Description())
+	}
+	if result.Error != "" {
+		fmt.Fprintln(c.errW, prefix+result.Error)
+		return nil
+	}
+
+	printableKeys := make([]string, 0, len(result.Keys))
+	for i := range result.Keys {
+		key, err := result.Keys[i].PublicKey()
+		if err != nil {
+			return err
+		}
+		printableKey, err := keyToString(key, c.algorithm, c.encoding)
+		if err != nil {
+			return err
+		}
+		addToResult := true
+		for _, k := range printableKeys {
+			if k == printableKey {
+				addToResult = false
+				break
+			}
+		}
+		if !addToResult {
+			continue
+		}
+		printableKeys = append(printableKeys, printableKey)
+	}
+
+	sort.Slice(printableKeys, func(i, j int) bool {
+		return printableKeys[i] < printableKeys[j]
+	})
+
+	for i := 0; i < len(printableKeys); i++ {
+		fmt.Fprintln(c.w, prefix+printableKeys[i])
+	}
+	for i := range result.Keys {
+		if result.Keys[i].Revoked != "" {
+			fmt.Fprintf(c.errW, "# %srevoked: %s SHA256:%s: %s\n",
+				prefix, result.Keys[i].Type, result.Keys[i].Fingerprints.SHA256.Base64, result.Keys[i].Revoked)
+		}
+	}
+	if result.HASSHServer != "" {
+		fmt.Fprintf(c.errW, "# %shasshServer: %s\n", prefix, result.HASSHServer)
+		fmt.Fprintf(c.errW, "# %shasshServerAlgorithms: %s\n", prefix, result.HASSHServerAlgorithms)
+	}
+
+	for _, algo := range errorAlgorithms(result.Errors) {
+		fmt.Fprintf(c.errW, "%s%s: %s\n", prefix, algo, result.Errors[algo])
+	}
+	if result.AuthMethods != nil {
+		writeAuthMethods(c.errW, prefix, result.AuthMethods)
+	}
+	if result.VerifiedAlgorithms != nil {
+		writeVerifiedAlgorithms(c.errW, prefix, result.VerifiedAlgorithms)
+	}
+	if result.GEX != nil {
+		writeGEX(c.errW, prefix, result.GEX)
+	}
+	return nil
+}
+
+// errorAlgorithms returns the algorithms of errs sorted, so the errors of a host are always printed in the same order.
+func errorAlgorithms(errs map[string]string) []string {
+	algorithms := make([]string, 0, len(errs))
+	for algo := range errs {
+		algorithms = append(algorithms, algo)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// writeAuthMethods writes the authentication methods and the banner as comments.
+func writeAuthMethods(w io.Writer, prefix string, authMethods *sshkeys.AuthMethods) {
+	methods := strings.Join(authMethods.Methods, ",")
+	if authMethods.NoneAccepted {
+		methods = "none (no authentication required)"
+	}
+	fmt.Fprintf(w, "# %sauth methods for %s: %s\n", prefix, authMethods.User, methods)
+	if authMethods.AcceptsPasswords() {
+		fmt.Fprintf(w, "# %saccepts passwords\n", prefix)
+	}
+	for _, line := range strings.Split(strings.TrimRight(authMethods.Banner, "\r\n"), "\n") {
+		if line != "" {
+			fmt.Fprintf(w, "# %sbanner: %s\n", prefix, strings.TrimRight(line, "\r"))
+		}
+	}
+}
+
+// writeVerifiedAlgorithms writes the working algorithms of each list and the advertised algorithms that failed as comments.
+func writeVerifiedAlgorithms(w io.Writer, prefix string, verified *sshkeys.VerifiedAlgorithms) {
+	for _, list := range []struct {
+		name   string
+		checks []sshkeys.AlgorithmCheck
+	}{
+		{"kex", verified.KexAlgorithms},
+		{"cipher", verified.Ciphers},
+		{"mac", verified.MACs},
+	} {
+		var working []string
+		for _, check := range list.checks {
+			if check.Status == sshkeys.AlgorithmWorking {
+				working = append(working, check.Name)
+			}
+		}
+		fmt.Fprintf(w, "# %s%s: %d of %d advertised working: %s\n",
+			prefix, list.name, len(working), len(list.checks), strings.Join(working, ","))
+		for _, check := range list.checks {
+			if check.Status != sshkeys.AlgorithmWorking {
+				fmt.Fprintf(w, "# %s%s %s %s: %s\n", prefix, list.name, check.Name, check.Status, check.Error)
+			}
+		}
+	}
+}
+
+// writeGEX writes the groups of the group exchange as comments, weak groups are marked.
+func writeGEX(w io.Writer, prefix string, gex *sshkeys.GEXResult) {
+	for _, group := range gex.Groups {
+		if group.Error != "" {
+			fmt.Fprintf(w, "# %s%s %s: %s\n", prefix, gex.Kex, group.Request, group.Error)
+			continue
+		}
+		safe := "safe prime"
+		if !group.SafePrime {
+			safe = "not a safe prime"
+		}
+		weak := ""
+		if group.Weak {
+			weak = ", weak"
+		}
+		fmt.Fprintf(w, "# %s%s %s: %d bits, %s%s\n", prefix, gex.Kex, group.Request, group.Bits, safe, weak)
+	}
+}
+
+func (c *consoleWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.prefixHost && c.postQuantum.Hosts > 0 {
+		fmt.Fprintf(c.errW, "# post-quantum kex: %d of %d hosts (%.1f%%)\n",
+			c.postQuantum.Ready, c.postQuantum.Hosts, c.postQuantum.Percent)
+	}
+	return nil
+}
+
+// jsonWriter collects all results and writes them as a single report.
+type jsonWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	results []sshkeys.HostResult
+}
+
+func (j *jsonWriter) Write(result *sshkeys.HostResult) error {
+	j.mu.Lock()
+	j.results = append(j.results, *result)
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := json.NewEncoder(j.w).Encode(sshkeys.NewReport(j.results...)); err != nil {
+		return fmt.Errorf("unable to encode json: %w", err)
+	}
+	return nil
+}
+
+// ndjsonWriter writes one line per host as soon as the host was scanned.
+type ndjsonWriter struct {
+	enc *sshkeys.NDJSONEncoder
+}
+
+func (n *ndjsonWriter) Write(result *sshkeys.HostResult) error {
+	if err := n.enc.Encode(result); err != nil {
+		return fmt.Errorf("unable to encode json: %w", err)
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// resultRow is a single line of the tabular formats, there is one row per algorithm of a host.
+type resultRow struct {
+	Host        string `yaml:"host"`
+	Port        string `yaml:"port"`
+	Algorithm   string `yaml:"algorithm"`
+	Type        string `yaml:"type"`
+	Bits        int    `yaml:"bits"`
+	Fingerprint string `yaml:"fingerprint"`
+	Banner      string `yaml:"banner"`
+	Error       string `yaml:"error,omitempty"`
+}
+
+var resultRowHeader = []string{"host", "port", "algorithm", "type", "bits", "fingerprint", "banner", "error"}
+
+func (r *resultRow) fields() []string {
+	bits := ""
+	if r.Bits > 0 {
+		bits = strconv.Itoa(r.Bits)
+	}
+	return []string{r.Host, r.Port, r.Algorithm, r.Type, bits, r.Fingerprint, r.Banner, r.Error}
+}
+
+// resultRows flattens result into rows, sorted by algorithm.
+// Hosts that failed have a single row with the error, failed algorithms have their own row.
+// The fingerprint is formatted with -algorithm and -encoding, the sha256 fingerprint is used for authorized_keys.
+func resultRows(result *sshkeys.HostResult, algorithm fingerPrintAlgo, encoding sshkeys.Encoding) ([]resultRow, error) {
+	var port string
+	if result.Address != "" {
+		_, port, _ = net.SplitHostPort(result.Address)
+	}
+	if result.Error != "" {
+		return []resultRow{{Host: result.Host, Port: port, Banner: result.Banner, Error: result.Error}}, nil
+	}
+
+	var rows []resultRow
+	for i := range result.Keys {
+		key, err := result.Keys[i].PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		fingerprint, err := fingerprintString(key, algorithm, encoding)
+		if err != nil {
+			return nil, err
+		}
+		algorithms := result.Keys[i].Algorithms
+		if len(algorithms) == 0 {
+			// keys that were only announced are listed without algorithm
+			algorithms = []string{""}
+		}
+		for _, algo := range algorithms {
+			rows = append(rows, resultRow{
+				Host:        result.Host,
+				Port:        port,
+				Algorithm:   algo,
+				Type:        result.Keys[i].Type,
+				Bits:        result.Keys[i].Bits,
+				Fingerprint: fingerprint,
+				Banner:      result.Banner,
+			})
+		}
+	}
+	for _, algo := range errorAlgorithms(result.Errors) {
+		rows = append(rows, resultRow{
+			Host:      result.Host,
+			Port:      port,
+			Algorithm: algo,
+			Banner:    result.Banner,
+			Error:     result.Errors[algo],
+		})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Algorithm < rows[j].Algorithm
+	})
+	return rows, nil
+}
+
+// fingerprintString formats the fingerprint of key, for authorized_keys the sha256 fingerprint is used.
+func fingerprintString(key ssh.PublicKey, algorithm fingerPrintAlgo, encoding sshkeys.Encoding) (string, error) {
+	if algorithm == authorizedKeys {
+		return ssh.FingerprintSHA256(key), nil
+	}
+	return keyToString(key, algorithm, encoding)
+}
+
+// certAuthorityWriter collects all results and writes a known_hosts @cert-authority line per CA,
+// preceded by comments with the hosts and principals of the CA.
+// Failed hosts and hosts without host certificate are printed to stderr.
+type certAuthorityWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	errW    io.Writer
+	results []sshkeys.HostResult
+}
+
+func (c *certAuthorityWriter) Write(result *sshkeys.HostResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result.Error != "" {
+		fmt.Fprintln(c.errW, result.Host+" "+result.Error)
+		return nil
+	}
+	c.results = append(c.results, *result)
+	return nil
+}
+
+func (c *certAuthorityWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	groups := sshkeys.GroupCertAuthorities(c.results...)
+	for i := range c.results {
+		found := false
+		for j := range groups {
+			if containsHost(groups[j].Hosts, c.results[i].Host) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Fprintf(c.errW, "# %s: no host certificate\n", c.results[i].Host)
+		}
+	}
+	for i := range groups {
+		fmt.Fprintf(c.w, "# CA %s (%s) signed the host certificates of %d host(s): %s\n",
+			groups[i].CAFingerprintSHA256, groups[i].CAType, len(groups[i].Hosts), strings.Join(groups[i].Hosts, ", "))
+		if len(groups[i].Principals) > 0 {
+			fmt.Fprintf(c.w, "# principals: %s\n", strings.Join(groups[i].Principals, ", "))
+		}
+		fmt.Fprintln(c.w, groups[i].KnownHostsLine)
+	}
+	return nil
+}
+
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// rowWriter writes the results as rows in a tabular format.
+// Streaming formats are written per host, all other formats are written on Close.
+type rowWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	format    func(w io.Writer, rows []resultRow, header bool) error
+	stream    bool
+	algorithm fingerPrintAlgo
+	encoding  sshkeys.Encoding
+
+	headerWritten bool
+	rows          []resultRow
+}
+
+func (r *rowWriter) Write(result *sshkeys.HostResult) error {
+	rows, err := resultRows(result, r.algorithm, r.encoding)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stream {
+		r.rows = append(r.rows, rows...)
+		return nil
+	}
+	err = r.format(r.w, rows, !r.headerWritten)
+	r.headerWritten = true
+	return err
+}
+
+func (r *rowWriter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stream {
+		if r.headerWritten {
+			return nil
+		}
+		r.headerWritten = true
+	}
+	return r.format(r.w, r.rows, true)
+}
+
+func writeCSVRows(w io.Writer, rows []resultRow, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(resultRowHeader); err != nil {
+			return err
+		}
+	}
+	for i := range rows {
+		if err := cw.Write(rows[i].fields()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeYAMLRows(w io.Writer, rows []resultRow, _ bool) error {
+	if rows == nil {
+		rows = []resultRow{}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2) //nolint: gomnd // allow constant
+	if err := enc.Encode(rows); err != nil {
+		return fmt.Errorf("unable to encode yaml: %w", err)
+	}
+	return enc.Close()
+}
+
+func writeTableRows(w io.Writer, rows []resultRow, _ bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint: gomnd // padding
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(resultRowHeader, "\t")))
+	for i := range rows {
+		fmt.Fprintln(tw, strings.Join(rows[i].fields(), "\t"))
+	}
+	return tw.Flush()
+}
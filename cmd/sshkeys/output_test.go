@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"os"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestRowWriter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		output    int
+		algorithm fingerPrintAlgo
+		stdout    string
+	}{
+		{
+			name:      "csv",
+			output:    outputCSV,
+			algorithm: fingerprintSHA256,
+			stdout: `host,port,algorithm,type,bits,fingerprint,banner,error
+a.example.com,22,ecdsa-sha2-nistp256,,,,SSH-2.0-OpenSSH_9.6,handshake failed
+a.example.com,22,rsa-sha2-512,,,,SSH-2.0-OpenSSH_9.6,i/o timeout
+a.example.com,22,sk-ssh-ed25519@openssh.com,ssh-ed25519,256,4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4,SSH-2.0-OpenSSH_9.6,
+a.example.com,22,ssh-ed25519,ssh-ed25519,256,fe85JkIjo8VPe+XqXJGH5Mau1EMFdK1OdKvJUFicyA8,SSH-2.0-OpenSSH_9.6,
+a.example.com,22,ssh-rsa,,,,SSH-2.0-OpenSSH_9.6,connection reset by peer
+b.example.com,2222,ssh-ed25519,ssh-ed25519,256,4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4,SSH-2.0-OpenSSH_9.6,
+c.example.com,22,,,,,,i/o timeout
+`,
+		},
+		{
+			name:      "csv with authorized_keys uses sha256 fingerprints",
+			output:    outputCSV,
+			algorithm: authorizedKeys,
+			stdout: `host,port,algorithm,type,bits,fingerprint,banner,error
+a.example.com,22,ecdsa-sha2-nistp256,,,,SSH-2.0-OpenSSH_9.6,handshake failed
+a.example.com,22,rsa-sha2-512,,,,SSH-2.0-OpenSSH_9.6,i/o timeout
+a.example.com,22,sk-ssh-ed25519@openssh.com,ssh-ed25519,256,SHA256:4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4,SSH-2.0-OpenSSH_9.6,
+a.example.com,22,ssh-ed25519,ssh-ed25519,256,SHA256:fe85JkIjo8VPe+XqXJGH5Mau1EMFdK1OdKvJUFicyA8,SSH-2.0-OpenSSH_9.6,
+a.example.com,22,ssh-rsa,,,,SSH-2.0-OpenSSH_9.6,connection reset by peer
+b.example.com,2222,ssh-ed25519,ssh-ed25519,256,SHA256:4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4,SSH-2.0-OpenSSH_9.6,
+c.example.com,22,,,,,,i/o timeout
+`,
+		},
+		{
+			name:      "yaml",
+			output:    outputYAML,
+			algorithm: fingerprintMD5,
+			stdout: `- host: a.example.com
+  port: "22"
+  algorithm: ecdsa-sha2-nistp256
+  type: ""
+  bits: 0
+  fingerprint: ""
+  banner: SSH-2.0-OpenSSH_9.6
+  error: handshake failed
+- host: a.example.com
+  port: "22"
+  algorithm: rsa-sha2-512
+  type: ""
+  bits: 0
+  fingerprint: ""
+  banner: SSH-2.0-OpenSSH_9.6
+  error: i/o timeout
+- host: a.example.com
+  port: "22"
+  algorithm: sk-ssh-ed25519@openssh.com
+  type: ssh-ed25519
+  bits: 256
+  fingerprint: drqHNoaiVr/KO7XIKGw5fg
+  banner: SSH-2.0-OpenSSH_9.6
+- host: a.example.com
+  port: "22"
+  algorithm: ssh-ed25519
+  type: ssh-ed25519
+  bits: 256
+  fingerprint: q/HacPsdeCoax2lzPEMHTw
+  banner: SSH-2.0-OpenSSH_9.6
+- host: a.example.com
+  port: "22"
+  algorithm: ssh-rsa
+  type: ""
+  bits: 0
+  fingerprint: ""
+  banner: SSH-2.0-OpenSSH_9.6
+  error: connection reset by peer
+- host: b.example.com
+  port: "2222"
+  algorithm: ssh-ed25519
+  type: ssh-ed25519
+  bits: 256
+  fingerprint: drqHNoaiVr/KO7XIKGw5fg
+  banner: SSH-2.0-OpenSSH_9.6
+- host: c.example.com
+  port: "22"
+  algorithm: ""
+  type: ""
+  bits: 0
+  fingerprint: ""
+  banner: ""
+  error: i/o timeout
+`,
+		},
+		{
+			name:      "table",
+			output:    outputTable,
+			algorithm: fingerprintSHA256,
+			stdout: "HOST           PORT  ALGORITHM                   TYPE         BITS  FINGERPRINT                                  BANNER               ERROR\n" +
+				"a.example.com  22    ecdsa-sha2-nistp256                                                                         SSH-2.0-OpenSSH_9.6  handshake failed\n" +
+				"a.example.com  22    rsa-sha2-512                                                                                SSH-2.0-OpenSSH_9.6  i/o timeout\n" +
+				"a.example.com  22    sk-ssh-ed25519@openssh.com  ssh-ed25519  256   4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4  SSH-2.0-OpenSSH_9.6  \n" +
+				"a.example.com  22    ssh-ed25519                 ssh-ed25519  256   fe85JkIjo8VPe+XqXJGH5Mau1EMFdK1OdKvJUFicyA8  SSH-2.0-OpenSSH_9.6  \n" +
+				"a.example.com  22    ssh-rsa                                                                                     SSH-2.0-OpenSSH_9.6  connection reset by peer\n" +
+				"b.example.com  2222  ssh-ed25519                 ssh-ed25519  256   4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4  SSH-2.0-OpenSSH_9.6  \n" +
+				"c.example.com  22                                                                                                                     i/o timeout\n",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var stdout bytes.Buffer
+			writer, ok := newResultWriter(test.output, test.algorithm, sshkeys.Base64Encoding, true).(*rowWriter)
+			require.True(t, ok)
+			writer.w = &stdout
+			out, _ := writeTestResults(t, writer, &stdout, &bytes.Buffer{}, testResults(t)...)
+			require.Equal(t, test.stdout, out)
+		})
+	}
+}
+
+func TestRowWriterWithoutResults(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		output int
+		stdout string
+	}{
+		{output: outputCSV, stdout: "host,port,algorithm,type,bits,fingerprint,banner,error\n"},
+		{output: outputYAML, stdout: "[]\n"},
+		{output: outputTable, stdout: "HOST  PORT  ALGORITHM  TYPE  BITS  FINGERPRINT  BANNER  ERROR\n"},
+	}
+	for _, test := range tests {
+		var stdout bytes.Buffer
+		writer, ok := newResultWriter(test.output, fingerprintSHA256, sshkeys.Base64Encoding, false).(*rowWriter)
+		require.True(t, ok)
+		writer.w = &stdout
+		out, _ := writeTestResults(t, writer, &stdout, &bytes.Buffer{})
+		require.Equal(t, test.stdout, out)
+	}
+}
+
+// newTestHostCert returns a host certificate of key for principals that is signed by ca,
+// the certificate is always the same as ed25519 signatures are deterministic.
+func newTestHostCert(t *testing.T, ca xssh.Signer, key xssh.PublicKey, principals ...string) *xssh.Certificate {
+	t.Helper()
+	cert := &xssh.Certificate{
+		Key:             key,
+		CertType:        xssh.HostCert,
+		KeyId:           principals[0],
+		ValidPrincipals: principals,
+		ValidBefore:     xssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(bytes.NewReader(make([]byte, 32)), ca))
+	return cert
+}
+
+func TestCertAuthorityWriter(t *testing.T) {
+	t.Parallel()
+	ca, err := xssh.NewSignerFromKey(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{3}, ed25519.SeedSize)))
+	require.NoError(t, err)
+	key1 := newTestKey(t, 1)
+	key2 := newTestKey(t, 2)
+
+	results := []*sshkeys.HostResult{
+		newTestResult(t, "a.example.com", "a.example.com:22", map[string]xssh.PublicKey{
+			xssh.KeyAlgoED25519:     key1,
+			xssh.CertAlgoED25519v01: newTestHostCert(t, ca, key1, "a.example.com", "a"),
+		}, nil),
+		newTestResult(t, "b.example.com", "b.example.com:2222", map[string]xssh.PublicKey{
+			xssh.CertAlgoED25519v01: newTestHostCert(t, ca, key2, "b.example.com"),
+		}, nil),
+		newTestResult(t, "d.example.com", "d.example.com:22", map[string]xssh.PublicKey{
+			xssh.KeyAlgoED25519: key2,
+		}, nil),
+		sshkeys.NewFailedResult("c.example.com", "c.example.com:22", os.ErrDeadlineExceeded),
+	}
+	var stdout, stderr bytes.Buffer
+	writer, ok := newResultWriter(outputCertAuthority, authorizedKeys, sshkeys.Base64Encoding, true).(*certAuthorityWriter)
+	require.True(t, ok)
+	writer.w = &stdout
+	writer.errW = &stderr
+	out, errOut := writeTestResults(t, writer, &stdout, &stderr, results...)
+	require.Equal(t, `# CA SHA256:zbv/nU7iZdO0fB0DalMI70dP6/yFD8sctXvvW4+OokY (ssh-ed25519) signed the host certificates of 2 host(s): a.example.com, b.example.com
+# principals: a, a.example.com, b.example.com
+@cert-authority *.example.com,[*.example.com]:2222,a ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIO1JKMYo0cLG6ukDOJBZlWEpWSc6XGP5NjbBRhSshzfR
+`, out)
+	require.Equal(t, "c.example.com i/o timeout\n# d.example.com: no host certificate\n", errOut)
+}
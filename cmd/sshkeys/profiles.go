@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	profilesExitCompatible   = 0
+	profilesExitIncompatible = 1
+	profilesExitTrouble      = 2
+)
+
+// profilesHost is the json representation of the client profile checks of a single host.
+type profilesHost struct {
+	Host     string                  `json:"host"`
+	Address  string                  `json:"address,omitempty"`
+	Profiles []sshkeys.ProfileResult `json:"profiles,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+type profilesConfig struct {
+	Profiles []sshkeys.ClientProfile `yaml:"profiles"`
+}
+
+func printProfilesUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s profiles [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Runs the handshake as different ssh clients and reports the negotiated algorithms")
+	fmt.Fprintln(os.Stderr, "or why the negotiation fails.")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if all profiles can connect, 1 if a profile can not connect and 2 on errors.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -profiles=")
+	fmt.Fprintln(os.Stderr, "       Comma separated profiles to run, all profiles are run if empty, predefined profiles are: "+
+		strings.Join(profileNames(sshkeys.ClientProfiles), ", "))
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -config=")
+	fmt.Fprintln(os.Stderr, "       YAML file with custom profiles, a profile with the name of a predefined profile replaces it")
+	fmt.Fprintln(os.Stderr)
+	printHostFlagsUsage("f", "file")
+}
+
+func profileNames(profiles []sshkeys.ClientProfile) []string {
+	names := make([]string, len(profiles))
+	for i := range profiles {
+		names[i] = profiles[i].Name
+	}
+	return names
+}
+
+// loadProfiles returns the predefined profiles and the profiles of the config file, filtered by names.
+func loadProfiles(configFile, names string) ([]sshkeys.ClientProfile, error) {
+	profiles := append([]sshkeys.ClientProfile(nil), sshkeys.ClientProfiles...)
+	if configFile != "" {
+		buf, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config: %w", err)
+		}
+		var config profilesConfig
+		if err := yaml.Unmarshal(buf, &config); err != nil {
+			return nil, fmt.Errorf("unable to decode config: %w", err)
+		}
+	next:
+		for _, profile := range config.Profiles {
+			if err := profile.Validate(); err != nil {
+				return nil, err
+			}
+			for i := range profiles {
+				if profiles[i].Name == profile.Name {
+					profiles[i] = profile
+					continue next
+				}
+			}
+			profiles = append(profiles, profile)
+		}
+	}
+	if names == "" {
+		return profiles, nil
+	}
+
+	var selected []sshkeys.ClientProfile
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for i := range profiles {
+			if profiles[i].Name == name {
+				selected = append(selected, profiles[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown profile '%s'", name)
+		}
+	}
+	return selected, nil
+}
+
+func runProfiles(args []string) int {
+	var profilesOpt, configOpt string
+	var hostOpts hostFlags
+	flags := flag.NewFlagSet("profiles", flag.ContinueOnError)
+	flags.Usage = printProfilesUsage
+	flags.StringVar(&profilesOpt, "profiles", "", "")
+	flags.StringVar(&configOpt, "config", "", "")
+	hostOpts.register(flags, "file", "f")
+	if err := flags.Parse(args); err != nil {
+		return profilesExitTrouble
+	}
+	hosts, err := hostOpts.hosts(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return profilesExitTrouble
+	}
+	if len(hosts) == 0 {
+		printProfilesUsage()
+		return profilesExitTrouble
+	}
+	output, timeout, err := hostOpts.parse("profiles")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return profilesExitTrouble
+	}
+	profiles, err := loadProfiles(configOpt, profilesOpt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return profilesExitTrouble
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	results := make([]profilesHost, len(hosts))
+	forEachHost(ctx, hosts, hostOpts.parallel, func(ctx context.Context, i int, host string) {
+		results[i] = checkProfiles(ctx, host, profiles, timeout)
+	})
+
+	exitCode := profilesExitCompatible
+	for i := range results {
+		if results[i].Error != "" {
+			exitCode = profilesExitTrouble
+			continue
+		}
+		for j := range results[i].Profiles {
+			if !results[i].Profiles[j].OK() && exitCode == profilesExitCompatible {
+				exitCode = profilesExitIncompatible
+			}
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			SchemaVersion int            `json:"schema_version"`
+			Hosts         []profilesHost `json:"hosts"`
+		}{sshkeys.SchemaVersion, results}); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %s\n", err)
+			return profilesExitTrouble
+		}
+		return exitCode
+	}
+	printProfilesHosts(results)
+	return exitCode
+}
+
+func checkProfiles(ctx context.Context, host string, profiles []sshkeys.ClientProfile, timeout time.Duration) profilesHost {
+	result := profilesHost{Host: host}
+	addr, err := dialAddress(host)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Address = addr
+	for i := range profiles {
+		profileCtx, cancel := context.WithTimeout(ctx, timeout)
+		profileResult, err := sshkeys.CheckClientProfile(profileCtx, addr, &profiles[i])
+		cancel()
+		if err != nil {
+			result.Error = err.Error()
+			result.Profiles = nil
+			return result
+		}
+		result.Profiles = append(result.Profiles, *profileResult)
+	}
+	return result
+}
+
+func printProfilesHosts(results []profilesHost) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint: gomnd // padding
+	fmt.Fprintln(tw, "HOST\tPROFILE\tRESULT\tKEX\tHOST KEY\tCIPHER\tMAC")
+	for i := range results {
+		if results[i].Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", results[i].Host, results[i].Error)
+			continue
+		}
+		for _, profile := range results[i].Profiles {
+			if !profile.OK() {
+				fmt.Fprintf(tw, "%s\t%s\tfailed\t%s\n", results[i].Host, profile.Profile, profile.Error)
+				continue
+			}
+			n := profile.Negotiated
+			mac := n.MACClientServer
+			if mac == "" {
+				mac = "implicit"
+			}
+			fmt.Fprintf(tw, "%s\t%s\tok\t%s\t%s\t%s\t%s\n", results[i].Host, profile.Profile, n.Kex, n.HostKey, n.CipherClientServer, mac)
+		}
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/google/uuid"
+)
+
+const (
+	jobStatusPending = "pending"
+	jobStatusRunning = "running"
+	jobStatusDone    = "done"
+)
+
+var errTargetNotAllowed = errors.New("target is not in the allowed networks")
+
+var errTooManyJobs = errors.New("too many scan jobs, try again later")
+
+type scanJob struct {
+	ID       string
+	Status   string
+	Total    int
+	Done     int
+	Created  time.Time
+	Finished *time.Time `json:",omitempty"`
+
+	hosts   []string
+	results []sshkeys.HostResult
+	// scanned reports which of the results are set, results are stored at the index of their host.
+	scanned []bool
+}
+
+type apiServer struct {
+	// ctx is the context of the server, scan jobs are canceled when it is done.
+	ctx        context.Context //nolint: containedctx // jobs outlive their request
+	allowed    []*net.IPNet
+	concurrent int
+	timeout    time.Duration
+	maxTargets int
+	maxJobs    int
+	jobTTL     time.Duration
+	// scanSlots limits the number of hosts that are scanned at the same time over all jobs.
+	scanSlots chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*scanJob
+}
+
+func printServeUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s serve [options]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Runs a http json api:")
+	fmt.Fprintln(os.Stderr, "    GET  /keys?host=<host>       scan a host and return its keys")
+	fmt.Fprintln(os.Stderr, "    POST /scans                  submit a scan job, body: {\"Hosts\": [\"<host>\", ...]}")
+	fmt.Fprintln(os.Stderr, "    GET  /scans/<id>             get the status of a scan job")
+	fmt.Fprintln(os.Stderr, "    GET  /scans/<id>/results     get the results of a scan job")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -l=:8080")
+	fmt.Fprintln(os.Stderr, "    -listen=:8080")
+	fmt.Fprintln(os.Stderr, "       Address to listen on")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -allow=")
+	fmt.Fprintln(os.Stderr, "       Comma separated list of networks (CIDR) that may be scanned, required")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -c=4")
+	fmt.Fprintln(os.Stderr, "    -concurrent=4")
+	fmt.Fprintln(os.Stderr, "       Concurrent workers per host")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -parallel=8")
+	fmt.Fprintln(os.Stderr, "       Hosts that are scanned at the same time")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -t=60s")
+	fmt.Fprintln(os.Stderr, "    -timeout=60s")
+	fmt.Fprintln(os.Stderr, "       Connection timeout")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -max-targets=1000")
+	fmt.Fprintln(os.Stderr, "       Maximum number of hosts per scan job")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -max-jobs=100")
+	fmt.Fprintln(os.Stderr, "       Maximum number of scan jobs that are kept, new jobs are rejected until old jobs expire")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -job-ttl=1h")
+	fmt.Fprintln(os.Stderr, "       How long finished scan jobs are kept")
+	fmt.Fprintln(os.Stderr)
+}
+
+func runServe(args []string) int {
+	var listenOpt string
+	var allowOpt string
+	var parallelOpt int
+	var timeoutOpt string
+	var jobTTLOpt string
+	s := apiServer{
+		jobs: make(map[string]*scanJob),
+	}
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = printServeUsage
+	flags.StringVar(&listenOpt, "listen", ":8080", "")
+	flags.StringVar(&listenOpt, "l", ":8080", "")
+	flags.StringVar(&allowOpt, "allow", "", "")
+	flags.IntVar(&s.concurrent, "concurrent", 4, "") //nolint: gomnd // allow constant
+	flags.IntVar(&s.concurrent, "c", 4, "")          //nolint: gomnd // allow constant
+	flags.IntVar(&parallelOpt, "parallel", 8, "")    //nolint: gomnd // allow constant
+	flags.StringVar(&timeoutOpt, "timeout", "60s", "")
+	flags.StringVar(&timeoutOpt, "t", "60s", "")
+	flags.IntVar(&s.maxTargets, "max-targets", 1000, "") //nolint: gomnd // allow constant
+	flags.IntVar(&s.maxJobs, "max-jobs", 100, "")        //nolint: gomnd // allow constant
+	flags.StringVar(&jobTTLOpt, "job-ttl", "1h", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	var err error
+	s.allowed, err = parseNetworks(allowOpt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(s.allowed) == 0 {
+		fmt.Fprintln(os.Stderr, "-allow is required, use -allow=0.0.0.0/0,::/0 to allow all targets")
+		return 1
+	}
+	s.timeout, err = time.ParseDuration(timeoutOpt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "'%s' is not a duration\n", timeoutOpt)
+		return 1
+	}
+	s.jobTTL, err = time.ParseDuration(jobTTLOpt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "'%s' is not a duration\n", jobTTLOpt)
+		return 1
+	}
+	if parallelOpt < 1 {
+		parallelOpt = 1
+	}
+	s.scanSlots = make(chan struct{}, parallelOpt)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	s.ctx = ctx
+	return serveHTTP(ctx, listenOpt, s.handler())
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", s.keysHandler)
+	mux.HandleFunc("/scans", s.submitHandler)
+	mux.HandleFunc("/scans/", s.jobHandler)
+	return mux
+}
+
+func parseNetworks(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid network: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// resolveTarget resolves host and makes sure all its addresses are allowed.
+// The returned address contains the ip, so the host is not resolved again when dialing.
+func (s *apiServer) resolveTarget(ctx context.Context, host string) (string, error) {
+	addr, err := dialAddress(host)
+	if err != nil {
+		return "", err
+	}
+	hostname, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("'%s' has no addresses", hostname)
+	}
+	for _, ip := range ips {
+		if !s.isAllowed(ip.IP) {
+			return "", errTargetNotAllowed
+		}
+	}
+	return net.JoinHostPort(ips[0].IP.String(), port), nil
+}
+
+func (s *apiServer) isAllowed(ip net.IP) bool {
+	for _, network := range s.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan scans a single host, it waits for a free scan slot first, the host is resolved in the slot.
+// The returned error is also stored in the Error field of the result.
+func (s *apiServer) scan(ctx context.Context, host string) (*sshkeys.HostResult, error) {
+	select {
+	case <-ctx.Done():
+		return sshkeys.NewFailedResult(host, "", ctx.Err()), ctx.Err()
+	case s.scanSlots <- struct{}{}:
+	}
+	defer func() { <-s.scanSlots }()
+
+	addr, err := s.resolveTarget(ctx, host)
+	if err != nil {
+		return sshkeys.NewFailedResult(host, "", err), err
+	}
+
+	result, err := sshkeys.Scan(ctx, addr, sshkeys.ScanOptions{
+		ConcurrentWorkers: s.concurrent,
+		Timeout:           s.timeout,
+		Algorithms:        sshkeys.DefaultKeyAlgorithms(),
+	})
+	result.Host = host
+	return result, err
+}
+
+func (s *apiServer) keysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	host := strings.TrimSpace(r.URL.Query().Get("host"))
+	if host == "" {
+		writeAPIError(w, http.StatusBadRequest, "host parameter is missing")
+		return
+	}
+	if _, err := dialAddress(host); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := s.scan(r.Context(), host)
+	switch {
+	case errors.Is(err, errTargetNotAllowed):
+		writeAPIError(w, http.StatusForbidden, err.Error())
+	case err != nil:
+		writeAPIJSON(w, http.StatusBadGateway, sshkeys.NewReport(*result))
+	default:
+		writeAPIJSON(w, http.StatusOK, sshkeys.NewReport(*result))
+	}
+}
+
+func (s *apiServer) submitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		Hosts []string
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "unable to decode request: "+err.Error())
+		return
+	}
+	if len(req.Hosts) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no hosts specified")
+		return
+	}
+	if len(req.Hosts) > s.maxTargets {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("too many hosts, at most %d are allowed", s.maxTargets))
+		return
+	}
+	for i := range req.Hosts {
+		req.Hosts[i] = strings.TrimSpace(req.Hosts[i])
+		if _, err := dialAddress(req.Hosts[i]); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	job := &scanJob{
+		ID:      uuid.NewString(),
+		Status:  jobStatusPending,
+		Total:   len(req.Hosts),
+		Created: time.Now(),
+		hosts:   req.Hosts,
+		results: make([]sshkeys.HostResult, len(req.Hosts)),
+		scanned: make([]bool, len(req.Hosts)),
+	}
+	s.mu.Lock()
+	s.removeExpiredJobs()
+	if len(s.jobs) >= s.maxJobs {
+		s.mu.Unlock()
+		writeAPIError(w, http.StatusTooManyRequests, errTooManyJobs.Error())
+		return
+	}
+	s.jobs[job.ID] = job
+	status := *job
+	s.mu.Unlock()
+
+	go s.runJob(job)
+
+	w.Header().Set("Location", "/scans/"+job.ID)
+	writeAPIJSON(w, http.StatusAccepted, status)
+}
+
+func (s *apiServer) runJob(job *scanJob) {
+	s.mu.Lock()
+	job.Status = jobStatusRunning
+	s.mu.Unlock()
+
+	forEachHost(s.ctx, job.hosts, cap(s.scanSlots), func(ctx context.Context, i int, host string) {
+		result, _ := s.scan(ctx, host)
+		s.mu.Lock()
+		job.results[i] = *result
+		job.scanned[i] = true
+		job.Done++
+		s.mu.Unlock()
+	})
+
+	now := time.Now()
+	s.mu.Lock()
+	job.Status = jobStatusDone
+	job.Finished = &now
+	s.mu.Unlock()
+}
+
+// removeExpiredJobs removes finished jobs that are older than the job ttl, s.mu must be held.
+func (s *apiServer) removeExpiredJobs() {
+	for id, job := range s.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > s.jobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *apiServer) jobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/scans/"), "/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "results") { //nolint: gomnd // id and results
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	s.mu.Lock()
+	s.removeExpiredJobs()
+	job, ok := s.jobs[parts[0]]
+	if !ok {
+		s.mu.Unlock()
+		writeAPIError(w, http.StatusNotFound, "scan job not found")
+		return
+	}
+	status := *job
+	results := make([]sshkeys.HostResult, 0, job.Done)
+	for i := range job.results {
+		if job.scanned[i] {
+			results = append(results, job.results[i])
+		}
+	}
+	s.mu.Unlock()
+
+	if len(parts) == 1 {
+		writeAPIJSON(w, http.StatusOK, status)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, struct {
+		ID     string
+		Status string
+		Report *sshkeys.Report
+	}{
+		ID:     status.ID,
+		Status: status.Status,
+		Report: sshkeys.NewReport(results...),
+	})
+}
+
+func writeAPIJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to encode json: %+v\n", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, statusCode int, s string) {
+	writeAPIJSON(w, statusCode, struct {
+		Error string
+	}{
+		Error: s,
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func newTestAPIServer(t *testing.T, ctx context.Context, allow string) *apiServer {
+	t.Helper()
+	allowed, err := parseNetworks(allow)
+	require.NoError(t, err)
+	return &apiServer{
+		ctx:        ctx,
+		allowed:    allowed,
+		concurrent: 4,
+		timeout:    10 * time.Second,
+		maxTargets: 2,
+		maxJobs:    1,
+		jobTTL:     time.Hour,
+		scanSlots:  make(chan struct{}, 2),
+		jobs:       make(map[string]*scanJob),
+	}
+}
+
+func getAPI(t *testing.T, handler http.Handler, method, url, body string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	if v != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v), w.Body.String())
+	}
+	return w
+}
+
+func requireReportKey(t *testing.T, report *sshkeys.Report, key xssh.PublicKey) {
+	t.Helper()
+	require.Len(t, report.Hosts, 1)
+	require.Empty(t, report.Hosts[0].Error)
+	var fingerprints []string
+	for _, k := range report.Hosts[0].Keys {
+		fingerprints = append(fingerprints, "SHA256:"+k.Fingerprints.SHA256.Base64)
+	}
+	require.Contains(t, fingerprints, xssh.FingerprintSHA256(key))
+}
+
+func TestServeKeys(t *testing.T) {
+	t.Parallel()
+	edSigner, _ := newTestSigners(t)
+	host := net.JoinHostPort("127.0.0.1", startTestServer(t, edSigner))
+
+	handler := newTestAPIServer(t, context.Background(), "127.0.0.0/8").handler()
+	var report sshkeys.Report
+	w := getAPI(t, handler, http.MethodGet, "/keys?host="+host, "", &report)
+	require.Equal(t, http.StatusOK, w.Code)
+	requireReportKey(t, &report, edSigner.PublicKey())
+
+	w = getAPI(t, handler, http.MethodGet, "/keys", "", nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = getAPI(t, handler, http.MethodPost, "/keys?host="+host, "", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestServeAllowList(t *testing.T) {
+	t.Parallel()
+	edSigner, _ := newTestSigners(t)
+	host := net.JoinHostPort("127.0.0.1", startTestServer(t, edSigner))
+
+	handler := newTestAPIServer(t, context.Background(), "10.0.0.0/8").handler()
+	var apiErr struct{ Error string }
+	w := getAPI(t, handler, http.MethodGet, "/keys?host="+host, "", &apiErr)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, errTargetNotAllowed.Error(), apiErr.Error)
+
+	// hosts of jobs are checked when they are scanned
+	var job scanJob
+	w = getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["`+host+`"]}`, &job)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var results struct{ Report *sshkeys.Report }
+	waitForJob(t, handler, job.ID, &results)
+	require.Len(t, results.Report.Hosts, 1)
+	require.Equal(t, errTargetNotAllowed.Error(), results.Report.Hosts[0].Error)
+}
+
+func waitForJob(t *testing.T, handler http.Handler, id string, results interface{}) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		var job scanJob
+		getAPI(t, handler, http.MethodGet, "/scans/"+id, "", &job)
+		return job.Status == jobStatusDone
+	}, 10*time.Second, 10*time.Millisecond)
+	w := getAPI(t, handler, http.MethodGet, "/scans/"+id+"/results", "", results)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestServeJobs(t *testing.T) {
+	t.Parallel()
+	edSigner, _ := newTestSigners(t)
+	host := net.JoinHostPort("127.0.0.1", startTestServer(t, edSigner))
+	s := newTestAPIServer(t, context.Background(), "127.0.0.0/8")
+	handler := s.handler()
+
+	w := getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["a", "b", "c"]}`, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code, "max targets")
+	w = getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": []}`, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var job scanJob
+	w = getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["`+host+`"]}`, &job)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Equal(t, "/scans/"+job.ID, w.Header().Get("Location"))
+	require.Equal(t, 1, job.Total)
+
+	var results struct {
+		ID     string
+		Status string
+		Report *sshkeys.Report
+	}
+	waitForJob(t, handler, job.ID, &results)
+	require.Equal(t, job.ID, results.ID)
+	requireReportKey(t, results.Report, edSigner.PublicKey())
+
+	// the job limit is reached until the finished job expires
+	w = getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["`+host+`"]}`, nil)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	s.jobTTL = 0
+	w = getAPI(t, handler, http.MethodGet, "/scans/"+job.ID, "", nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["`+host+`"]}`, nil)
+	require.Equal(t, http.StatusAccepted, w.Code)
+}
+
+func TestServeJobResultOrder(t *testing.T) {
+	t.Parallel()
+	edSigner, _ := newTestSigners(t)
+	host := net.JoinHostPort("127.0.0.1", startTestServer(t, edSigner))
+	closedHost := closedTestAddress(t)
+	handler := newTestAPIServer(t, context.Background(), "127.0.0.0/8").handler()
+
+	// the closed host fails before the server is scanned, the results still keep the order of the request
+	var job scanJob
+	w := getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["`+host+`", "`+closedHost+`"]}`, &job)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var results struct{ Report *sshkeys.Report }
+	waitForJob(t, handler, job.ID, &results)
+	require.Len(t, results.Report.Hosts, 2)
+	require.Equal(t, host, results.Report.Hosts[0].Host)
+	require.Empty(t, results.Report.Hosts[0].Error)
+	require.Equal(t, closedHost, results.Report.Hosts[1].Host)
+	require.NotEmpty(t, results.Report.Hosts[1].Error)
+}
+
+// closedTestAddress returns the address of a port on 127.0.0.1 that nothing listens on.
+func closedTestAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+func TestServeJobCanceled(t *testing.T) {
+	t.Parallel()
+	edSigner, _ := newTestSigners(t)
+	host := net.JoinHostPort("127.0.0.1", startTestServer(t, edSigner))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler := newTestAPIServer(t, ctx, "127.0.0.0/8").handler()
+
+	var job scanJob
+	getAPI(t, handler, http.MethodPost, "/scans", `{"Hosts": ["`+host+`"]}`, &job)
+	var results struct{ Report *sshkeys.Report }
+	waitForJob(t, handler, job.ID, &results)
+	require.Len(t, results.Report.Hosts, 1)
+	require.Empty(t, results.Report.Hosts[0].Keys)
+	require.Contains(t, results.Report.Hosts[0].Error, "cancel")
+}
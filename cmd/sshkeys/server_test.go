@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+// testServerVersion is the version the test servers send.
+const testServerVersion = "SSH-2.0-sshkeys_test"
+
+func newTestSigners(t *testing.T) (ed25519Signer, ecdsaSigner xssh.Signer) {
+	t.Helper()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ed25519Signer, err = xssh.NewSignerFromKey(edKey)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecdsaSigner, err = xssh.NewSignerFromKey(ecKey)
+	require.NoError(t, err)
+	return ed25519Signer, ecdsaSigner
+}
+
+// startTestServer starts an ssh server with the host keys of signers on 127.0.0.1 and returns its port.
+func startTestServer(t *testing.T, signers ...xssh.Signer) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	hostSigners := make([]ssh.Signer, len(signers))
+	for i := range signers {
+		hostSigners[i] = signers[i]
+	}
+	server := ssh.Server{
+		HostSigners: hostSigners,
+		ServerConfigCallback: func(ctx ssh.Context) *xssh.ServerConfig {
+			return &xssh.ServerConfig{ServerVersion: testServerVersion}
+		},
+	}
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+			t.Error(err)
+		}
+	}()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	return port
+}
+
+func authorizedKey(key xssh.PublicKey) string {
+	return string(xssh.MarshalAuthorizedKey(key))
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	signExitSigned  = 0
+	signExitFailed  = 1
+	signExitTrouble = 2
+)
+
+// signClockSkew is subtracted from the start of the validity window, so hosts with a clock that is slightly
+// behind accept new certificates.
+const signClockSkew = 5 * time.Minute
+
+// signHost is the json representation of the certificates that were issued for a single host.
+type signHost struct {
+	Host         string           `json:"host"`
+	Address      string           `json:"address,omitempty"`
+	Certificates []signedHostCert `json:"certificates"`
+	Error        string           `json:"error,omitempty"`
+
+	target sshkeys.Target
+	keys   []ssh.PublicKey
+}
+
+// signedHostCert describes a written certificate.
+type signedHostCert struct {
+	File                 string     `json:"file"`
+	Type                 string     `json:"type"`
+	KeyFingerprintSHA256 string     `json:"key_fingerprint_sha256"`
+	KeyID                string     `json:"key_id"`
+	Serial               uint64     `json:"serial"`
+	Principals           []string   `json:"principals"`
+	ValidBefore          *time.Time `json:"valid_before,omitempty"`
+	Forever              bool       `json:"forever,omitempty"`
+}
+
+func printSignUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s sign -ca-key <file> [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Scans the hosts and signs their host keys as host certificates (like ssh-keygen -s <ca> -h),")
+	fmt.Fprintln(os.Stderr, "every certificate is written to <host>-<type>-cert.pub (<host>_<port>-<type>-cert.pub for ports other than 22).")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if the keys of all hosts were signed, 1 if a host could not be scanned or signed and 2 on errors.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -ca-key=")
+	fmt.Fprintln(os.Stderr, "       Private key file of the CA, with -agent the public key file of a CA key in the ssh-agent")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -agent")
+	fmt.Fprintln(os.Stderr, "       Sign with the key of the ssh-agent (SSH_AUTH_SOCK) that matches -ca-key")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -principals=%h")
+	fmt.Fprintln(os.Stderr, "       Comma separated host names the certificates are valid for, %h is replaced by the host")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -key-id=%h")
+	fmt.Fprintln(os.Stderr, "       Key id of the certificates, %h is replaced by the host")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -serial=0")
+	fmt.Fprintln(os.Stderr, "       Serial of the certificates, a leading + increments the serial for every certificate (e.g. +100)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -validity=forever")
+	fmt.Fprintln(os.Stderr, "       Duration the certificates are valid for (e.g. 8760h) or forever")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -d=.")
+	fmt.Fprintln(os.Stderr, "    -dir=.")
+	fmt.Fprintln(os.Stderr, "       Directory the certificates are written to")
+	fmt.Fprintln(os.Stderr)
+	printConcurrentUsage()
+	printHostFlagsUsage("f", "file")
+}
+
+func runSign(args []string) int {
+	var caKeyOpt, principalsOpt, keyIDOpt, serialOpt, validityOpt, dirOpt string
+	var agentOpt bool
+	var hostOpts hostFlags
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	flags.Usage = printSignUsage
+	flags.StringVar(&caKeyOpt, "ca-key", "", "")
+	flags.BoolVar(&agentOpt, "agent", false, "")
+	flags.StringVar(&principalsOpt, "principals", "%h", "")
+	flags.StringVar(&keyIDOpt, "key-id", "%h", "")
+	flags.StringVar(&serialOpt, "serial", "0", "")
+	flags.StringVar(&validityOpt, "validity", "forever", "")
+	flags.StringVar(&dirOpt, "dir", ".", "")
+	flags.StringVar(&dirOpt, "d", ".", "")
+	hostOpts.register(flags, "file", "f")
+	hostOpts.registerConcurrent(flags)
+	if err := flags.Parse(args); err != nil {
+		return signExitTrouble
+	}
+	hosts, err := hostOpts.hosts(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return signExitTrouble
+	}
+	if len(hosts) == 0 || caKeyOpt == "" {
+		printSignUsage()
+		return signExitTrouble
+	}
+	output, timeout, err := hostOpts.parse("sign")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return signExitTrouble
+	}
+	increment := strings.HasPrefix(serialOpt, "+")
+	serial, err := strconv.ParseUint(strings.TrimPrefix(serialOpt, "+"), 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "'%s' is not a serial\n", serialOpt)
+		return signExitTrouble
+	}
+	var validity time.Duration
+	if validityOpt != "forever" {
+		if validity, err = time.ParseDuration(validityOpt); err != nil || validity <= 0 {
+			fmt.Fprintf(os.Stderr, "'%s' is not a duration\n", validityOpt)
+			return signExitTrouble
+		}
+	}
+	ca, closeCA, err := loadCASigner(caKeyOpt, agentOpt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return signExitTrouble
+	}
+	defer closeCA()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	results := make([]signHost, len(hosts))
+	forEachHost(ctx, hosts, hostOpts.parallel, func(ctx context.Context, i int, host string) {
+		results[i] = scanSignHost(ctx, host, hostOpts.concurrent, timeout)
+	})
+
+	// the keys are signed in the order of the hosts, so incremented serials do not depend on the scan order
+	now := time.Now()
+	options := sshkeys.HostCertOptions{Serial: serial}
+	if validity > 0 {
+		options.ValidAfter = now.Add(-signClockSkew)
+		options.ValidBefore = now.Add(validity)
+	}
+	exitCode := signExitSigned
+	for i := range results {
+		if results[i].Error == "" {
+			signHostKeys(&results[i], ca, &options, increment, keyIDOpt, principalsOpt, dirOpt)
+		}
+		if results[i].Error != "" {
+			exitCode = signExitFailed
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			SchemaVersion int        `json:"schema_version"`
+			Hosts         []signHost `json:"hosts"`
+		}{sshkeys.SchemaVersion, results}); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %s\n", err)
+			return signExitTrouble
+		}
+		return exitCode
+	}
+	for i := range results {
+		printSignHost(&results[i])
+	}
+	return exitCode
+}
+
+// loadCASigner returns the signer of the CA. With useAgent the file contains the public key of the CA (or it is
+// read from the .pub file next to it) and the matching key of the ssh-agent is used.
+// The returned function closes the connection to the agent.
+func loadCASigner(caKeyFile string, useAgent bool) (ssh.Signer, func(), error) {
+	closeFn := func() {}
+	buf, err := os.ReadFile(caKeyFile)
+	if err != nil {
+		return nil, closeFn, fmt.Errorf("unable to read ca key: %w", err)
+	}
+	if !useAgent {
+		signer, err := ssh.ParsePrivateKey(buf)
+		if err != nil {
+			var missingErr *ssh.PassphraseMissingError
+			if errors.As(err, &missingErr) {
+				return nil, closeFn, errors.New("ca key is encrypted, add it to the ssh-agent and use -agent")
+			}
+			return nil, closeFn, fmt.Errorf("unable to parse ca key: %w", err)
+		}
+		return signer, closeFn, nil
+	}
+
+	caKey, err := parseCAPublicKey(caKeyFile, buf)
+	if err != nil {
+		return nil, closeFn, err
+	}
+	signers, closeFn, err := loadSigners("", true)
+	if err != nil {
+		return nil, closeFn, err
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), caKey.Marshal()) {
+			return signer, closeFn, nil
+		}
+	}
+	closeFn()
+	return nil, func() {}, fmt.Errorf("ca key %s is not in the ssh-agent", ssh.FingerprintSHA256(caKey))
+}
+
+// parseCAPublicKey parses the public key of the CA from buf, the content of caKeyFile.
+// If caKeyFile is a private key, the public key is read from the private key or from caKeyFile.pub.
+func parseCAPublicKey(caKeyFile string, buf []byte) (ssh.PublicKey, error) {
+	if key, _, _, _, err := ssh.ParseAuthorizedKey(buf); err == nil {
+		return key, nil
+	}
+	signer, err := ssh.ParsePrivateKey(buf)
+	if err == nil {
+		return signer.PublicKey(), nil
+	}
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) && missingErr.PublicKey != nil {
+		return missingErr.PublicKey, nil
+	}
+	if pub, err := os.ReadFile(caKeyFile + ".pub"); err == nil {
+		if key, _, _, _, err := ssh.ParseAuthorizedKey(pub); err == nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("unable to parse the public key of the ca key")
+}
+
+// plainKeyAlgorithms returns the algorithms of DefaultKeyAlgorithms that are not certificates.
+func plainKeyAlgorithms() []string {
+	var algorithms []string
+	for _, algo := range sshkeys.DefaultKeyAlgorithms() {
+		if !strings.Contains(algo, "-cert-") {
+			algorithms = append(algorithms, algo)
+		}
+	}
+	return algorithms
+}
+
+func scanSignHost(ctx context.Context, host string, concurrent int, timeout time.Duration) signHost {
+	result := signHost{Host: host, Certificates: []signedHostCert{}}
+	target, err := sshkeys.ParseTarget(host)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.target = target
+	result.Address = target.Address()
+	keys, err := sshkeys.GetKeys(ctx, result.Address, concurrent, timeout, plainKeyAlgorithms()...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	// rsa-sha2-256, rsa-sha2-512 and ssh-rsa return the same key
+	for _, algo := range plainKeyAlgorithms() {
+		key, ok := keys[algo]
+		if !ok {
+			continue
+		}
+		duplicate := false
+		for _, k := range result.keys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result.keys = append(result.keys, key)
+		}
+	}
+	if len(result.keys) == 0 {
+		result.Error = "no host keys found"
+	}
+	return result
+}
+
+// signHostKeys signs the keys of result and writes the certificates to dir.
+// options.Serial is incremented after every certificate if increment is set.
+func signHostKeys(
+	result *signHost,
+	ca ssh.Signer,
+	options *sshkeys.HostCertOptions,
+	increment bool,
+	keyID, principals, dir string,
+) {
+	hostOptions := *options
+	hostOptions.KeyID = strings.ReplaceAll(keyID, "%h", result.target.Host)
+	hostOptions.Principals = nil
+	for _, principal := range strings.Split(principals, ",") {
+		if principal = strings.TrimSpace(strings.ReplaceAll(principal, "%h", result.target.Host)); principal != "" {
+			hostOptions.Principals = append(hostOptions.Principals, principal)
+		}
+	}
+
+	for _, key := range result.keys {
+		hostOptions.Serial = options.Serial
+		cert, err := sshkeys.SignHostKey(rand.Reader, ca, key, &hostOptions)
+		if err != nil {
+			result.Error = err.Error()
+			return
+		}
+		if increment {
+			options.Serial++
+		}
+		file := filepath.Join(dir, certFileName(&result.target, key))
+		if err := os.WriteFile(file, ssh.MarshalAuthorizedKey(cert), 0o644); err != nil { //nolint: gosec,gomnd // public file
+			result.Error = fmt.Sprintf("unable to write certificate: %s", err)
+			return
+		}
+		info := sshkeys.NewCertificateInfo(cert)
+		signed := signedHostCert{
+			File:                 file,
+			Type:                 cert.Type(),
+			KeyFingerprintSHA256: info.KeyFingerprintSHA256,
+			KeyID:                info.KeyID,
+			Serial:               info.Serial,
+			Principals:           info.Principals,
+			Forever:              info.Forever,
+		}
+		if !info.Forever {
+			signed.ValidBefore = &info.ValidBefore
+		}
+		result.Certificates = append(result.Certificates, signed)
+	}
+}
+
+// certFileName returns <host>-<type>-cert.pub, the type is named like in the ssh_host_<type>_key files.
+func certFileName(target *sshkeys.Target, key ssh.PublicKey) string {
+	host := target.Host
+	if target.Port != sshkeys.DefaultPort {
+		host = net.JoinHostPort(host, target.Port)
+		host = strings.NewReplacer("[", "", "]", "", ":", "_").Replace(host)
+	}
+	host = strings.ReplaceAll(host, string(filepath.Separator), "_")
+
+	keyType := key.Type()
+	switch {
+	case keyType == ssh.KeyAlgoRSA:
+		keyType = "rsa"
+	case keyType == ssh.KeyAlgoDSA:
+		keyType = "dsa"
+	case keyType == ssh.KeyAlgoED25519:
+		keyType = "ed25519"
+	case keyType == ssh.KeyAlgoSKED25519:
+		keyType = "ed25519-sk"
+	case keyType == ssh.KeyAlgoSKECDSA256:
+		keyType = "ecdsa-sk"
+	case strings.HasPrefix(keyType, "ecdsa-sha2-"):
+		keyType = "ecdsa"
+	default:
+		keyType = strings.TrimPrefix(keyType, "ssh-")
+	}
+	return host + "-" + keyType + "-cert.pub"
+}
+
+func printSignHost(result *signHost) {
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", result.Host, result.Error)
+	}
+	for _, cert := range result.Certificates {
+		expires := "never expires"
+		if !cert.Forever {
+			expires = "expires " + cert.ValidBefore.Format(time.RFC3339)
+		}
+		principals := strings.Join(cert.Principals, ",")
+		if principals == "" {
+			principals = "(all hosts)"
+		}
+		fmt.Printf("%s: wrote %s, key id %q, serial %d, principals %s, %s\n",
+			result.Host, cert.File, cert.KeyID, cert.Serial, principals, expires)
+	}
+}
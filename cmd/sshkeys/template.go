@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// templateHost is the data of a host that is passed to -template.
+type templateHost struct {
+	Host         string
+	Address      string
+	Port         string
+	HostKeyAlias string
+	Banner       string
+	Error        string
+	Errors       map[string]string
+	Keys         []templateKey
+	// HASSHServer and HASSHServerAlgorithms identify the server implementation.
+	HASSHServer           string
+	HASSHServerAlgorithms string
+	// AuthMethods is set with -auth-methods.
+	AuthMethods *sshkeys.AuthMethods
+}
+
+// templateKey is the data of a key that is passed to -format.
+type templateKey struct {
+	Host       string
+	Address    string
+	Port       string
+	Banner     string
+	Algorithms []string
+	// Algorithm is the first algorithm that returned the key.
+	Algorithm string
+	Type      string
+	Bits      int
+	Key       ssh.PublicKey
+
+	AuthorizedKey     string
+	KnownHosts        string
+	FingerprintMD5    string
+	FingerprintSHA1   string
+	FingerprintSHA256 string
+	Certificate       *sshkeys.CertificateInfo
+	// Announced is set if the server announced the key after the authentication (-identity or -agent),
+	// keys that were only announced have no Algorithms.
+	Announced bool
+	// Proven is set if the server proved the possession of the key (-identity or -agent).
+	Proven bool
+	// Revoked is the reason why the key is revoked by -krl.
+	Revoked string
+}
+
+func newTemplateHost(result *sshkeys.HostResult) (*templateHost, error) {
+	host := templateHost{
+		Host:                  result.Host,
+		Address:               result.Address,
+		HostKeyAlias:          result.HostKeyAlias,
+		Banner:                result.Banner,
+		Error:                 result.Error,
+		Errors:                result.Errors,
+		AuthMethods:           result.AuthMethods,
+		HASSHServer:           result.HASSHServer,
+		HASSHServerAlgorithms: result.HASSHServerAlgorithms,
+		Keys:                  make([]templateKey, 0, len(result.Keys)),
+	}
+	if result.Address != "" {
+		_, host.Port, _ = net.SplitHostPort(result.Address)
+	}
+	for i := range result.Keys {
+		key, err := result.Keys[i].PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		k := templateKey{
+			Host:              host.Host,
+			Address:           host.Address,
+			Port:              host.Port,
+			Banner:            host.Banner,
+			Algorithms:        result.Keys[i].Algorithms,
+			Type:              result.Keys[i].Type,
+			Bits:              result.Keys[i].Bits,
+			Key:               key,
+			AuthorizedKey:     result.Keys[i].AuthorizedKey,
+			FingerprintMD5:    "MD5:" + result.Keys[i].Fingerprints.MD5.Hex,
+			FingerprintSHA1:   "SHA1:" + result.Keys[i].Fingerprints.SHA1.Base64,
+			FingerprintSHA256: "SHA256:" + result.Keys[i].Fingerprints.SHA256.Base64,
+			Certificate:       result.Keys[i].Certificate,
+			Announced:         result.Keys[i].Announced,
+			Proven:            result.Keys[i].Proven,
+			Revoked:           result.Keys[i].Revoked,
+		}
+		if len(k.Algorithms) > 0 {
+			k.Algorithm = k.Algorithms[0]
+		}
+		switch {
+		case host.HostKeyAlias != "":
+			k.KnownHosts = knownhosts.Line([]string{host.HostKeyAlias}, key)
+		case host.Address != "":
+			k.KnownHosts = knownhosts.Line([]string{host.Address}, key)
+		}
+		host.Keys = append(host.Keys, k)
+	}
+	return &host, nil
+}
+
+func templateFingerprint(hash, encoding string, key ssh.PublicKey) (string, error) {
+	enc, ok := map[string]sshkeys.Encoding{
+		"hex":    sshkeys.HexEncoding,
+		"base32": sshkeys.Base32Encoding,
+		"base64": sshkeys.Base64Encoding,
+	}[strings.ToLower(encoding)]
+	if !ok {
+		return "", fmt.Errorf("unknown encoding %q", encoding)
+	}
+	switch strings.ToLower(hash) {
+	case "md5":
+		return sshkeys.FingerprintMD5(enc, key)
+	case "sha1":
+		return sshkeys.FingerprintSHA1(enc, key)
+	case "sha256":
+		return sshkeys.FingerprintSHA256(enc, key)
+	default:
+		return "", fmt.Errorf("unknown fingerprint algorithm %q", hash)
+	}
+}
+
+// templateFuncs are the functions that are available in -format and -template.
+var templateFuncs = template.FuncMap{
+	"fingerprint": templateFingerprint,
+	"md5": func(encoding string, key ssh.PublicKey) (string, error) {
+		return templateFingerprint("md5", encoding, key)
+	},
+	"sha1": func(encoding string, key ssh.PublicKey) (string, error) {
+		return templateFingerprint("sha1", encoding, key)
+	},
+	"sha256": func(encoding string, key ssh.PublicKey) (string, error) {
+		return templateFingerprint("sha256", encoding, key)
+	},
+	"authorizedKey": sshkeys.AuthorizedKey,
+	"knownHosts": func(host string, key ssh.PublicKey) string {
+		return knownhosts.Line([]string{host}, key)
+	},
+	"hashedKnownHosts": func(host string, key ssh.PublicKey) string {
+		return knownhosts.Line([]string{knownhosts.HashHostname(knownhosts.Normalize(host))}, key)
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// templateWriter executes -format for every key or -template once for all hosts.
+type templateWriter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	errW       io.Writer
+	tmpl       *template.Template
+	perKey     bool
+	prefixHost bool
+
+	hosts []templateHost
+}
+
+func newTemplateWriter(format, templateFile string, multipleHosts bool) (*templateWriter, error) {
+	tw := templateWriter{
+		w:          os.Stdout,
+		errW:       os.Stderr,
+		perKey:     templateFile == "",
+		prefixHost: multipleHosts,
+	}
+	text := format
+	if templateFile != "" {
+		buf, err := os.ReadFile(templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read template: %w", err)
+		}
+		text = string(buf)
+	}
+	var err error
+	tw.tmpl, err = template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template: %w", err)
+	}
+	return &tw, nil
+}
+
+func (t *templateWriter) Write(result *sshkeys.HostResult) error {
+	host, err := newTemplateHost(result)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.perKey {
+		t.hosts = append(t.hosts, *host)
+		return nil
+	}
+
+	prefix := ""
+	if t.prefixHost {
+		prefix = result.Host + " "
+	}
+	if result.Error != "" {
+		fmt.Fprintln(t.errW, prefix+result.Error)
+		return nil
+	}
+	for i := range host.Keys {
+		if err := t.tmpl.Execute(t.w, &host.Keys[i]); err != nil {
+			return fmt.Errorf("unable to execute template: %w", err)
+		}
+		fmt.Fprintln(t.w)
+	}
+	for _, algo := range errorAlgorithms(result.Errors) {
+		fmt.Fprintf(t.errW, "%s%s: %s\n", prefix, algo, result.Errors[algo])
+	}
+	return nil
+}
+
+func (t *templateWriter) Close() error {
+	if t.perKey {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.tmpl.Execute(t.w, struct{ Hosts []templateHost }{Hosts: t.hosts}); err != nil {
+		return fmt.Errorf("unable to execute template: %w", err)
+	}
+	return nil
+}
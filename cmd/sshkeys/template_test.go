@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+// newTestKey returns an ed25519 key that is derived from seed, so its fingerprints are always the same.
+func newTestKey(t *testing.T, seed byte) xssh.PublicKey {
+	t.Helper()
+	key, err := xssh.NewPublicKey(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize)).Public())
+	require.NoError(t, err)
+	return key
+}
+
+// newTestResult returns the result of a host that returned keys and failed with errs.
+func newTestResult(t *testing.T, host, address string, keys map[string]xssh.PublicKey, errs map[string]string) *sshkeys.HostResult {
+	t.Helper()
+	keyResults, err := sshkeys.GroupKeys(keys)
+	require.NoError(t, err)
+	return &sshkeys.HostResult{
+		Host:    host,
+		Address: address,
+		Banner:  "SSH-2.0-OpenSSH_9.6",
+		Keys:    keyResults,
+		Errors:  errs,
+	}
+}
+
+// writeTestResults writes results with writer and returns what was written to stdout and stderr.
+func writeTestResults(t *testing.T, writer resultWriter, stdout, stderr *bytes.Buffer, results ...*sshkeys.HostResult) (string, string) {
+	t.Helper()
+	for _, result := range results {
+		require.NoError(t, writer.Write(result))
+	}
+	require.NoError(t, writer.Close())
+	return stdout.String(), stderr.String()
+}
+
+// testResults are a host with two keys and failed algorithms, a host with a single key and a host that failed.
+func testResults(t *testing.T) []*sshkeys.HostResult {
+	t.Helper()
+	key1 := newTestKey(t, 1)
+	key2 := newTestKey(t, 2)
+	return []*sshkeys.HostResult{
+		newTestResult(t, "a.example.com", "a.example.com:22", map[string]xssh.PublicKey{
+			xssh.KeyAlgoED25519:   key1,
+			xssh.KeyAlgoSKED25519: key2,
+		}, map[string]string{
+			xssh.KeyAlgoRSASHA512: "i/o timeout",
+			xssh.KeyAlgoECDSA256:  "handshake failed",
+			xssh.KeyAlgoRSA:       "connection reset by peer",
+		}),
+		newTestResult(t, "b.example.com", "b.example.com:2222", map[string]xssh.PublicKey{
+			xssh.KeyAlgoED25519: key2,
+		}, nil),
+		sshkeys.NewFailedResult("c.example.com", "c.example.com:22", os.ErrDeadlineExceeded),
+	}
+}
+
+func newTestTemplateWriter(t *testing.T, format, template string, multipleHosts bool) (*templateWriter, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	templateFile := ""
+	if template != "" {
+		templateFile = filepath.Join(t.TempDir(), "template")
+		require.NoError(t, os.WriteFile(templateFile, []byte(template), 0o600))
+	}
+	tw, err := newTemplateWriter(format, templateFile, multipleHosts)
+	require.NoError(t, err)
+	var stdout, stderr bytes.Buffer
+	tw.w = &stdout
+	tw.errW = &stderr
+	return tw, &stdout, &stderr
+}
+
+func TestTemplateWriter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		format        string
+		template      string
+		multipleHosts bool
+		stdout        string
+		stderr        string
+	}{
+		{
+			name:          "format",
+			format:        "{{.Host}} {{.Port}} {{.Algorithm}} {{.FingerprintSHA256}}",
+			multipleHosts: true,
+			stdout: `a.example.com 22 sk-ssh-ed25519@openssh.com SHA256:4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4
+a.example.com 22 ssh-ed25519 SHA256:fe85JkIjo8VPe+XqXJGH5Mau1EMFdK1OdKvJUFicyA8
+b.example.com 2222 ssh-ed25519 SHA256:4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4
+`,
+			stderr: `a.example.com ecdsa-sha2-nistp256: handshake failed
+a.example.com rsa-sha2-512: i/o timeout
+a.example.com ssh-rsa: connection reset by peer
+c.example.com i/o timeout
+`,
+		},
+		{
+			name:   "format without host prefix",
+			format: "{{.Type}} {{join .Algorithms \",\"}} {{.KnownHosts}}",
+			stdout: `ssh-ed25519 sk-ssh-ed25519@openssh.com a.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIE5dw6ofRdfVqNUZsNMfszLjYqRtO43ol32D1uPybOU
+ssh-ed25519 ssh-ed25519 a.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIqI4910CfGV/VLbLTy6XXLKZwm/HZQSG/N0iAG0D29c
+ssh-ed25519 ssh-ed25519 [b.example.com]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIE5dw6ofRdfVqNUZsNMfszLjYqRtO43ol32D1uPybOU
+`,
+			stderr: `ecdsa-sha2-nistp256: handshake failed
+rsa-sha2-512: i/o timeout
+ssh-rsa: connection reset by peer
+i/o timeout
+`,
+		},
+		{
+			name: "template",
+			template: `{{range .Hosts}}{{.Host}}{{if .Error}} error: {{.Error}}{{end}}
+{{range $algo, $err := .Errors}}  failed {{$algo}}: {{$err}}
+{{end}}{{range .Keys}}  {{.Type}} {{sha256 "base64" .Key}}
+{{end}}{{end}}`,
+			stdout: `a.example.com
+  failed ecdsa-sha2-nistp256: handshake failed
+  failed rsa-sha2-512: i/o timeout
+  failed ssh-rsa: connection reset by peer
+  ssh-ed25519 4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4
+  ssh-ed25519 fe85JkIjo8VPe+XqXJGH5Mau1EMFdK1OdKvJUFicyA8
+b.example.com
+  ssh-ed25519 4A9jyZBOhnKZvcGQ6TRFbf5Gymb41AfYvYaVmWHD+G4
+c.example.com error: i/o timeout
+`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			tw, stdout, stderr := newTestTemplateWriter(t, test.format, test.template, test.multipleHosts)
+			out, errOut := writeTestResults(t, tw, stdout, stderr, testResults(t)...)
+			require.Equal(t, test.stdout, out)
+			require.Equal(t, test.stderr, errOut)
+		})
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Parallel()
+	result := newTestResult(t, "a.example.com", "a.example.com:22", map[string]xssh.PublicKey{
+		xssh.KeyAlgoED25519: newTestKey(t, 1),
+	}, nil)
+
+	tests := []struct {
+		format string
+		output string
+	}{
+		{format: `{{fingerprint "sha256" "hex" .Key}}`, output: "7d:ef:39:26:42:23:a3:c5:4f:7b:e5:ea:5c:91:87:e4:c6:ae:d4:43:05:74:ad:4e:74:ab:c9:50:58:9c:c8:0f\n"},
+		{format: `{{md5 "hex" .Key}}`, output: "ab:f1:da:70:fb:1d:78:2a:1a:c7:69:73:3c:43:07:4f\n"},
+		{format: `{{sha1 "base32" .Key}}`, output: "5YQDJ54LU4T2PP74DMLE6Q3U5H2GOZXQ\n"},
+		{format: `{{sha256 "BASE64" .Key}}`, output: "fe85JkIjo8VPe+XqXJGH5Mau1EMFdK1OdKvJUFicyA8\n"},
+		{format: `{{authorizedKey .Key}}`, output: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIqI4910CfGV/VLbLTy6XXLKZwm/HZQSG/N0iAG0D29c\n"},
+		{format: `{{knownHosts "[a.example.com]:2222" .Key}}`, output: "[a.example.com]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIqI4910CfGV/VLbLTy6XXLKZwm/HZQSG/N0iAG0D29c\n"},
+		{format: `{{upper .Type}} {{lower "A.EXAMPLE.COM"}}`, output: "SSH-ED25519 a.example.com\n"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.format, func(t *testing.T) {
+			tw, stdout, stderr := newTestTemplateWriter(t, test.format, "", false)
+			out, errOut := writeTestResults(t, tw, stdout, stderr, result)
+			require.Equal(t, test.output, out)
+			require.Empty(t, errOut)
+		})
+	}
+
+	t.Run("hashedKnownHosts", func(t *testing.T) {
+		tw, stdout, stderr := newTestTemplateWriter(t, `{{hashedKnownHosts .Address .Key}}`, "", false)
+		out, _ := writeTestResults(t, tw, stdout, stderr, result)
+		require.Regexp(t, `^\|1\|\S+\|\S+ ssh-ed25519 AAAA\S+\n$`, out)
+	})
+
+	for _, format := range []string{`{{fingerprint "sha512" "hex" .Key}}`, `{{sha256 "base58" .Key}}`} {
+		tw, stdout, stderr := newTestTemplateWriter(t, format, "", false)
+		require.Error(t, tw.Write(result), format)
+		require.Empty(t, stdout.String())
+		require.Empty(t, stderr.String())
+	}
+}
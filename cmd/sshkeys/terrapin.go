@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Eun/sshkeys"
+)
+
+const (
+	terrapinExitNotVulnerable = 0
+	terrapinExitVulnerable    = 1
+	terrapinExitTrouble       = 2
+)
+
+// terrapinHost is the json representation of the terrapin check of a single host.
+type terrapinHost struct {
+	Host     string                  `json:"host"`
+	Address  string                  `json:"address,omitempty"`
+	Terrapin *sshkeys.TerrapinResult `json:"terrapin,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+func printTerrapinUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s terrapin [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Checks whether the hosts are vulnerable to the Terrapin attack (CVE-2023-48795).")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if no host is vulnerable, 1 if a host is vulnerable and 2 on errors.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	printHostFlagsUsage("f", "file")
+}
+
+func runTerrapin(args []string) int {
+	var hostOpts hostFlags
+	flags := flag.NewFlagSet("terrapin", flag.ContinueOnError)
+	flags.Usage = printTerrapinUsage
+	hostOpts.register(flags, "file", "f")
+	if err := flags.Parse(args); err != nil {
+		return terrapinExitTrouble
+	}
+	hosts, err := hostOpts.hosts(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return terrapinExitTrouble
+	}
+	if len(hosts) == 0 {
+		printTerrapinUsage()
+		return terrapinExitTrouble
+	}
+	output, timeout, err := hostOpts.parse("terrapin")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return terrapinExitTrouble
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	results := make([]terrapinHost, len(hosts))
+	forEachHost(ctx, hosts, hostOpts.parallel, func(ctx context.Context, i int, host string) {
+		results[i] = checkTerrapin(ctx, host, timeout)
+	})
+
+	exitCode := terrapinExitNotVulnerable
+	for i := range results {
+		switch {
+		case results[i].Error != "":
+			exitCode = terrapinExitTrouble
+		case results[i].Terrapin.Vulnerable && exitCode == terrapinExitNotVulnerable:
+			exitCode = terrapinExitVulnerable
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			SchemaVersion int            `json:"schema_version"`
+			Hosts         []terrapinHost `json:"hosts"`
+		}{sshkeys.SchemaVersion, results}); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %s\n", err)
+			return terrapinExitTrouble
+		}
+		return exitCode
+	}
+	for i := range results {
+		printTerrapinHost(&results[i])
+	}
+	return exitCode
+}
+
+func checkTerrapin(ctx context.Context, host string, timeout time.Duration) terrapinHost {
+	result := terrapinHost{Host: host}
+	addr, err := dialAddress(host)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Address = addr
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result.Terrapin, err = sshkeys.CheckTerrapin(ctx, addr)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func printTerrapinHost(result *terrapinHost) {
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", result.Host, result.Error)
+		return
+	}
+	t := result.Terrapin
+	switch {
+	case t.Vulnerable:
+		fmt.Printf("%s: vulnerable, no strict kex and %s\n", result.Host, strings.Join(t.VulnerableModes, ", "))
+	case t.StrictKex:
+		fmt.Printf("%s: not vulnerable, strict kex\n", result.Host)
+	default:
+		fmt.Printf("%s: not vulnerable, no vulnerable modes\n", result.Host)
+	}
+}
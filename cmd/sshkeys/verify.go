@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	verifyExitValid    = 0
+	verifyExitInvalid  = 1
+	verifyExitTrouble  = 2
+	verifyExitExpiring = 3
+)
+
+// verifyHost is the json representation of the certificate validation of a single host.
+type verifyHost struct {
+	Host         string                     `json:"host"`
+	Address      string                     `json:"address,omitempty"`
+	Certificates []sshkeys.CertVerification `json:"certificates"`
+	Error        string                     `json:"error,omitempty"`
+}
+
+// exitCode returns the exit code of the host, see printVerifyUsage.
+func (v *verifyHost) exitCode() int {
+	if v.Error != "" {
+		return verifyExitTrouble
+	}
+	if len(v.Certificates) == 0 {
+		return verifyExitInvalid
+	}
+	code := verifyExitValid
+	for _, cert := range v.Certificates {
+		if !cert.Valid {
+			return verifyExitInvalid
+		}
+		if cert.Expiring {
+			code = verifyExitExpiring
+		}
+	}
+	return code
+}
+
+// verifyExitPriority orders the exit codes, the code of the highest priority of all hosts is returned.
+var verifyExitPriority = map[int]int{
+	verifyExitValid:    0,
+	verifyExitExpiring: 1,
+	verifyExitInvalid:  2,
+	verifyExitTrouble:  3,
+}
+
+func printVerifyUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s verify -ca <file> [options] <host>...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Validates the host certificates of the hosts against trusted certificate authorities:")
+	fmt.Fprintln(os.Stderr, "the CA signature, the host in the principals, the validity window and the certificate type.")
+	fmt.Fprintln(os.Stderr, "Exits with 0 if all certificates are valid, 1 if a certificate is invalid or a host has none,")
+	fmt.Fprintln(os.Stderr, "2 on errors and 3 if all certificates are valid but one expires within -warn.")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "    -ca=")
+	fmt.Fprintln(os.Stderr, "       File with the trusted CA public keys (e.g. ca.pub) or known_hosts @cert-authority lines")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "    -warn=720h")
+	fmt.Fprintln(os.Stderr, "       Warn about certificates that expire within this duration")
+	fmt.Fprintln(os.Stderr)
+	printConcurrentUsage()
+	printHostFlagsUsage("f", "file")
+}
+
+func runVerify(args []string) int {
+	var caOpt, warnOpt string
+	var hostOpts hostFlags
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = printVerifyUsage
+	flags.StringVar(&caOpt, "ca", "", "")
+	flags.StringVar(&warnOpt, "warn", "720h", "")
+	hostOpts.register(flags, "file", "f")
+	hostOpts.registerConcurrent(flags)
+	if err := flags.Parse(args); err != nil {
+		return verifyExitTrouble
+	}
+	hosts, err := hostOpts.hosts(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return verifyExitTrouble
+	}
+	if len(hosts) == 0 || caOpt == "" {
+		printVerifyUsage()
+		return verifyExitTrouble
+	}
+	output, timeout, err := hostOpts.parse("verify")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return verifyExitTrouble
+	}
+	warn, err := time.ParseDuration(warnOpt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "'%s' is not a duration\n", warnOpt)
+		return verifyExitTrouble
+	}
+	authorities, err := loadCertAuthorities(caOpt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return verifyExitTrouble
+	}
+	verifier := &sshkeys.HostCertVerifier{
+		Authorities:   authorities,
+		ExpiryWarning: warn,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	results := make([]verifyHost, len(hosts))
+	forEachHost(ctx, hosts, hostOpts.parallel, func(ctx context.Context, i int, host string) {
+		results[i] = verifyHostCertificates(ctx, host, verifier, hostOpts.concurrent, timeout)
+	})
+
+	exitCode := verifyExitValid
+	for i := range results {
+		if code := results[i].exitCode(); verifyExitPriority[code] > verifyExitPriority[exitCode] {
+			exitCode = code
+		}
+	}
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			SchemaVersion int          `json:"schema_version"`
+			Hosts         []verifyHost `json:"hosts"`
+		}{sshkeys.SchemaVersion, results}); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode json: %s\n", err)
+			return verifyExitTrouble
+		}
+		return exitCode
+	}
+	for i := range results {
+		printVerifyHost(&results[i])
+	}
+	return exitCode
+}
+
+func loadCertAuthorities(file string) ([]sshkeys.CertAuthority, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open ca file: %w", err)
+	}
+	defer f.Close()
+	authorities, err := sshkeys.ParseCertAuthorities(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ca file: %w", err)
+	}
+	return authorities, nil
+}
+
+// certAlgorithms returns the certificate algorithms of DefaultKeyAlgorithms.
+func certAlgorithms() []string {
+	var algorithms []string
+	for _, algo := range sshkeys.DefaultKeyAlgorithms() {
+		if strings.Contains(algo, "-cert-") {
+			algorithms = append(algorithms, algo)
+		}
+	}
+	return algorithms
+}
+
+func verifyHostCertificates(
+	ctx context.Context, host string, verifier *sshkeys.HostCertVerifier, concurrent int, timeout time.Duration,
+) verifyHost {
+	result := verifyHost{Host: host, Certificates: []sshkeys.CertVerification{}}
+	target, err := sshkeys.ParseTarget(host)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Address = target.Address()
+	keys, err := sshkeys.GetKeys(ctx, result.Address, concurrent, timeout, certAlgorithms()...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var seen [][]byte
+	for _, algo := range certAlgorithms() {
+		cert, ok := keys[algo].(*ssh.Certificate)
+		if !ok {
+			continue
+		}
+		duplicate := false
+		for _, s := range seen {
+			if bytes.Equal(s, cert.Marshal()) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		seen = append(seen, cert.Marshal())
+		// the principals are checked against the host name, not the resolved address
+		result.Certificates = append(result.Certificates, verifier.Verify(net.JoinHostPort(target.Host, target.Port), cert))
+	}
+	return result
+}
+
+func printVerifyHost(result *verifyHost) {
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", result.Host, result.Error)
+		return
+	}
+	if len(result.Certificates) == 0 {
+		fmt.Printf("%s: no host certificate\n", result.Host)
+		return
+	}
+	for _, cert := range result.Certificates {
+		expires := "never expires"
+		if !cert.Forever {
+			expires = "expires " + cert.ValidBefore.Format(time.RFC3339)
+		}
+		switch {
+		case !cert.Valid:
+			fmt.Printf("%s %s: invalid, %s\n", result.Host, cert.Type, cert.Error)
+		case cert.Expiring:
+			fmt.Printf("%s %s: valid, key id %q, %s (expiring soon)\n", result.Host, cert.Type, cert.KeyID, expires)
+		default:
+			fmt.Printf("%s %s: valid, key id %q, %s\n", result.Host, cert.Type, cert.KeyID, expires)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package sshkeys
+
+import (
+	"sort"
+)
+
+// HostScan is the saved scan result of a single host.
+type HostScan struct {
+	// Host is the host that was scanned.
+	Host string
+	// Banner is the ssh version the host reported.
+	Banner string
+	// Keys maps each algorithm to the printable key the host returned for it.
+	Keys map[string]string
+	// Error is set if the scan of the host failed.
+	Error string
+}
+
+// KeyChange describes how the key of an algorithm changed between two scans.
+type KeyChange struct {
+	Algorithm string
+	Old       string `json:",omitempty"`
+	New       string `json:",omitempty"`
+}
+
+// HostDiff describes the differences of a host between two scans.
+type HostDiff struct {
+	Host string
+	// HostAdded is set if the host is only present in the new scan.
+	HostAdded bool `json:",omitempty"`
+	// HostRemoved is set if the host is only present in the old scan.
+	HostRemoved bool `json:",omitempty"`
+
+	OldBanner string `json:",omitempty"`
+	NewBanner string `json:",omitempty"`
+	OldError  string `json:",omitempty"`
+	NewError  string `json:",omitempty"`
+
+	Added   []KeyChange `json:",omitempty"`
+	Removed []KeyChange `json:",omitempty"`
+	Changed []KeyChange `json:",omitempty"`
+}
+
+// BannerChanged reports whether the banner of the host changed.
+func (d *HostDiff) BannerChanged() bool {
+	return d.OldBanner != d.NewBanner
+}
+
+// HasChanges reports whether anything changed for the host.
+func (d *HostDiff) HasChanges() bool {
+	return d.HostAdded || d.HostRemoved ||
+		d.BannerChanged() || d.OldError != d.NewError ||
+		len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Changed) > 0
+}
+
+// DiffScans compares two scans and returns the differences for every host that is present in at least one of them.
+// Hosts are returned in alphabetical order, unchanged hosts are included.
+func DiffScans(oldScans, newScans []HostScan) []HostDiff {
+	oldHosts := make(map[string]HostScan, len(oldScans))
+	for _, scan := range oldScans {
+		oldHosts[scan.Host] = scan
+	}
+	newHosts := make(map[string]HostScan, len(newScans))
+	for _, scan := range newScans {
+		newHosts[scan.Host] = scan
+	}
+
+	hosts := make([]string, 0, len(oldHosts)+len(newHosts))
+	for host := range oldHosts {
+		hosts = append(hosts, host)
+	}
+	for host := range newHosts {
+		if _, ok := oldHosts[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	diffs := make([]HostDiff, 0, len(hosts))
+	for _, host := range hosts {
+		oldScan, inOld := oldHosts[host]
+		newScan, inNew := newHosts[host]
+		d := diffHost(&oldScan, &newScan)
+		d.Host = host
+		d.HostAdded = !inOld
+		d.HostRemoved = !inNew
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+func diffHost(oldScan, newScan *HostScan) HostDiff {
+	d := HostDiff{
+		OldBanner: oldScan.Banner,
+		NewBanner: newScan.Banner,
+		OldError:  oldScan.Error,
+		NewError:  newScan.Error,
+	}
+
+	for algo, oldKey := range oldScan.Keys {
+		newKey, ok := newScan.Keys[algo]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, KeyChange{Algorithm: algo, Old: oldKey})
+		case oldKey != newKey:
+			d.Changed = append(d.Changed, KeyChange{Algorithm: algo, Old: oldKey, New: newKey})
+		}
+	}
+	for algo, newKey := range newScan.Keys {
+		if _, ok := oldScan.Keys[algo]; !ok {
+			d.Added = append(d.Added, KeyChange{Algorithm: algo, New: newKey})
+		}
+	}
+
+	sortKeyChanges(d.Added)
+	sortKeyChanges(d.Removed)
+	sortKeyChanges(d.Changed)
+	return d
+}
+
+func sortKeyChanges(changes []KeyChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Algorithm < changes[j].Algorithm
+	})
+}
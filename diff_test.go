@@ -0,0 +1,86 @@
+package sshkeys_test
+
+import (
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffScans(t *testing.T) {
+	t.Parallel()
+	oldScans := []sshkeys.HostScan{
+		{
+			Host:   "a:22",
+			Banner: "SSH-2.0-OpenSSH_8.9",
+			Keys: map[string]string{
+				"ssh-rsa":     "rsa-key",
+				"ssh-ed25519": "ed25519-key",
+				"ssh-dss":     "dss-key",
+			},
+		},
+		{
+			Host:   "b:22",
+			Banner: "SSH-2.0-OpenSSH_9.6",
+			Keys:   map[string]string{"ssh-ed25519": "b-key"},
+		},
+		{
+			Host:  "c:22",
+			Error: "connection refused",
+		},
+	}
+	newScans := []sshkeys.HostScan{
+		{
+			Host:   "a:22",
+			Banner: "SSH-2.0-OpenSSH_9.6",
+			Keys: map[string]string{
+				"ssh-rsa":             "rsa-key",
+				"ssh-ed25519":         "new-ed25519-key",
+				"ecdsa-sha2-nistp256": "ecdsa-key",
+			},
+		},
+		{
+			Host:   "b:22",
+			Banner: "SSH-2.0-OpenSSH_9.6",
+			Keys:   map[string]string{"ssh-ed25519": "b-key"},
+		},
+		{
+			Host:   "d:22",
+			Banner: "SSH-2.0-OpenSSH_9.6",
+			Keys:   map[string]string{"ssh-ed25519": "d-key"},
+		},
+	}
+
+	diffs := sshkeys.DiffScans(oldScans, newScans)
+	require.Equal(t, []sshkeys.HostDiff{
+		{
+			Host:      "a:22",
+			OldBanner: "SSH-2.0-OpenSSH_8.9",
+			NewBanner: "SSH-2.0-OpenSSH_9.6",
+			Added:     []sshkeys.KeyChange{{Algorithm: "ecdsa-sha2-nistp256", New: "ecdsa-key"}},
+			Removed:   []sshkeys.KeyChange{{Algorithm: "ssh-dss", Old: "dss-key"}},
+			Changed:   []sshkeys.KeyChange{{Algorithm: "ssh-ed25519", Old: "ed25519-key", New: "new-ed25519-key"}},
+		},
+		{
+			Host:      "b:22",
+			OldBanner: "SSH-2.0-OpenSSH_9.6",
+			NewBanner: "SSH-2.0-OpenSSH_9.6",
+		},
+		{
+			Host:        "c:22",
+			HostRemoved: true,
+			OldError:    "connection refused",
+		},
+		{
+			Host:      "d:22",
+			HostAdded: true,
+			NewBanner: "SSH-2.0-OpenSSH_9.6",
+			Added:     []sshkeys.KeyChange{{Algorithm: "ssh-ed25519", New: "d-key"}},
+		},
+	}, diffs)
+
+	require.True(t, diffs[0].HasChanges())
+	require.False(t, diffs[1].HasChanges())
+	require.True(t, diffs[2].HasChanges())
+	require.True(t, diffs[3].HasChanges())
+}
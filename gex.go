@@ -0,0 +1,184 @@
+package sshkeys
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Diffie-Hellman group exchange key exchanges of RFC 4419.
+const (
+	KexDHGEXSHA256 = "diffie-hellman-group-exchange-sha256"
+	KexDHGEXSHA1   = "diffie-hellman-group-exchange-sha1"
+)
+
+// message numbers of RFC 4419.
+const (
+	msgKexDHGEXGroup   = 31
+	msgKexDHGEXRequest = 34
+)
+
+// MinGEXModulusBits is the modulus size below which a group is considered weak.
+const MinGEXModulusBits = 2048
+
+// GEXRequest are the min, n (preferred) and max modulus sizes of SSH_MSG_KEX_DH_GEX_REQUEST.
+type GEXRequest struct {
+	Min uint32 `json:"min"`
+	N   uint32 `json:"n"`
+	Max uint32 `json:"max"`
+}
+
+func (r GEXRequest) String() string {
+	return fmt.Sprintf("%d/%d/%d", r.Min, r.N, r.Max)
+}
+
+// DefaultGEXRequests are the requests ProbeGEX sends if no requests were specified.
+var DefaultGEXRequests = []GEXRequest{
+	{Min: 1024, N: 1024, Max: 1024},
+	{Min: 1024, N: 1536, Max: 8192},
+	{Min: 1024, N: 2048, Max: 8192},
+	{Min: 2048, N: 3072, Max: 8192},
+	{Min: 4096, N: 4096, Max: 8192},
+	{Min: 8192, N: 8192, Max: 8192},
+}
+
+// GEXGroup is the group the server returned for a GEXRequest.
+type GEXGroup struct {
+	Request GEXRequest `json:"request"`
+	// Bits is the size of the prime.
+	Bits      int    `json:"bits,omitempty"`
+	Generator string `json:"generator,omitempty"`
+	// SafePrime is set if the modulus p and (p-1)/2 are prime.
+	SafePrime bool `json:"safe_prime"`
+	// Weak is set if the modulus has less than MinGEXModulusBits bits or is not a safe prime.
+	Weak bool `json:"weak"`
+	// Error is set if the server did not return a group, e.g. because it has no group of the requested size.
+	Error string `json:"error,omitempty"`
+}
+
+// GEXResult are the groups a server returned for the probed requests.
+type GEXResult struct {
+	Kex    string     `json:"kex"`
+	Groups []GEXGroup `json:"groups"`
+	// Weak is set if any returned group is weak.
+	Weak bool `json:"weak"`
+}
+
+// ProbeGEX sends one SSH_MSG_KEX_DH_GEX_REQUEST per request, each in its own connection, and records the
+// primes the server returns. diffie-hellman-group-exchange-sha256 is used, or diffie-hellman-group-exchange-sha1
+// if the server only offers that. nil is returned if the server offers no group exchange.
+// Every request may take up to timeout, a request that times out is recorded in GEXGroup.Error.
+// Specify requests to probe other sizes, if unsure use DefaultGEXRequests.
+func ProbeGEX(ctx context.Context, host string, timeout time.Duration, requests ...GEXRequest) (*GEXResult, error) {
+	algorithms, err := GetServerAlgorithms(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return probeGEX(ctx, host, algorithms, timeout, requests)
+}
+
+func probeGEX(
+	ctx context.Context,
+	host string,
+	algorithms *ServerAlgorithms,
+	timeout time.Duration,
+	requests []GEXRequest,
+) (*GEXResult, error) {
+	var result GEXResult
+	switch {
+	case containsString(algorithms.KexAlgorithms, KexDHGEXSHA256):
+		result.Kex = KexDHGEXSHA256
+	case containsString(algorithms.KexAlgorithms, KexDHGEXSHA1):
+		result.Kex = KexDHGEXSHA1
+	default:
+		return nil, nil
+	}
+	if len(requests) == 0 {
+		requests = DefaultGEXRequests
+	}
+
+	// servers return the same primes for different requests, the primality tests are done once per prime
+	safePrimes := make(map[string]bool)
+	for _, request := range requests {
+		group := GEXGroup{Request: request}
+		requestCtx, cancel := context.WithTimeout(ctx, timeout)
+		p, g, err := requestGEXGroup(requestCtx, host, result.Kex, request)
+		cancel()
+		if err != nil {
+			// only abort if the caller gave up, a server that does not answer a single request is recorded
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			group.Error = err.Error()
+			result.Groups = append(result.Groups, group)
+			continue
+		}
+		safe, ok := safePrimes[p.String()]
+		if !ok {
+			safe = isSafePrime(p)
+			safePrimes[p.String()] = safe
+		}
+		group.Bits = p.BitLen()
+		group.Generator = g.String()
+		group.SafePrime = safe
+		group.Weak = group.Bits < MinGEXModulusBits || !safe
+		result.Weak = result.Weak || group.Weak
+		result.Groups = append(result.Groups, group)
+	}
+	return &result, nil
+}
+
+// requestGEXGroup starts the group exchange kex and returns the prime and the generator of SSH_MSG_KEX_DH_GEX_GROUP.
+func requestGEXGroup(ctx context.Context, host, kex string, request GEXRequest) (p, g *big.Int, err error) {
+	t, err := dialTransport(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.Close()
+	if len(t.serverAlgorithms.HostKeyAlgorithms) == 0 {
+		return nil, nil, errors.New("server advertises no host key algorithm")
+	}
+	if err := t.writeKexInit(kex, t.serverAlgorithms.HostKeyAlgorithms[0]); err != nil {
+		return nil, nil, err
+	}
+	payload := []byte{msgKexDHGEXRequest}
+	payload = binary.BigEndian.AppendUint32(payload, request.Min)
+	payload = binary.BigEndian.AppendUint32(payload, request.N)
+	payload = binary.BigEndian.AppendUint32(payload, request.Max)
+	if err := t.writePacket(payload); err != nil {
+		return nil, nil, err
+	}
+	payload, err = t.readMessage()
+	if err != nil {
+		// the connection is closed once ctx is done, report why
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, err
+	}
+	if payload[0] != msgKexDHGEXGroup {
+		return nil, nil, fmt.Errorf("expected SSH_MSG_KEX_DH_GEX_GROUP, got message %d", payload[0])
+	}
+	pBytes, rest, ok := parseString(payload[1:])
+	if !ok {
+		return nil, nil, errors.New("SSH_MSG_KEX_DH_GEX_GROUP is malformed")
+	}
+	gBytes, _, ok := parseString(rest)
+	if !ok {
+		return nil, nil, errors.New("SSH_MSG_KEX_DH_GEX_GROUP is malformed")
+	}
+	return new(big.Int).SetBytes(pBytes), new(big.Int).SetBytes(gBytes), nil
+}
+
+// isSafePrime reports whether p and (p-1)/2 are prime.
+// ProbablyPrime(0) runs the Baillie-PSW test, which has no known false positives.
+func isSafePrime(p *big.Int) bool {
+	if p.Bit(0) == 0 || !p.ProbablyPrime(0) {
+		return false
+	}
+	q := new(big.Int).Rsh(p, 1)
+	return q.ProbablyPrime(0)
+}
@@ -0,0 +1,174 @@
+package sshkeys_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+// oakleyGroup2 is the 1024 bit safe prime of diffie-hellman-group1-sha1.
+var oakleyGroup2, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+func readTestPayload(r io.Reader) []byte {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil
+	}
+	packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil
+	}
+	return packet[1 : len(packet)-int(packet[0])]
+}
+
+// serveFakeGEX accepts connections on l and answers SSH_MSG_KEX_DH_GEX_REQUEST with group(n),
+// the connection is closed if group returns nil.
+func serveFakeGEX(l net.Listener, group func(n uint32) *big.Int) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			_, _ = io.WriteString(conn, "SSH-2.0-Fake\r\n")
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+			kexInit := append([]byte{20}, make([]byte, 16)...)
+			for _, list := range []string{
+				"curve25519-sha256," + sshkeys.KexDHGEXSHA256, "ssh-ed25519", "aes128-ctr", "aes128-ctr",
+				"hmac-sha2-256", "hmac-sha2-256", "none", "none", "", "",
+			} {
+				kexInit = appendTestString(kexInit, []byte(list))
+			}
+			kexInit = append(kexInit, 0, 0, 0, 0, 0)
+			writeTestPacket(conn, kexInit)
+
+			// the SSH_MSG_KEXINIT and SSH_MSG_KEX_DH_GEX_REQUEST of the client
+			if readTestPayload(r) == nil {
+				return
+			}
+			request := readTestPayload(r)
+			if len(request) != 13 || request[0] != 34 {
+				return
+			}
+			p := group(binary.BigEndian.Uint32(request[5:9]))
+			if p == nil {
+				return
+			}
+			reply := appendTestString([]byte{31}, p.Bytes())
+			reply = appendTestString(reply, []byte{2})
+			writeTestPacket(conn, reply)
+			_, _ = io.Copy(io.Discard, r)
+		}()
+	}
+}
+
+func TestProbeGEX(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// a prime that is not a safe prime
+	prime, err := rand.Prime(rand.Reader, 2048)
+	require.NoError(t, err)
+	for new(big.Int).Rsh(prime, 1).ProbablyPrime(0) {
+		prime, err = rand.Prime(rand.Reader, 2048)
+		require.NoError(t, err)
+	}
+	go serveFakeGEX(l, func(n uint32) *big.Int {
+		switch {
+		case n <= 1024:
+			return oakleyGroup2
+		case n == 2048:
+			return prime
+		default:
+			return nil
+		}
+	})
+
+	result, err := sshkeys.ProbeGEX(context.Background(), l.Addr().String(), time.Minute,
+		sshkeys.GEXRequest{Min: 1024, N: 1024, Max: 8192},
+		sshkeys.GEXRequest{Min: 2048, N: 2048, Max: 8192},
+		sshkeys.GEXRequest{Min: 8192, N: 8192, Max: 8192},
+	)
+	require.NoError(t, err)
+	require.Equal(t, sshkeys.KexDHGEXSHA256, result.Kex)
+	require.True(t, result.Weak)
+	require.Len(t, result.Groups, 3)
+
+	require.Equal(t, 1024, result.Groups[0].Bits)
+	require.Equal(t, "2", result.Groups[0].Generator)
+	require.True(t, result.Groups[0].SafePrime)
+	require.True(t, result.Groups[0].Weak)
+
+	require.Equal(t, 2048, result.Groups[1].Bits)
+	require.False(t, result.Groups[1].SafePrime)
+	require.True(t, result.Groups[1].Weak)
+
+	require.NotEmpty(t, result.Groups[2].Error)
+	require.False(t, result.Groups[2].Weak)
+}
+
+func TestProbeGEXNotOffered(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveFakeKex(l, "ssh-ed25519", ed448Blob)
+
+	result, err := sshkeys.ProbeGEX(context.Background(), l.Addr().String(), time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, result)
+}
+
+func TestProbeGEXTimeout(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go serveFakeGEX(l, func(n uint32) *big.Int {
+		if n == 2048 {
+			// never answer
+			<-done
+			return nil
+		}
+		return oakleyGroup2
+	})
+
+	result, err := sshkeys.ProbeGEX(context.Background(), l.Addr().String(), 500*time.Millisecond,
+		sshkeys.GEXRequest{Min: 1024, N: 1024, Max: 8192},
+		sshkeys.GEXRequest{Min: 2048, N: 2048, Max: 8192},
+		sshkeys.GEXRequest{Min: 1024, N: 1536, Max: 8192},
+	)
+	require.NoError(t, err)
+	require.Len(t, result.Groups, 3)
+	require.Equal(t, 1024, result.Groups[0].Bits)
+	require.Equal(t, context.DeadlineExceeded.Error(), result.Groups[1].Error)
+	require.Zero(t, result.Groups[1].Bits)
+	require.Equal(t, 1024, result.Groups[2].Bits)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sshkeys.ProbeGEX(ctx, l.Addr().String(), time.Minute)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,21 @@
+package sshkeys
+
+import (
+	"crypto/md5" //nolint: gosec // HASSH is defined as md5
+	"encoding/hex"
+	"strings"
+)
+
+// HASSHServer returns the HASSHServer fingerprint of the algorithms and the algorithm string it is computed from.
+// The algorithm string is kex;ciphers;macs;compression, with the server to client lists.
+// See https://github.com/salesforce/hassh.
+func (a *ServerAlgorithms) HASSHServer() (fingerprint, algorithms string) {
+	algorithms = strings.Join([]string{
+		strings.Join(a.KexAlgorithms, ","),
+		strings.Join(a.CiphersServerClient, ","),
+		strings.Join(a.MACsServerClient, ","),
+		strings.Join(a.CompressionServerClient, ","),
+	}, ";")
+	sum := md5.Sum([]byte(algorithms)) //nolint: gosec // HASSH is defined as md5
+	return hex.EncodeToString(sum[:]), algorithms
+}
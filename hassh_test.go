@@ -0,0 +1,68 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHASSHServer(t *testing.T) {
+	t.Parallel()
+	algorithms := sshkeys.ServerAlgorithms{
+		KexAlgorithms:           []string{"curve25519-sha256", "diffie-hellman-group14-sha256"},
+		CiphersClientServer:     []string{"chacha20-poly1305@openssh.com"},
+		CiphersServerClient:     []string{"aes128-ctr", "aes256-gcm@openssh.com"},
+		MACsClientServer:        []string{"hmac-sha1"},
+		MACsServerClient:        []string{"hmac-sha2-256"},
+		CompressionClientServer: []string{"none"},
+		CompressionServerClient: []string{"none", "zlib@openssh.com"},
+	}
+	fingerprint, algorithmString := algorithms.HASSHServer()
+	require.Equal(t,
+		"curve25519-sha256,diffie-hellman-group14-sha256;aes128-ctr,aes256-gcm@openssh.com;hmac-sha2-256;none,zlib@openssh.com",
+		algorithmString,
+	)
+	require.Equal(t, "7b3f76e580e44aea1e396d8af55a8228", fingerprint)
+}
+
+func TestScanHASSHServer(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateECKey},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	result, err := sshkeys.Scan(context.Background(), l.Addr().String(), sshkeys.ScanOptions{
+		ConcurrentWorkers: 1,
+		Timeout:           10 * time.Second,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, result.ServerAlgorithms)
+	fingerprint, algorithmString := result.ServerAlgorithms.HASSHServer()
+	require.Equal(t, fingerprint, result.HASSHServer)
+	require.Equal(t, algorithmString, result.HASSHServerAlgorithms)
+	require.Len(t, result.HASSHServer, 32)
+}
@@ -0,0 +1,227 @@
+package sshkeys
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// CertAuthorityMarker is the known_hosts marker of lines that trust a CA for host certificates.
+const CertAuthorityMarker = "@cert-authority"
+
+// CertAuthority is a CA that is trusted to sign host certificates for the hosts that match Patterns.
+type CertAuthority struct {
+	Key ssh.PublicKey
+	// Patterns are the host patterns of the known_hosts line, e.g. *.example.com or !bastion.example.com.
+	// A CA of a plain public key file is trusted for all hosts (*).
+	Patterns []string
+}
+
+// Matches reports whether the CA is trusted for addr (host:port).
+// The patterns are matched like known_hosts patterns: * and ? are wildcards, a leading ! negates the pattern
+// and hosts with a port other than 22 are matched as [host]:port.
+func (a *CertAuthority) Matches(addr string) bool {
+	host := knownhosts.Normalize(addr)
+	matched := false
+	for _, pattern := range a.Patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !wildcardMatch(strings.ToLower(pattern), strings.ToLower(host)) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// wildcardMatch matches s against pattern like ssh does: * matches any sequence and ? any single character,
+// all other characters, including [ and ] of [host]:port, match themselves.
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// ParseCertAuthorities reads trusted CAs from r. Every line is either a public key (e.g. the content of ca.pub),
+// which is trusted for all hosts, or a known_hosts line with the @cert-authority marker.
+// Other known_hosts lines, empty lines and comments are ignored.
+func ParseCertAuthorities(r io.Reader) ([]CertAuthority, error) {
+	var authorities []CertAuthority
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if line[0] != '@' {
+			key, _, options, _, err := ssh.ParseAuthorizedKey(line)
+			if err != nil || len(options) > 0 {
+				// a known_hosts line without marker, the hosts are parsed as options
+				continue
+			}
+			authorities = append(authorities, CertAuthority{Key: key, Patterns: []string{"*"}})
+			continue
+		}
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if marker != strings.TrimPrefix(CertAuthorityMarker, "@") {
+			continue
+		}
+		authorities = append(authorities, CertAuthority{Key: key, Patterns: hosts})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(authorities) == 0 {
+		return nil, errors.New("no certificate authority found")
+	}
+	return authorities, nil
+}
+
+// HostCertVerifier validates host certificates against trusted CAs.
+type HostCertVerifier struct {
+	Authorities []CertAuthority
+	// ExpiryWarning marks valid certificates that expire within this duration as expiring.
+	ExpiryWarning time.Duration
+	// Clock returns the current time, time.Now is used if nil.
+	Clock func() time.Time
+}
+
+// CertVerification is the result of the validation of a host certificate.
+type CertVerification struct {
+	Type                string    `json:"type"`
+	KeyID               string    `json:"key_id"`
+	Serial              uint64    `json:"serial"`
+	Principals          []string  `json:"principals"`
+	CAFingerprintSHA256 string    `json:"ca_fingerprint_sha256"`
+	ValidBefore         time.Time `json:"valid_before,omitempty"`
+	// Forever is set if the certificate does not expire.
+	Forever bool `json:"forever,omitempty"`
+	// Valid is set if the certificate is a host certificate for the host, signed by a trusted CA and currently valid.
+	Valid bool `json:"valid"`
+	// Expiring is set if the certificate is valid, but expires within HostCertVerifier.ExpiryWarning.
+	Expiring bool `json:"expiring,omitempty"`
+	// Error describes why the certificate is not valid.
+	Error string `json:"error,omitempty"`
+}
+
+// Verify validates cert for addr (host:port) with ssh.CertChecker: the certificate must be a host certificate,
+// signed by a CA that is trusted for addr, the host must be one of its principals and it must be valid now.
+func (v *HostCertVerifier) Verify(addr string, cert *ssh.Certificate) CertVerification {
+	now := time.Now()
+	if v.Clock != nil {
+		now = v.Clock()
+	}
+	result := CertVerification{
+		Type:                cert.Type(),
+		KeyID:               cert.KeyId,
+		Serial:              cert.Serial,
+		Principals:          cert.ValidPrincipals,
+		CAFingerprintSHA256: ssh.FingerprintSHA256(cert.SignatureKey),
+		Forever:             cert.ValidBefore == ssh.CertTimeInfinity,
+	}
+	if result.Principals == nil {
+		result.Principals = []string{}
+	}
+	if !result.Forever {
+		result.ValidBefore = time.Unix(int64(cert.ValidBefore), 0).UTC()
+	}
+
+	if cert.CertType != ssh.HostCert {
+		result.Error = "not a host certificate"
+		if cert.CertType == ssh.UserCert {
+			result.Error = "user certificate presented as host key"
+		}
+		return result
+	}
+
+	checker := ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			for i := range v.Authorities {
+				if bytes.Equal(v.Authorities[i].Key.Marshal(), auth.Marshal()) && v.Authorities[i].Matches(address) {
+					return true
+				}
+			}
+			return false
+		},
+		Clock: func() time.Time { return now },
+	}
+	if err := checker.CheckHostKey(addr, &net.TCPAddr{}, cert); err != nil {
+		result.Error = strings.TrimPrefix(err.Error(), "ssh: ")
+		return result
+	}
+	result.Valid = true
+	result.Expiring = !result.Forever && result.ValidBefore.Before(now.Add(v.ExpiryWarning))
+	return result
+}
+
+// HostCertOptions are the fields of the host certificates that SignHostKey issues.
+type HostCertOptions struct {
+	KeyID  string
+	Serial uint64
+	// Principals are the host names the certificate is valid for, a certificate without principals is valid for all hosts.
+	Principals []string
+	// ValidAfter and ValidBefore limit the validity window, the certificate is valid forever if ValidBefore is zero.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// SignHostKey issues a host certificate for key, signed by ca (like ssh-keygen -s ca -h).
+// RSA CAs sign with rsa-sha2-512, MultiAlgorithmSigners with their first algorithm.
+func SignHostKey(random io.Reader, ca ssh.Signer, key ssh.PublicKey, options *HostCertOptions) (*ssh.Certificate, error) {
+	if _, ok := key.(*ssh.Certificate); ok {
+		return nil, errors.New("key is already a certificate")
+	}
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.HostCert,
+		KeyId:           options.KeyID,
+		Serial:          options.Serial,
+		ValidPrincipals: options.Principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if !options.ValidAfter.IsZero() {
+		cert.ValidAfter = uint64(options.ValidAfter.Unix())
+	}
+	if !options.ValidBefore.IsZero() {
+		if options.ValidBefore.Before(options.ValidAfter) {
+			return nil, errors.New("certificate would expire before it becomes valid")
+		}
+		cert.ValidBefore = uint64(options.ValidBefore.Unix())
+	}
+	if err := cert.SignCert(random, ca); err != nil {
+		return nil, fmt.Errorf("unable to sign %s key: %w", key.Type(), err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,146 @@
+package sshkeys_test
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func newTestHostCert(t *testing.T, ca xssh.Signer, certType uint32, principals []string, validBefore time.Time) *xssh.Certificate {
+	t.Helper()
+	key, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	return signTestCert(t, ca, &xssh.Certificate{
+		Key:             key.PublicKey(),
+		CertType:        certType,
+		KeyId:           "test",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	})
+}
+
+// signTestCert signs cert with ca, the fields of cert must not be changed afterwards.
+func signTestCert(t *testing.T, ca xssh.Signer, cert *xssh.Certificate) *xssh.Certificate {
+	t.Helper()
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return cert
+}
+
+func TestParseCertAuthorities(t *testing.T) {
+	t.Parallel()
+	ca, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	caLine := strings.TrimSpace(string(xssh.MarshalAuthorizedKey(ca.PublicKey())))
+
+	authorities, err := sshkeys.ParseCertAuthorities(strings.NewReader(
+		"# comment\n" +
+			caLine + "\n" +
+			"@cert-authority *.example.com,!bastion.example.com " + caLine + "\n" +
+			"host.example.com " + caLine + "\n",
+	))
+	require.NoError(t, err)
+	require.Len(t, authorities, 2)
+	require.Equal(t, []string{"*"}, authorities[0].Patterns)
+	require.True(t, authorities[0].Matches("anything:22"))
+
+	require.True(t, authorities[1].Matches("web.example.com:22"))
+	require.False(t, authorities[1].Matches("bastion.example.com:22"))
+	require.False(t, authorities[1].Matches("web.example.org:22"))
+	require.False(t, authorities[1].Matches("web.example.com:2222"))
+
+	ported := sshkeys.CertAuthority{Key: ca.PublicKey(), Patterns: []string{"[*.example.com]:2222"}}
+	require.True(t, ported.Matches("web.example.com:2222"))
+	require.False(t, ported.Matches("web.example.com:22"))
+
+	_, err = sshkeys.ParseCertAuthorities(strings.NewReader("host.example.com " + caLine + "\n"))
+	require.Error(t, err)
+}
+
+func TestHostCertVerifier(t *testing.T) {
+	t.Parallel()
+	ca, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	otherCA, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	verifier := sshkeys.HostCertVerifier{
+		Authorities:   []sshkeys.CertAuthority{{Key: ca.PublicKey(), Patterns: []string{"*.example.com"}}},
+		ExpiryWarning: 7 * 24 * time.Hour,
+	}
+	inAYear := time.Now().Add(365 * 24 * time.Hour)
+
+	result := verifier.Verify("web.example.com:22", newTestHostCert(t, ca, xssh.HostCert, []string{"web.example.com"}, inAYear))
+	require.True(t, result.Valid, result.Error)
+	require.False(t, result.Expiring)
+	require.Equal(t, xssh.FingerprintSHA256(ca.PublicKey()), result.CAFingerprintSHA256)
+
+	result = verifier.Verify("web.example.com:22", newTestHostCert(t, ca, xssh.HostCert, []string{"web.example.com"}, time.Now().Add(time.Hour)))
+	require.True(t, result.Valid, result.Error)
+	require.True(t, result.Expiring)
+
+	tests := []struct {
+		name  string
+		addr  string
+		cert  *xssh.Certificate
+		error string
+	}{
+		{"principal", "db.example.com:22", newTestHostCert(t, ca, xssh.HostCert, []string{"web.example.com"}, inAYear), "principal"},
+		{"untrusted ca", "web.example.com:22", newTestHostCert(t, otherCA, xssh.HostCert, []string{"web.example.com"}, inAYear), "no authorities"},
+		{"ca pattern", "web.example.org:22", newTestHostCert(t, ca, xssh.HostCert, []string{"web.example.org"}, inAYear), "no authorities"},
+		{"expired", "web.example.com:22", newTestHostCert(t, ca, xssh.HostCert, []string{"web.example.com"}, time.Now().Add(-time.Minute)), "expired"},
+		{"user cert", "web.example.com:22", newTestHostCert(t, ca, xssh.UserCert, []string{"web.example.com"}, inAYear), "user certificate"},
+	}
+	for _, test := range tests {
+		result := verifier.Verify(test.addr, test.cert)
+		require.False(t, result.Valid, test.name)
+		require.Contains(t, result.Error, test.error, test.name)
+	}
+}
+
+func TestSignHostKey(t *testing.T) {
+	t.Parallel()
+	ca, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	key, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	now := time.Now()
+
+	cert, err := sshkeys.SignHostKey(rand.Reader, ca, key.PublicKey(), &sshkeys.HostCertOptions{
+		KeyID:       "web",
+		Serial:      42,
+		Principals:  []string{"web.example.com"},
+		ValidAfter:  now.Add(-time.Minute),
+		ValidBefore: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(xssh.HostCert), cert.CertType)
+	require.Equal(t, "web", cert.KeyId)
+	require.Equal(t, uint64(42), cert.Serial)
+	require.Equal(t, key.PublicKey().Marshal(), cert.Key.Marshal())
+
+	verifier := sshkeys.HostCertVerifier{
+		Authorities: []sshkeys.CertAuthority{{Key: ca.PublicKey(), Patterns: []string{"*"}}},
+	}
+	result := verifier.Verify("web.example.com:22", cert)
+	require.True(t, result.Valid, result.Error)
+	require.False(t, result.Forever)
+
+	cert, err = sshkeys.SignHostKey(rand.Reader, ca, key.PublicKey(), &sshkeys.HostCertOptions{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(xssh.CertTimeInfinity), cert.ValidBefore)
+
+	_, err = sshkeys.SignHostKey(rand.Reader, ca, cert, &sshkeys.HostCertOptions{})
+	require.Error(t, err)
+	_, err = sshkeys.SignHostKey(rand.Reader, ca, key.PublicKey(), &sshkeys.HostCertOptions{
+		ValidAfter:  now,
+		ValidBefore: now.Add(-time.Hour),
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package sshkeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// HostKeysRequest is the global request an OpenSSH server sends after the authentication (UpdateHostKeys).
+	HostKeysRequest = "hostkeys-00@openssh.com"
+	// HostKeysProveRequest is the global request that asks the server to prove the possession of its host keys.
+	HostKeysProveRequest = "hostkeys-prove-00@openssh.com"
+)
+
+// DefaultHostKeysWait is the time GetAnnouncedKeys waits for the hostkeys-00@openssh.com request if no wait was specified.
+const DefaultHostKeysWait = 5 * time.Second
+
+// AuthOptions configures the authenticated scan.
+type AuthOptions struct {
+	// User is the user to authenticate as.
+	User string
+	// Signers are used for the public key authentication, e.g. the keys of a key file or of the ssh-agent.
+	Signers []ssh.Signer
+	// Wait is the time to wait for the hostkeys-00@openssh.com request after the authentication,
+	// DefaultHostKeysWait is used if zero.
+	Wait time.Duration
+}
+
+// AnnouncedKey is a host key the server sent with hostkeys-00@openssh.com.
+type AnnouncedKey struct {
+	Key ssh.PublicKey
+	// Proven is set if the server proved the possession of the private key with hostkeys-prove-00@openssh.com.
+	// Keys of types golang.org/x/crypto/ssh does not support (RawPublicKey) can not be proven.
+	Proven bool
+}
+
+// GetAnnouncedKeys authenticates to host and returns all host keys the server announces with hostkeys-00@openssh.com.
+// The possession of each key is verified with hostkeys-prove-00@openssh.com, an error is returned if a proof is invalid.
+// Servers that do not announce their keys within options.Wait return no keys.
+func GetAnnouncedKeys(ctx context.Context, host string, options AuthOptions) ([]AnnouncedKey, error) {
+	if len(options.Signers) == 0 {
+		return nil, errors.New("no keys to authenticate with")
+	}
+	if options.Wait <= 0 {
+		options.Wait = DefaultHostKeysWait
+	}
+
+	conn, stop, err := dialContext(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	config := ssh.ClientConfig{
+		User: options.User,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(options.Signers...)},
+		// the keys are scanned, not trusted
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint: gosec // allow insecure host key callback
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, host, &config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer sshConn.Close()
+	go func() {
+		for ch := range chans {
+			_ = ch.Reject(ssh.Prohibited, "no channels are accepted")
+		}
+	}()
+
+	payload, err := waitForHostKeys(ctx, reqs, options.Wait)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	go ssh.DiscardRequests(reqs)
+
+	var blobs [][]byte
+	for rest := payload; len(rest) > 0; {
+		var blob []byte
+		var ok bool
+		if blob, rest, ok = parseString(rest); !ok {
+			return nil, fmt.Errorf("%s is malformed", HostKeysRequest)
+		}
+		blobs = append(blobs, blob)
+	}
+	return proveHostKeys(sshConn, blobs)
+}
+
+// waitForHostKeys returns the payload of the hostkeys-00@openssh.com request, nil is returned if the server did not send it.
+func waitForHostKeys(ctx context.Context, reqs <-chan *ssh.Request, wait time.Duration) ([]byte, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, nil
+		case req, ok := <-reqs:
+			if !ok {
+				return nil, errors.New("connection closed before the host keys were announced")
+			}
+			if req.Type == HostKeysRequest {
+				return req.Payload, nil
+			}
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// proveHostKeys asks the server to prove the possession of the keys and verifies the signatures.
+func proveHostKeys(conn ssh.Conn, blobs [][]byte) ([]AnnouncedKey, error) {
+	keys := make([]AnnouncedKey, 0, len(blobs))
+	var request []byte
+	for _, blob := range blobs {
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			if key, err = NewRawPublicKey(blob); err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, AnnouncedKey{Key: key})
+		request = appendString(request, blob)
+	}
+	if len(keys) == 0 {
+		return keys, nil
+	}
+
+	ok, reply, err := conn.SendRequest(HostKeysProveRequest, true, request)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("server refused %s", HostKeysProveRequest)
+	}
+	for i := range keys {
+		var sigBlob []byte
+		if sigBlob, reply, ok = parseString(reply); !ok {
+			return nil, fmt.Errorf("%s reply is malformed", HostKeysProveRequest)
+		}
+		if _, raw := keys[i].Key.(*RawPublicKey); raw {
+			continue
+		}
+		format, rest, ok := parseString(sigBlob)
+		if !ok {
+			return nil, fmt.Errorf("%s signature is malformed", HostKeysProveRequest)
+		}
+		sig, _, ok := parseString(rest)
+		if !ok {
+			return nil, fmt.Errorf("%s signature is malformed", HostKeysProveRequest)
+		}
+		data := appendString(nil, []byte(HostKeysProveRequest))
+		data = appendString(data, conn.SessionID())
+		data = appendString(data, blobs[i])
+		if err := keys[i].Key.Verify(data, &ssh.Signature{Format: string(format), Blob: sig}); err != nil {
+			return nil, fmt.Errorf("invalid proof for %s key %s: %w", keys[i].Key.Type(), ssh.FingerprintSHA256(keys[i].Key), err)
+		}
+		keys[i].Proven = true
+	}
+	return keys, nil
+}
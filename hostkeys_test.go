@@ -0,0 +1,195 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveHostKeys accepts connections on l, authenticates clientKey and announces the keys of hostKeys.
+// If forge is set the proofs are signed with the wrong session id.
+func serveHostKeys(l net.Listener, clientKey ssh.PublicKey, hostKeys []ssh.Signer, forge bool) {
+	config := ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() != "scanner" || string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return &ssh.Permissions{}, nil
+		},
+	}
+	config.AddHostKey(hostKeys[0])
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			sshConn, chans, reqs, err := ssh.NewServerConn(conn, &config)
+			if err != nil {
+				return
+			}
+			go func() {
+				for ch := range chans {
+					_ = ch.Reject(ssh.Prohibited, "")
+				}
+			}()
+
+			var announce []byte
+			for _, hostKey := range hostKeys {
+				announce = appendTestString(announce, hostKey.PublicKey().Marshal())
+			}
+			if _, _, err := sshConn.SendRequest(sshkeys.HostKeysRequest, false, announce); err != nil {
+				return
+			}
+			for req := range reqs {
+				if req.Type != sshkeys.HostKeysProveRequest {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				sessionID := sshConn.SessionID()
+				if forge {
+					sessionID = make([]byte, len(sessionID))
+				}
+				var reply []byte
+				for _, hostKey := range hostKeys {
+					data := appendTestString(nil, []byte(sshkeys.HostKeysProveRequest))
+					data = appendTestString(data, sessionID)
+					data = appendTestString(data, hostKey.PublicKey().Marshal())
+					sig, err := hostKey.Sign(rand.Reader, data)
+					if err != nil {
+						_ = req.Reply(false, nil)
+						return
+					}
+					reply = appendTestString(reply, ssh.Marshal(sig))
+				}
+				_ = req.Reply(true, reply)
+			}
+		}()
+	}
+}
+
+func TestGetAnnouncedKeys(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	clientKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	hostRSAKey, err := createRSAKey(2048)
+	require.NoError(t, err)
+	hostECKey, err := createECDSAKey(elliptic.P384())
+	require.NoError(t, err)
+	go serveHostKeys(l, clientKey.PublicKey(), []ssh.Signer{hostRSAKey, hostECKey}, false)
+
+	keys, err := sshkeys.GetAnnouncedKeys(context.Background(), l.Addr().String(), sshkeys.AuthOptions{
+		User:    "scanner",
+		Signers: []ssh.Signer{clientKey},
+	})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, hostRSAKey.PublicKey().Marshal(), keys[0].Key.Marshal())
+	require.True(t, keys[0].Proven)
+	require.Equal(t, hostECKey.PublicKey().Marshal(), keys[1].Key.Marshal())
+	require.True(t, keys[1].Proven)
+
+	// the announced keys are merged with the keys of the scan
+	result, err := sshkeys.Scan(context.Background(), l.Addr().String(), sshkeys.ScanOptions{
+		ConcurrentWorkers: 4,
+		Timeout:           10 * time.Second,
+		Algorithms:        []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoECDSA384},
+		Auth: &sshkeys.AuthOptions{
+			User:    "scanner",
+			Signers: []ssh.Signer{clientKey},
+		},
+	})
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.Keys, 2)
+	// only the rsa key is used for the key exchange, the ecdsa key was only announced
+	require.Equal(t, ssh.KeyAlgoECDSA384, result.Keys[0].Type)
+	require.Empty(t, result.Keys[0].Algorithms)
+	require.True(t, result.Keys[0].Announced)
+	require.True(t, result.Keys[0].Proven)
+	require.Equal(t, []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512}, result.Keys[1].Algorithms)
+	require.True(t, result.Keys[1].Announced)
+	require.True(t, result.Keys[1].Proven)
+}
+
+func TestGetAnnouncedKeysInvalidProof(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	clientKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	hostKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	go serveHostKeys(l, clientKey.PublicKey(), []ssh.Signer{hostKey}, true)
+
+	_, err = sshkeys.GetAnnouncedKeys(context.Background(), l.Addr().String(), sshkeys.AuthOptions{
+		User:    "scanner",
+		Signers: []ssh.Signer{clientKey},
+	})
+	require.ErrorContains(t, err, "invalid proof")
+}
+
+func TestGetAnnouncedKeysAuthFailure(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	clientKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	otherKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	hostKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	go serveHostKeys(l, clientKey.PublicKey(), []ssh.Signer{hostKey}, false)
+
+	_, err = sshkeys.GetAnnouncedKeys(context.Background(), l.Addr().String(), sshkeys.AuthOptions{
+		User:    "scanner",
+		Signers: []ssh.Signer{otherKey},
+	})
+	require.ErrorContains(t, err, "unable to authenticate")
+}
+
+func TestMergeAnnouncedKeys(t *testing.T) {
+	t.Parallel()
+	rsaKey, err := createRSAKey(2048)
+	require.NoError(t, err)
+	ecKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	keys, err := sshkeys.GroupKeys(map[string]ssh.PublicKey{ssh.KeyAlgoRSASHA512: rsaKey.PublicKey()})
+	require.NoError(t, err)
+	result := sshkeys.HostResult{Keys: keys}
+	require.NoError(t, result.MergeAnnouncedKeys([]sshkeys.AnnouncedKey{
+		{Key: rsaKey.PublicKey(), Proven: true},
+		{Key: ecKey.PublicKey(), Proven: false},
+	}))
+	require.Len(t, result.Keys, 2)
+	require.Equal(t, ssh.KeyAlgoECDSA256, result.Keys[0].Type)
+	require.Empty(t, result.Keys[0].Algorithms)
+	require.True(t, result.Keys[0].Announced)
+	require.False(t, result.Keys[0].Proven)
+	require.Equal(t, []string{ssh.KeyAlgoRSASHA512}, result.Keys[1].Algorithms)
+	require.True(t, result.Keys[1].Announced)
+	require.True(t, result.Keys[1].Proven)
+
+	buf, err := json.Marshal(result.Keys[0])
+	require.NoError(t, err)
+	require.Contains(t, string(buf), `"algorithms":[],`)
+	require.Contains(t, string(buf), `"announced":true`)
+}
@@ -0,0 +1,584 @@
+package sshkeys
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" //nolint: gosec // hashed known_hosts entries use HMAC-SHA1
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Actions of a KnownHostsChange.
+const (
+	KnownHostsAdded    = "added"
+	KnownHostsRemoved  = "removed"
+	KnownHostsReplaced = "replaced"
+)
+
+// KnownHostsFile is a known_hosts file that is updated in place: lines that are not changed,
+// including comments, markers and lines that can not be parsed, are written as they were read.
+type KnownHostsFile struct {
+	lines    []*knownHostsLine
+	original []string
+}
+
+type knownHostsLine struct {
+	text   string
+	marker string
+	hosts  []string
+	// rest is the text after the hosts field, the key and its comment.
+	rest string
+	key  ssh.PublicKey
+	// number is the line number in the parsed file, 0 for added lines.
+	number int
+}
+
+// KnownHostsEntry is a line of a known_hosts file that matches a host, see KnownHostsFile.Lookup.
+type KnownHostsEntry struct {
+	// Line is the line number in the parsed file, 0 for added lines.
+	Line   int
+	Marker string
+	Hosts  []string
+	Key    ssh.PublicKey
+	// Hashed is set if the host matched a hashed entry (|1|salt|hash).
+	Hashed bool
+}
+
+// KnownHostsChange is a key of a host that was added, removed or replaced by KnownHostsFile.Update or Remove.
+type KnownHostsChange struct {
+	Host                 string `json:"host"`
+	Action               string `json:"action"`
+	Type                 string `json:"type"`
+	FingerprintSHA256    string `json:"fingerprint_sha256"`
+	OldFingerprintSHA256 string `json:"old_fingerprint_sha256,omitempty"`
+}
+
+func (c KnownHostsChange) String() string {
+	if c.Action == KnownHostsReplaced {
+		return fmt.Sprintf("%s: replaced %s %s with %s", c.Host, c.Type, c.OldFingerprintSHA256, c.FingerprintSHA256)
+	}
+	return fmt.Sprintf("%s: %s %s %s", c.Host, c.Action, c.Type, c.FingerprintSHA256)
+}
+
+// ParseKnownHostsFile parses the content of a known_hosts file.
+func ParseKnownHostsFile(data []byte) *KnownHostsFile {
+	var f KnownHostsFile
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return &f
+	}
+	f.original = strings.Split(text, "\n")
+	for i, line := range f.original {
+		l := parseKnownHostsLine(line)
+		l.number = i + 1
+		f.lines = append(f.lines, l)
+	}
+	return &f
+}
+
+func parseKnownHostsLine(text string) *knownHostsLine {
+	l := &knownHostsLine{text: text}
+	rest := strings.TrimLeft(text, " \t")
+	if rest == "" || rest[0] == '#' {
+		return l
+	}
+	field, rest := nextKnownHostsField(rest)
+	if strings.HasPrefix(field, "@") {
+		l.marker = field
+		field, rest = nextKnownHostsField(rest)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+	if field == "" || err != nil {
+		return l
+	}
+	l.hosts = strings.Split(field, ",")
+	l.rest = rest
+	l.key = key
+	return l
+}
+
+func nextKnownHostsField(s string) (field, rest string) {
+	s = strings.TrimLeft(s, " \t")
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// matchKnownHost reports whether the hosts entry is exactly host (normalized) or its hash.
+// Wildcard and negated patterns are not matched, they are left to the user.
+func matchKnownHost(entry, host string) (matched, hashed bool) {
+	if !strings.HasPrefix(entry, "|") {
+		return strings.EqualFold(entry, host), false
+	}
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 || parts[1] != "1" { //nolint: gomnd // |1|salt|hash
+		return false, false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash), true
+}
+
+// matches returns the indexes of the hosts entries of l that match host.
+func (l *knownHostsLine) matches(host string) (indexes []int, hashed bool) {
+	for i, entry := range l.hosts {
+		if ok, h := matchKnownHost(entry, host); ok {
+			indexes = append(indexes, i)
+			hashed = hashed || h
+		}
+	}
+	return indexes, hashed
+}
+
+// Lookup returns the lines that contain addr (host:port or host), like ssh-keygen -F.
+// Lines with markers (@cert-authority, @revoked) are returned if they list the host explicitly.
+func (f *KnownHostsFile) Lookup(addr string) []KnownHostsEntry {
+	host := knownhosts.Normalize(addr)
+	var entries []KnownHostsEntry
+	for _, l := range f.lines {
+		if l.key == nil {
+			continue
+		}
+		if indexes, hashed := l.matches(host); len(indexes) > 0 {
+			entries = append(entries, KnownHostsEntry{
+				Line:   l.number,
+				Marker: l.marker,
+				Hosts:  append([]string(nil), l.hosts...),
+				Key:    l.key,
+				Hashed: hashed,
+			})
+		}
+	}
+	return entries
+}
+
+// Remove removes the keys of addr (host:port or host), like ssh-keygen -R.
+// Lines that list other hosts as well keep the other hosts. Lines with markers are not changed.
+func (f *KnownHostsFile) Remove(addr string) []KnownHostsChange {
+	return f.Update(addr, nil, false)
+}
+
+// Update replaces the keys of addr (host:port or host) with keys: keys that are missing are added,
+// keys that are no longer in keys are removed, a removed key of the type of an added key is reported as replaced.
+// Certificates in keys are ignored, hosts with certificates are trusted with @cert-authority lines.
+// New lines are added after the existing lines of the host or at the end of the file,
+// the host is hashed if hash is set or if the host was found hashed.
+// Lines with markers, wildcard patterns and keys that can not be parsed are not changed.
+func (f *KnownHostsFile) Update(addr string, keys []ssh.PublicKey, hash bool) []KnownHostsChange {
+	host := knownhosts.Normalize(addr)
+	var scanned []ssh.PublicKey
+	for _, key := range keys {
+		if _, ok := key.(*ssh.Certificate); ok || containsKey(scanned, key) {
+			continue
+		}
+		scanned = append(scanned, key)
+	}
+
+	var present, removed []ssh.PublicKey
+	lines := make([]*knownHostsLine, 0, len(f.lines))
+	insertAt := -1
+	for _, l := range f.lines {
+		if l.marker != "" || l.key == nil {
+			lines = append(lines, l)
+			continue
+		}
+		indexes, hashed := l.matches(host)
+		if len(indexes) == 0 {
+			lines = append(lines, l)
+			continue
+		}
+		hash = hash || hashed
+		if containsKey(scanned, l.key) {
+			present = append(present, l.key)
+			lines = append(lines, l)
+			insertAt = len(lines)
+			continue
+		}
+		removed = append(removed, l.key)
+		if len(indexes) < len(l.hosts) {
+			// keep the other hosts of the line
+			var hosts []string
+			for i, entry := range l.hosts {
+				if !containsInt(indexes, i) {
+					hosts = append(hosts, entry)
+				}
+			}
+			updated := *l
+			updated.hosts = hosts
+			indent := l.text[:len(l.text)-len(strings.TrimLeft(l.text, " \t"))]
+			updated.text = indent + strings.Join(hosts, ",") + l.rest
+			lines = append(lines, &updated)
+		}
+		insertAt = len(lines)
+	}
+
+	var added []ssh.PublicKey
+	var newLines []*knownHostsLine
+	for _, key := range scanned {
+		if containsKey(present, key) {
+			continue
+		}
+		added = append(added, key)
+		name := host
+		if hash {
+			name = knownhosts.HashHostname(host)
+		}
+		newLines = append(newLines, parseKnownHostsLine(knownhosts.Line([]string{name}, key)))
+	}
+	if insertAt < 0 {
+		insertAt = len(lines)
+	}
+	lines = append(lines[:insertAt], append(newLines, lines[insertAt:]...)...)
+	f.lines = lines
+
+	return knownHostsChanges(host, added, removed)
+}
+
+// Hosts returns the hosts of the lines without markers in the order of the file, as host or [host]:port.
+// Hashed entries can not be reversed, they are returned as the candidates (host:port or host) that match them,
+// unmatched is the number of hashed entries no candidate matched. Wildcard and negated patterns are skipped.
+func (f *KnownHostsFile) Hosts(candidates ...string) (hosts []string, unmatched int) {
+	normalized := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		normalized[i] = knownhosts.Normalize(candidate)
+	}
+	seen := make(map[string]struct{})
+	add := func(host string) {
+		if _, ok := seen[knownhosts.Normalize(host)]; !ok {
+			seen[knownhosts.Normalize(host)] = struct{}{}
+			hosts = append(hosts, host)
+		}
+	}
+	for _, l := range f.lines {
+		if l.marker != "" || l.key == nil {
+			continue
+		}
+		for _, entry := range l.hosts {
+			if strings.HasPrefix(entry, "!") || strings.ContainsAny(entry, "*?") {
+				continue
+			}
+			if !strings.HasPrefix(entry, "|") {
+				add(strings.ToLower(entry))
+				continue
+			}
+			found := false
+			for _, candidate := range normalized {
+				if ok, _ := matchKnownHost(entry, candidate); ok {
+					add(candidate)
+					found = true
+				}
+			}
+			if !found {
+				unmatched++
+			}
+		}
+	}
+	return hosts, unmatched
+}
+
+// KnownHostsAudit compares the keys of a host in a known_hosts file with the keys the host offers, see KnownHostsFile.Audit.
+type KnownHostsAudit struct {
+	Host string `json:"host"`
+	// Lines are the line numbers of the keys of the host.
+	Lines []int `json:"lines"`
+	// Stale are the recorded keys the host no longer offers.
+	Stale []KnownHostsAuditKey `json:"stale,omitempty"`
+	// Missing are the offered keys that are not recorded.
+	Missing []KnownHostsAuditKey `json:"missing,omitempty"`
+}
+
+// KnownHostsAuditKey is a key of a KnownHostsAudit.
+type KnownHostsAuditKey struct {
+	// Line is the line of a stale key.
+	Line              int    `json:"line,omitempty"`
+	Type              string `json:"type"`
+	Bits              int    `json:"bits,omitempty"`
+	FingerprintSHA256 string `json:"fingerprint_sha256"`
+	// Stronger is set for missing keys of a stronger type than every recorded key.
+	Stronger bool `json:"stronger,omitempty"`
+}
+
+// UpToDate reports whether the recorded keys are the offered keys.
+func (a *KnownHostsAudit) UpToDate() bool {
+	return len(a.Stale) == 0 && len(a.Missing) == 0
+}
+
+// Audit compares the keys of addr (host:port or host) with keys, the keys the host offers, without changing the file.
+// Certificates in keys and lines with markers are ignored.
+func (f *KnownHostsFile) Audit(addr string, keys []ssh.PublicKey) KnownHostsAudit {
+	audit := KnownHostsAudit{Host: knownhosts.Normalize(addr)}
+	var recorded []ssh.PublicKey
+	strongest := 0
+	for _, l := range f.lines {
+		if l.marker != "" || l.key == nil {
+			continue
+		}
+		if indexes, _ := l.matches(audit.Host); len(indexes) == 0 {
+			continue
+		}
+		audit.Lines = append(audit.Lines, l.number)
+		recorded = append(recorded, l.key)
+		if strength := keyStrength(l.key); strength > strongest {
+			strongest = strength
+		}
+		if !containsKey(keys, l.key) {
+			audit.Stale = append(audit.Stale, newKnownHostsAuditKey(l.number, l.key))
+		}
+	}
+	for _, key := range keys {
+		if _, ok := key.(*ssh.Certificate); ok || containsKey(recorded, key) {
+			continue
+		}
+		recorded = append(recorded, key)
+		missing := newKnownHostsAuditKey(0, key)
+		missing.Stronger = keyStrength(key) > strongest
+		audit.Missing = append(audit.Missing, missing)
+	}
+	return audit
+}
+
+func newKnownHostsAuditKey(line int, key ssh.PublicKey) KnownHostsAuditKey {
+	return KnownHostsAuditKey{
+		Line:              line,
+		Type:              key.Type(),
+		Bits:              KeyBits(key),
+		FingerprintSHA256: ssh.FingerprintSHA256(key),
+	}
+}
+
+// keyStrength ranks the type and size of key: dsa and rsa keys below 2048 bits are the weakest,
+// followed by rsa, rsa with at least 3072 bits and ecdsa, and ed25519. Unknown key types rank 0.
+func keyStrength(key ssh.PublicKey) int {
+	switch key.Type() {
+	case ssh.KeyAlgoDSA:
+		return 1
+	case ssh.KeyAlgoRSA:
+		switch bits := KeyBits(key); {
+		case bits >= 3072: //nolint: gomnd // NIST recommendation
+			return 3
+		case bits >= 2048: //nolint: gomnd // NIST recommendation
+			return 2
+		default:
+			return 1
+		}
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, ssh.KeyAlgoSKECDSA256:
+		return 3 //nolint: gomnd // rank
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519:
+		return 4 //nolint: gomnd // rank
+	default:
+		return 0
+	}
+}
+
+func knownHostsChanges(host string, added, removed []ssh.PublicKey) []KnownHostsChange {
+	var changes []KnownHostsChange
+	used := make([]bool, len(removed))
+	for _, key := range added {
+		change := KnownHostsChange{
+			Host:              host,
+			Action:            KnownHostsAdded,
+			Type:              key.Type(),
+			FingerprintSHA256: ssh.FingerprintSHA256(key),
+		}
+		for i, old := range removed {
+			if !used[i] && old.Type() == key.Type() {
+				used[i] = true
+				change.Action = KnownHostsReplaced
+				change.OldFingerprintSHA256 = ssh.FingerprintSHA256(old)
+				break
+			}
+		}
+		changes = append(changes, change)
+	}
+	for i, key := range removed {
+		if used[i] {
+			continue
+		}
+		changes = append(changes, KnownHostsChange{
+			Host:              host,
+			Action:            KnownHostsRemoved,
+			Type:              key.Type(),
+			FingerprintSHA256: ssh.FingerprintSHA256(key),
+		})
+	}
+	return changes
+}
+
+// Bytes returns the content of the file.
+func (f *KnownHostsFile) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, l := range f.lines {
+		buf.WriteString(l.text)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// Changed reports whether the file differs from the parsed file.
+func (f *KnownHostsFile) Changed() bool {
+	if len(f.lines) != len(f.original) {
+		return true
+	}
+	for i, l := range f.lines {
+		if l.number != i+1 || l.text != f.original[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// diffLine is a line of a unified diff, kind is ' ', '-' or '+'.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// Diff returns the changes as unified diff with three lines of context, name is used in the file headers.
+// An empty string is returned if the file did not change.
+func (f *KnownHostsFile) Diff(name string) string {
+	if !f.Changed() {
+		return ""
+	}
+	var ops []diffLine
+	next := 1
+	for _, l := range f.lines {
+		if l.number == 0 {
+			ops = append(ops, diffLine{'+', l.text})
+			continue
+		}
+		for ; next < l.number; next++ {
+			ops = append(ops, diffLine{'-', f.original[next-1]})
+		}
+		if l.text == f.original[l.number-1] {
+			ops = append(ops, diffLine{' ', l.text})
+		} else {
+			ops = append(ops, diffLine{'-', f.original[l.number-1]}, diffLine{'+', l.text})
+		}
+		next = l.number + 1
+	}
+	for ; next <= len(f.original); next++ {
+		ops = append(ops, diffLine{'-', f.original[next-1]})
+	}
+	// like diff, removed lines come before added lines in every block of changes
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		sort.SliceStable(ops[i:j], func(a, b int) bool {
+			return ops[i+a].kind == '-' && ops[i+b].kind == '+'
+		})
+		i = j
+	}
+
+	const context = 3
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", name, name)
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			oldLine++
+			newLine++
+			continue
+		}
+		// a hunk starts with up to three lines of context and ends after three unchanged lines
+		start := i
+		for start > 0 && i-start < context && ops[start-1].kind == ' ' {
+			start--
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			unchanged := 0
+			for end+unchanged < len(ops) && ops[end+unchanged].kind == ' ' {
+				unchanged++
+			}
+			if end+unchanged == len(ops) || unchanged > 2*context {
+				if unchanged > context {
+					unchanged = context
+				}
+				end += unchanged
+				break
+			}
+			end += unchanged
+		}
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.text)
+			buf.WriteByte('\n')
+		}
+		for _, op := range ops[i:end] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+// hunkRange formats the range of a hunk header, empty ranges start at the line before.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, i int) bool {
+	for _, v := range list {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
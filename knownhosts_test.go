@@ -0,0 +1,194 @@
+package sshkeys_test
+
+import (
+	"crypto/elliptic"
+	"strings"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestPublicKeys(t *testing.T, n int) ([]xssh.PublicKey, []string) {
+	t.Helper()
+	keys := make([]xssh.PublicKey, n)
+	lines := make([]string, n)
+	for i := range keys {
+		signer, err := createECDSAKey(elliptic.P256())
+		require.NoError(t, err)
+		keys[i] = signer.PublicKey()
+		lines[i] = strings.TrimSpace(string(xssh.MarshalAuthorizedKey(keys[i])))
+	}
+	return keys, lines
+}
+
+func TestKnownHostsFileUpdate(t *testing.T) {
+	t.Parallel()
+	keys, k := newTestPublicKeys(t, 4)
+	p384, err := createECDSAKey(elliptic.P384())
+	require.NoError(t, err)
+	p384Key := p384.PublicKey()
+	p384Line := strings.TrimSpace(string(xssh.MarshalAuthorizedKey(p384Key)))
+
+	original := strings.Join([]string{
+		"# fleet",
+		"web.example.com " + k[0] + " old",
+		"web.example.com,10.0.0.1 " + p384Line,
+		"*.example.com " + k[1],
+		"@cert-authority web.example.com " + k[1],
+		"@revoked web.example.com " + k[0],
+		"db.example.com " + k[2],
+		"broken line",
+		"",
+	}, "\n") + "\n"
+	f := sshkeys.ParseKnownHostsFile([]byte(original))
+	require.False(t, f.Changed())
+	require.Len(t, f.Lookup("web.example.com:22"), 4)
+
+	// the ecdsa key was replaced, the p384 key is no longer offered
+	changes := f.Update("web.example.com:22", []xssh.PublicKey{keys[3]}, false)
+	require.Equal(t, []sshkeys.KnownHostsChange{
+		{
+			Host:                 "web.example.com",
+			Action:               sshkeys.KnownHostsReplaced,
+			Type:                 keys[3].Type(),
+			FingerprintSHA256:    xssh.FingerprintSHA256(keys[3]),
+			OldFingerprintSHA256: xssh.FingerprintSHA256(keys[0]),
+		},
+		{
+			Host:              "web.example.com",
+			Action:            sshkeys.KnownHostsRemoved,
+			Type:              p384Key.Type(),
+			FingerprintSHA256: xssh.FingerprintSHA256(p384Key),
+		},
+	}, changes)
+	require.True(t, f.Changed())
+	require.Equal(t, strings.Join([]string{
+		"# fleet",
+		"10.0.0.1 " + p384Line,
+		"web.example.com " + k[3],
+		"*.example.com " + k[1],
+		"@cert-authority web.example.com " + k[1],
+		"@revoked web.example.com " + k[0],
+		"db.example.com " + k[2],
+		"broken line",
+		"",
+	}, "\n")+"\n", string(f.Bytes()))
+
+	require.Equal(t, strings.Join([]string{
+		"--- known_hosts",
+		"+++ known_hosts",
+		"@@ -1,6 +1,6 @@",
+		" # fleet",
+		"-web.example.com " + k[0] + " old",
+		"-web.example.com,10.0.0.1 " + p384Line,
+		"+10.0.0.1 " + p384Line,
+		"+web.example.com " + k[3],
+		" *.example.com " + k[1],
+		" @cert-authority web.example.com " + k[1],
+		" @revoked web.example.com " + k[0],
+		"",
+	}, "\n"), f.Diff("known_hosts"))
+
+	// an up to date host is not changed
+	require.Empty(t, f.Update("db.example.com", []xssh.PublicKey{keys[2]}, false))
+	require.Empty(t, f.Remove("unknown.example.com"))
+
+	// new hosts are appended
+	changes = f.Update("[new.example.com]:2222", []xssh.PublicKey{keys[0]}, false)
+	require.Len(t, changes, 1)
+	require.Equal(t, sshkeys.KnownHostsAdded, changes[0].Action)
+	require.True(t, strings.HasSuffix(string(f.Bytes()), "broken line\n\n[new.example.com]:2222 "+k[0]+"\n"))
+
+	// removed lines are listed before the lines that replace them
+	f = sshkeys.ParseKnownHostsFile([]byte("web.example.com " + k[0] + "\n"))
+	f.Update("web.example.com", []xssh.PublicKey{keys[1]}, false)
+	require.Equal(t, "--- known_hosts\n+++ known_hosts\n@@ -1 +1 @@\n"+
+		"-web.example.com "+k[0]+"\n+web.example.com "+k[1]+"\n", f.Diff("known_hosts"))
+}
+
+func TestKnownHostsFileHashed(t *testing.T) {
+	t.Parallel()
+	keys, k := newTestPublicKeys(t, 3)
+	original := knownhosts.HashHostname("web.example.com") + " " + k[0] + "\n" +
+		knownhosts.HashHostname("[web.example.com]:2222") + " " + k[1] + "\n"
+	f := sshkeys.ParseKnownHostsFile([]byte(original))
+
+	entries := f.Lookup("web.example.com")
+	require.Len(t, entries, 1)
+	require.True(t, entries[0].Hashed)
+	require.Equal(t, 1, entries[0].Line)
+
+	// hosts that were hashed stay hashed
+	changes := f.Update("web.example.com", []xssh.PublicKey{keys[0], keys[2]}, false)
+	require.Len(t, changes, 1)
+	require.Equal(t, sshkeys.KnownHostsAdded, changes[0].Action)
+	lines := strings.Split(strings.TrimSpace(string(f.Bytes())), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[1], "|1|"))
+	require.True(t, strings.HasSuffix(lines[1], k[2]))
+	require.Len(t, f.Lookup("web.example.com:22"), 2)
+
+	changes = f.Remove("web.example.com:2222")
+	require.Len(t, changes, 1)
+	require.Equal(t, sshkeys.KnownHostsRemoved, changes[0].Action)
+	require.Empty(t, f.Lookup("[web.example.com]:2222"))
+
+	// new hosts are hashed if requested
+	f = sshkeys.ParseKnownHostsFile(nil)
+	f.Update("db.example.com", []xssh.PublicKey{keys[0]}, true)
+	require.True(t, strings.HasPrefix(string(f.Bytes()), "|1|"))
+	require.Len(t, f.Lookup("db.example.com"), 1)
+}
+
+func TestKnownHostsFileAudit(t *testing.T) {
+	t.Parallel()
+	keys, k := newTestPublicKeys(t, 3)
+	rsa, err := createRSAKey(1024)
+	require.NoError(t, err)
+	rsaKey := rsa.PublicKey()
+	rsaLine := strings.TrimSpace(string(xssh.MarshalAuthorizedKey(rsaKey)))
+
+	f := sshkeys.ParseKnownHostsFile([]byte(strings.Join([]string{
+		"web.example.com,10.0.0.1 " + rsaLine,
+		"Web.example.com " + k[0],
+		"*.example.com,!db.example.com " + k[1],
+		"@cert-authority ca.example.com " + k[1],
+		knownhosts.HashHostname("[db.example.com]:2222") + " " + k[2],
+		knownhosts.HashHostname("unknown.example.com") + " " + k[2],
+	}, "\n")))
+
+	hosts, unmatched := f.Hosts("db.example.com:2222", "other.example.com")
+	require.Equal(t, []string{"web.example.com", "10.0.0.1", "[db.example.com]:2222"}, hosts)
+	require.Equal(t, 1, unmatched)
+
+	// the rsa key was replaced by a stronger ecdsa key
+	audit := f.Audit("web.example.com:22", []xssh.PublicKey{keys[0], keys[1]})
+	require.False(t, audit.UpToDate())
+	require.Equal(t, "web.example.com", audit.Host)
+	require.Equal(t, []int{1, 2}, audit.Lines)
+	require.Equal(t, []sshkeys.KnownHostsAuditKey{{
+		Line:              1,
+		Type:              rsaKey.Type(),
+		Bits:              1024,
+		FingerprintSHA256: xssh.FingerprintSHA256(rsaKey),
+	}}, audit.Stale)
+	require.Equal(t, []sshkeys.KnownHostsAuditKey{{
+		Type:              keys[1].Type(),
+		Bits:              256,
+		FingerprintSHA256: xssh.FingerprintSHA256(keys[1]),
+	}}, audit.Missing)
+
+	// a missing key is stronger than every recorded key
+	audit = f.Audit("10.0.0.1", []xssh.PublicKey{rsaKey, keys[0]})
+	require.Empty(t, audit.Stale)
+	require.Len(t, audit.Missing, 1)
+	require.True(t, audit.Missing[0].Stronger)
+
+	audit = f.Audit("[db.example.com]:2222", []xssh.PublicKey{keys[2]})
+	require.True(t, audit.UpToDate())
+	require.Equal(t, []int{5}, audit.Lines)
+	require.False(t, f.Changed())
+}
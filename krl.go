@@ -0,0 +1,493 @@
+package sshkeys
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint: gosec // KRLs revoke keys by their SHA1 hash
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// krlMagic is "SSHKRL\n\0", the magic of the OpenSSH Key Revocation List format (PROTOCOL.krl).
+const (
+	krlMagic         = 0x5353484b524c0a00
+	krlFormatVersion = 1
+)
+
+// section types of PROTOCOL.krl.
+const (
+	krlSectionCertificates      = 1
+	krlSectionExplicitKey       = 2
+	krlSectionFingerprintSHA1   = 3
+	krlSectionSignature         = 4
+	krlSectionFingerprintSHA256 = 5
+
+	krlSectionCertSerialList   = 0x20
+	krlSectionCertSerialRange  = 0x21
+	krlSectionCertSerialBitmap = 0x22
+	krlSectionCertKeyID        = 0x23
+)
+
+// KRL is an OpenSSH Key Revocation List, as written by ssh-keygen -k and read by sshd's RevokedKeys.
+// Signatures of signed KRLs are skipped when parsing and are not written.
+type KRL struct {
+	// Version is the krl_version, ssh-keygen uses the generation date by default.
+	Version       uint64
+	GeneratedDate time.Time
+	Comment       string
+	// Keys are revoked explicitly. Revoking a key also revokes its certificates and,
+	// if it is a CA, the certificates it signed.
+	Keys []ssh.PublicKey
+	// SHA1 and SHA256 are the raw hashes of revoked key blobs.
+	SHA1   [][]byte
+	SHA256 [][]byte
+	// Certificates revoke certificates by serial or key id.
+	Certificates []*KRLCertificates
+}
+
+// KRLCertificates revokes the certificates of a CA.
+type KRLCertificates struct {
+	// CA is the key of the CA, nil revokes the certificates of every CA.
+	CA      ssh.PublicKey
+	Serials []KRLSerialRange
+	KeyIDs  []string
+}
+
+// KRLSerialRange revokes the certificate serials from Min to Max, both inclusive.
+type KRLSerialRange struct {
+	Min uint64
+	Max uint64
+}
+
+// RevokeKey revokes key explicitly. Certificates are revoked like ssh-keygen does:
+// by their serial, or by their key id if the serial is 0.
+func (k *KRL) RevokeKey(key ssh.PublicKey) {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		if cert.Serial != 0 {
+			_ = k.RevokeSerials(cert.SignatureKey, cert.Serial, cert.Serial)
+			return
+		}
+		k.RevokeKeyID(cert.SignatureKey, cert.KeyId)
+		return
+	}
+	for _, revoked := range k.Keys {
+		if bytes.Equal(revoked.Marshal(), key.Marshal()) {
+			return
+		}
+	}
+	k.Keys = append(k.Keys, key)
+}
+
+// RevokeSHA1 revokes key by the SHA1 hash of its blob.
+func (k *KRL) RevokeSHA1(key ssh.PublicKey) {
+	hash := sha1.Sum(plainKey(key).Marshal()) //nolint: gosec // KRLs revoke keys by their SHA1 hash
+	k.SHA1 = appendHash(k.SHA1, hash[:])
+}
+
+// RevokeSHA256 revokes key by the SHA256 hash of its blob.
+func (k *KRL) RevokeSHA256(key ssh.PublicKey) {
+	hash := sha256.Sum256(plainKey(key).Marshal())
+	k.SHA256 = appendHash(k.SHA256, hash[:])
+}
+
+// RevokeFingerprintSHA256 revokes the key of a SHA256 fingerprint (SHA256:<base64>).
+func (k *KRL) RevokeFingerprintSHA256(fingerprint string) error {
+	hash, err := decodeFingerprintSHA256(fingerprint)
+	if err != nil {
+		return err
+	}
+	k.SHA256 = appendHash(k.SHA256, hash)
+	return nil
+}
+
+// RevokeSerials revokes the certificates of ca with a serial from min to max, a nil ca revokes them for every CA.
+func (k *KRL) RevokeSerials(ca ssh.PublicKey, min, max uint64) error {
+	if min > max {
+		return fmt.Errorf("serial range %d-%d is invalid", min, max)
+	}
+	if min == 0 {
+		return errors.New("serial 0 can not be revoked")
+	}
+	certs := k.certificates(ca)
+	certs.Serials = append(certs.Serials, KRLSerialRange{Min: min, Max: max})
+	return nil
+}
+
+// RevokeKeyID revokes the certificates of ca with the key id, a nil ca revokes them for every CA.
+func (k *KRL) RevokeKeyID(ca ssh.PublicKey, keyID string) {
+	certs := k.certificates(ca)
+	for _, id := range certs.KeyIDs {
+		if id == keyID {
+			return
+		}
+	}
+	certs.KeyIDs = append(certs.KeyIDs, keyID)
+}
+
+// certificates returns the revoked certificates of ca, the entry is created if it does not exist.
+func (k *KRL) certificates(ca ssh.PublicKey) *KRLCertificates {
+	for _, certs := range k.Certificates {
+		if sameKey(certs.CA, ca) {
+			return certs
+		}
+	}
+	if ca != nil {
+		ca = plainKey(ca)
+	}
+	certs := &KRLCertificates{CA: ca}
+	k.Certificates = append(k.Certificates, certs)
+	return certs
+}
+
+// IsRevoked reports whether key is revoked and why.
+// Like sshd a certificate is also revoked if its plain key or the key of its CA is revoked.
+func (k *KRL) IsRevoked(key ssh.PublicKey) (revoked bool, reason string) {
+	if reason := k.keyRevoked(plainKey(key)); reason != "" {
+		return true, reason
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return false, ""
+	}
+	if reason := k.keyRevoked(cert.SignatureKey); reason != "" {
+		return true, "ca " + reason
+	}
+	for _, certs := range k.Certificates {
+		if certs.CA != nil && !sameKey(certs.CA, cert.SignatureKey) {
+			continue
+		}
+		for _, id := range certs.KeyIDs {
+			if id == cert.KeyId {
+				return true, fmt.Sprintf("certificate key id %q revoked", cert.KeyId)
+			}
+		}
+		// certificates with serial 0 can only be revoked by key id
+		if cert.Serial == 0 {
+			continue
+		}
+		for _, serials := range certs.Serials {
+			if cert.Serial >= serials.Min && cert.Serial <= serials.Max {
+				return true, fmt.Sprintf("certificate serial %d revoked", cert.Serial)
+			}
+		}
+	}
+	return false, ""
+}
+
+func (k *KRL) keyRevoked(key ssh.PublicKey) string {
+	blob := key.Marshal()
+	for _, revoked := range k.Keys {
+		if bytes.Equal(revoked.Marshal(), blob) {
+			return "key revoked"
+		}
+	}
+	sha1Hash := sha1.Sum(blob) //nolint: gosec // KRLs revoke keys by their SHA1 hash
+	for _, hash := range k.SHA1 {
+		if bytes.Equal(hash, sha1Hash[:]) {
+			return "sha1 hash revoked"
+		}
+	}
+	sha256Hash := sha256.Sum256(blob)
+	for _, hash := range k.SHA256 {
+		if bytes.Equal(hash, sha256Hash[:]) {
+			return "sha256 hash revoked"
+		}
+	}
+	return ""
+}
+
+// Marshal encodes the KRL in the binary format of PROTOCOL.krl.
+// Keys, hashes, serials and key ids are written sorted, single serials as serial list and others as ranges.
+func (k *KRL) Marshal() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, krlMagic)
+	buf = binary.BigEndian.AppendUint32(buf, krlFormatVersion)
+	buf = binary.BigEndian.AppendUint64(buf, k.Version)
+	var generated uint64
+	if !k.GeneratedDate.IsZero() {
+		generated = uint64(k.GeneratedDate.Unix())
+	}
+	buf = binary.BigEndian.AppendUint64(buf, generated)
+	buf = binary.BigEndian.AppendUint64(buf, 0) // flags
+	buf = appendString(buf, nil)                // reserved
+	buf = appendString(buf, []byte(k.Comment))
+
+	for _, certs := range k.Certificates {
+		var section []byte
+		if certs.CA != nil {
+			section = appendString(section, certs.CA.Marshal())
+		} else {
+			section = appendString(section, nil)
+		}
+		section = appendString(section, nil) // reserved
+
+		ranges := append([]KRLSerialRange(nil), certs.Serials...)
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].Min < ranges[j].Min })
+		var list []byte
+		for _, r := range ranges {
+			if r.Min == r.Max {
+				list = binary.BigEndian.AppendUint64(list, r.Min)
+				continue
+			}
+			var data []byte
+			data = binary.BigEndian.AppendUint64(data, r.Min)
+			data = binary.BigEndian.AppendUint64(data, r.Max)
+			section = append(section, krlSectionCertSerialRange)
+			section = appendString(section, data)
+		}
+		if len(list) > 0 {
+			section = append(section, krlSectionCertSerialList)
+			section = appendString(section, list)
+		}
+		if len(certs.KeyIDs) > 0 {
+			ids := append([]string(nil), certs.KeyIDs...)
+			sort.Strings(ids)
+			var data []byte
+			for _, id := range ids {
+				data = appendString(data, []byte(id))
+			}
+			section = append(section, krlSectionCertKeyID)
+			section = appendString(section, data)
+		}
+		buf = append(buf, krlSectionCertificates)
+		buf = appendString(buf, section)
+	}
+
+	blobs := make([][]byte, len(k.Keys))
+	for i := range k.Keys {
+		blobs[i] = k.Keys[i].Marshal()
+	}
+	buf = appendBlobSection(buf, krlSectionExplicitKey, blobs)
+	buf = appendBlobSection(buf, krlSectionFingerprintSHA1, k.SHA1)
+	buf = appendBlobSection(buf, krlSectionFingerprintSHA256, k.SHA256)
+	return buf
+}
+
+func appendBlobSection(buf []byte, sectionType byte, blobs [][]byte) []byte {
+	if len(blobs) == 0 {
+		return buf
+	}
+	sorted := append([][]byte(nil), blobs...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	var section []byte
+	for _, blob := range sorted {
+		section = appendString(section, blob)
+	}
+	buf = append(buf, sectionType)
+	return appendString(buf, section)
+}
+
+// ParseKRL parses a KRL in the binary format of PROTOCOL.krl.
+func ParseKRL(data []byte) (*KRL, error) {
+	const headerSize = 8 + 4 + 8 + 8 + 8
+	if len(data) < headerSize || binary.BigEndian.Uint64(data) != krlMagic {
+		return nil, errors.New("not a KRL")
+	}
+	if version := binary.BigEndian.Uint32(data[8:]); version != krlFormatVersion {
+		return nil, fmt.Errorf("KRL format version %d is not supported", version)
+	}
+	krl := KRL{Version: binary.BigEndian.Uint64(data[12:])}
+	if generated := binary.BigEndian.Uint64(data[20:]); generated != 0 {
+		krl.GeneratedDate = time.Unix(int64(generated), 0).UTC()
+	}
+	_, rest, ok := parseString(data[headerSize:]) // reserved
+	if !ok {
+		return nil, errors.New("KRL header is malformed")
+	}
+	comment, rest, ok := parseString(rest)
+	if !ok {
+		return nil, errors.New("KRL header is malformed")
+	}
+	krl.Comment = string(comment)
+	data = rest
+
+	for len(data) > 0 {
+		sectionType := data[0]
+		section, rest, ok := parseString(data[1:])
+		if !ok {
+			return nil, fmt.Errorf("KRL section %d is malformed", sectionType)
+		}
+		data = rest
+		var err error
+		switch sectionType {
+		case krlSectionCertificates:
+			err = krl.parseCertificates(section)
+		case krlSectionExplicitKey:
+			err = parseBlobSection(section, 0, func(blob []byte) error {
+				key, err := ssh.ParsePublicKey(blob)
+				if err != nil {
+					if key, err = NewRawPublicKey(blob); err != nil {
+						return err
+					}
+				}
+				krl.Keys = append(krl.Keys, key)
+				return nil
+			})
+		case krlSectionFingerprintSHA1:
+			err = parseBlobSection(section, sha1.Size, func(hash []byte) error {
+				krl.SHA1 = append(krl.SHA1, hash)
+				return nil
+			})
+		case krlSectionFingerprintSHA256:
+			err = parseBlobSection(section, sha256.Size, func(hash []byte) error {
+				krl.SHA256 = append(krl.SHA256, hash)
+				return nil
+			})
+		case krlSectionSignature:
+			// the signatures cover everything before them, they are the last sections
+			return &krl, nil
+		default:
+			err = fmt.Errorf("unknown section type %d", sectionType)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("KRL section %d: %w", sectionType, err)
+		}
+	}
+	return &krl, nil
+}
+
+func parseBlobSection(section []byte, size int, add func(blob []byte) error) error {
+	for len(section) > 0 {
+		blob, rest, ok := parseString(section)
+		if !ok {
+			return errors.New("malformed entry")
+		}
+		if size != 0 && len(blob) != size {
+			return fmt.Errorf("entry has %d bytes, expected %d", len(blob), size)
+		}
+		if err := add(append([]byte(nil), blob...)); err != nil {
+			return err
+		}
+		section = rest
+	}
+	return nil
+}
+
+func (k *KRL) parseCertificates(section []byte) error {
+	caBlob, rest, ok := parseString(section)
+	if !ok {
+		return errors.New("malformed ca key")
+	}
+	if _, rest, ok = parseString(rest); !ok { // reserved
+		return errors.New("malformed reserved field")
+	}
+	certs := &KRLCertificates{}
+	if len(caBlob) > 0 {
+		ca, err := ssh.ParsePublicKey(caBlob)
+		if err != nil {
+			return fmt.Errorf("unable to parse ca key: %w", err)
+		}
+		certs.CA = ca
+	}
+
+	for len(rest) > 0 {
+		subType := rest[0]
+		data, next, ok := parseString(rest[1:])
+		if !ok {
+			return fmt.Errorf("certificate section %#x is malformed", subType)
+		}
+		rest = next
+		switch subType {
+		case krlSectionCertSerialList:
+			if len(data)%8 != 0 {
+				return errors.New("serial list is malformed")
+			}
+			for ; len(data) > 0; data = data[8:] {
+				serial := binary.BigEndian.Uint64(data)
+				certs.Serials = append(certs.Serials, KRLSerialRange{Min: serial, Max: serial})
+			}
+		case krlSectionCertSerialRange:
+			if len(data) != 16 { //nolint: gomnd // two uint64
+				return errors.New("serial range is malformed")
+			}
+			certs.Serials = append(certs.Serials, KRLSerialRange{
+				Min: binary.BigEndian.Uint64(data),
+				Max: binary.BigEndian.Uint64(data[8:]),
+			})
+		case krlSectionCertSerialBitmap:
+			if len(data) < 8 { //nolint: gomnd // uint64 offset
+				return errors.New("serial bitmap is malformed")
+			}
+			offset := binary.BigEndian.Uint64(data)
+			bitmap, _, ok := parseString(data[8:])
+			if !ok {
+				return errors.New("serial bitmap is malformed")
+			}
+			certs.Serials = append(certs.Serials, bitmapSerialRanges(offset, new(big.Int).SetBytes(bitmap))...)
+		case krlSectionCertKeyID:
+			for len(data) > 0 {
+				id, next, ok := parseString(data)
+				if !ok {
+					return errors.New("key id list is malformed")
+				}
+				certs.KeyIDs = append(certs.KeyIDs, string(id))
+				data = next
+			}
+		default:
+			return fmt.Errorf("unknown certificate section type %#x", subType)
+		}
+	}
+	k.Certificates = append(k.Certificates, certs)
+	return nil
+}
+
+// bitmapSerialRanges converts a serial bitmap, bit i revokes serial offset+i, to ranges.
+func bitmapSerialRanges(offset uint64, bitmap *big.Int) []KRLSerialRange {
+	var ranges []KRLSerialRange
+	for i := 0; i < bitmap.BitLen(); i++ {
+		if bitmap.Bit(i) == 0 {
+			continue
+		}
+		serial := offset + uint64(i)
+		if n := len(ranges); n > 0 && ranges[n-1].Max+1 == serial {
+			ranges[n-1].Max = serial
+			continue
+		}
+		ranges = append(ranges, KRLSerialRange{Min: serial, Max: serial})
+	}
+	return ranges
+}
+
+// plainKey returns the certified key of certificates and key otherwise.
+func plainKey(key ssh.PublicKey) ssh.PublicKey {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key
+	}
+	return key
+}
+
+func sameKey(a, b ssh.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+// decodeFingerprintSHA256 returns the hash of a SHA256:<base64> fingerprint.
+func decodeFingerprintSHA256(fingerprint string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(fingerprint, "SHA256:")
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a SHA256 fingerprint", fingerprint)
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("'%s' is not a SHA256 fingerprint", fingerprint)
+	}
+	return hash, nil
+}
+
+func appendHash(hashes [][]byte, hash []byte) [][]byte {
+	for _, h := range hashes {
+		if bytes.Equal(h, hash) {
+			return hashes
+		}
+	}
+	return append(hashes, hash)
+}
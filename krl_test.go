@@ -0,0 +1,197 @@
+package sshkeys_test
+
+import (
+	"crypto/elliptic"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+// newTestSerialCert creates a host certificate for key with keyID and serial, a new key is used if key is nil.
+func newTestSerialCert(t *testing.T, ca xssh.Signer, key xssh.PublicKey, keyID string, serial uint64) *xssh.Certificate {
+	t.Helper()
+	if key == nil {
+		signer, err := createECDSAKey(elliptic.P256())
+		require.NoError(t, err)
+		key = signer.PublicKey()
+	}
+	return signTestCert(t, ca, &xssh.Certificate{
+		Key:             key,
+		Serial:          serial,
+		CertType:        xssh.HostCert,
+		KeyId:           keyID,
+		ValidPrincipals: []string{"web.example.com"},
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	})
+}
+
+func TestKRLIsRevoked(t *testing.T) {
+	t.Parallel()
+	ca, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	otherCA, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	keys := make([]xssh.Signer, 4)
+	for i := range keys {
+		keys[i], err = createECDSAKey(elliptic.P256())
+		require.NoError(t, err)
+	}
+
+	var krl sshkeys.KRL
+	krl.RevokeKey(keys[0].PublicKey())
+	krl.RevokeSHA1(keys[1].PublicKey())
+	krl.RevokeSHA256(keys[2].PublicKey())
+	require.NoError(t, krl.RevokeSerials(ca.PublicKey(), 10, 20))
+	krl.RevokeKeyID(ca.PublicKey(), "compromised")
+	krl.RevokeKeyID(nil, "everywhere")
+	require.Error(t, krl.RevokeSerials(ca.PublicKey(), 5, 4))
+	require.Error(t, krl.RevokeSerials(ca.PublicKey(), 0, 4))
+
+	tests := []struct {
+		name   string
+		key    xssh.PublicKey
+		reason string
+	}{
+		{"explicit key", keys[0].PublicKey(), "key revoked"},
+		{"sha1", keys[1].PublicKey(), "sha1 hash revoked"},
+		{"sha256", keys[2].PublicKey(), "sha256 hash revoked"},
+		{"valid key", keys[3].PublicKey(), ""},
+		{"serial", newTestSerialCert(t, ca, nil, "web", 15), "certificate serial 15 revoked"},
+		{"serial of other ca", newTestSerialCert(t, otherCA, nil, "web", 15), ""},
+		{"serial outside range", newTestSerialCert(t, ca, nil, "web", 21), ""},
+		{"key id", newTestSerialCert(t, ca, nil, "compromised", 1), `certificate key id "compromised" revoked`},
+		{"wildcard key id", newTestSerialCert(t, otherCA, nil, "everywhere", 1), `certificate key id "everywhere" revoked`},
+		{"revoked plain key", newTestSerialCert(t, otherCA, keys[0].PublicKey(), "web", 1), "key revoked"},
+	}
+	checker := xssh.CertChecker{}
+	for _, test := range tests {
+		if cert, ok := test.key.(*xssh.Certificate); ok {
+			require.NoError(t, checker.CheckCert("web.example.com", cert), test.name)
+		}
+		revoked, reason := krl.IsRevoked(test.key)
+		require.Equal(t, test.reason != "", revoked, test.name)
+		require.Equal(t, test.reason, reason, test.name)
+	}
+
+	var caKRL sshkeys.KRL
+	caKRL.RevokeKey(otherCA.PublicKey())
+	_, reason := caKRL.IsRevoked(newTestSerialCert(t, otherCA, nil, "web", 1))
+	require.Equal(t, "ca key revoked", reason)
+
+	// certificates are revoked by serial, or by key id if they have none
+	var certKRL sshkeys.KRL
+	certKRL.RevokeKey(newTestSerialCert(t, ca, nil, "web", 7))
+	certKRL.RevokeKey(newTestSerialCert(t, ca, nil, "db", 0))
+	require.Len(t, certKRL.Keys, 0)
+	require.Equal(t, []sshkeys.KRLSerialRange{{Min: 7, Max: 7}}, certKRL.Certificates[0].Serials)
+	require.Equal(t, []string{"db"}, certKRL.Certificates[0].KeyIDs)
+}
+
+func TestKRLMarshal(t *testing.T) {
+	t.Parallel()
+	ca, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	key, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	krl := sshkeys.KRL{
+		Version:       3,
+		GeneratedDate: time.Unix(1700000000, 0).UTC(),
+		Comment:       "decommissioned",
+	}
+	krl.RevokeKey(key.PublicKey())
+	krl.RevokeSHA1(key.PublicKey())
+	krl.RevokeSHA256(key.PublicKey())
+	require.NoError(t, krl.RevokeFingerprintSHA256(xssh.FingerprintSHA256(ca.PublicKey())))
+	require.Error(t, krl.RevokeFingerprintSHA256("MD5:00"))
+	require.NoError(t, krl.RevokeSerials(ca.PublicKey(), 100, 200))
+	require.NoError(t, krl.RevokeSerials(ca.PublicKey(), 5, 5))
+	krl.RevokeKeyID(nil, "old")
+
+	parsed, err := sshkeys.ParseKRL(krl.Marshal())
+	require.NoError(t, err)
+	require.Equal(t, krl.Version, parsed.Version)
+	require.Equal(t, krl.GeneratedDate, parsed.GeneratedDate)
+	require.Equal(t, krl.Comment, parsed.Comment)
+	require.Len(t, parsed.Keys, 1)
+	require.Equal(t, key.PublicKey().Marshal(), parsed.Keys[0].Marshal())
+	require.Equal(t, krl.SHA1, parsed.SHA1)
+	require.ElementsMatch(t, krl.SHA256, parsed.SHA256)
+	require.Len(t, parsed.Certificates, 2)
+	require.Equal(t, ca.PublicKey().Marshal(), parsed.Certificates[0].CA.Marshal())
+	require.ElementsMatch(t, []sshkeys.KRLSerialRange{{Min: 5, Max: 5}, {Min: 100, Max: 200}}, parsed.Certificates[0].Serials)
+	require.Nil(t, parsed.Certificates[1].CA)
+	require.Equal(t, []string{"old"}, parsed.Certificates[1].KeyIDs)
+
+	_, err = sshkeys.ParseKRL([]byte("not a krl"))
+	require.Error(t, err)
+	_, err = sshkeys.ParseKRL(krl.Marshal()[:40])
+	require.Error(t, err)
+}
+
+// TestParseKRLBitmap parses a serial bitmap section, which ssh-keygen writes for dense serials.
+func TestParseKRLBitmap(t *testing.T) {
+	t.Parallel()
+	appendString := func(b, s []byte) []byte {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+	data := binary.BigEndian.AppendUint64(nil, 0x5353484b524c0a00)
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = binary.BigEndian.AppendUint64(data, 0)
+	data = binary.BigEndian.AppendUint64(data, 0)
+	data = binary.BigEndian.AppendUint64(data, 0)
+	data = appendString(data, nil)
+	data = appendString(data, nil)
+
+	// serials 100, 101, 102 and 104
+	bitmap := binary.BigEndian.AppendUint64(nil, 100)
+	bitmap = appendString(bitmap, []byte{0x17})
+	section := appendString(nil, nil) // any ca
+	section = appendString(section, nil)
+	section = append(section, 0x22)
+	section = appendString(section, bitmap)
+	data = append(data, 1)
+	data = appendString(data, section)
+
+	krl, err := sshkeys.ParseKRL(data)
+	require.NoError(t, err)
+	require.Len(t, krl.Certificates, 1)
+	require.Equal(t, []sshkeys.KRLSerialRange{{Min: 100, Max: 102}, {Min: 104, Max: 104}}, krl.Certificates[0].Serials)
+}
+
+func TestHostResultCheckRevoked(t *testing.T) {
+	t.Parallel()
+	key, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	other, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	var krl sshkeys.KRL
+	krl.RevokeKey(key.PublicKey())
+
+	result := sshkeys.HostResult{}
+	for _, k := range []xssh.PublicKey{key.PublicKey(), other.PublicKey()} {
+		keyResult, err := sshkeys.NewKeyResult(k)
+		require.NoError(t, err)
+		result.Keys = append(result.Keys, keyResult)
+	}
+	revoked, err := result.CheckRevoked(&krl)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	require.Equal(t, "key revoked", result.Keys[0].Revoked)
+	require.Empty(t, result.Keys[1].Revoked)
+
+	// keys that can not be parsed do not stop the check of the other keys
+	result.Keys = append([]sshkeys.KeyResult{{AuthorizedKey: "ssh-ed25519 invalid"}}, result.Keys...)
+	result.Keys[1].Revoked = ""
+	revoked, err = result.CheckRevoked(&krl)
+	require.Error(t, err)
+	require.True(t, revoked)
+	require.Len(t, result.Keys, 3)
+	require.Equal(t, "key revoked", result.Keys[1].Revoked)
+}
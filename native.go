@@ -0,0 +1,197 @@
+package sshkeys
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NativeKexAlgorithms are the key exchanges the native transport can start, in preference order.
+var NativeKexAlgorithms = []string{
+	"curve25519-sha256",
+	"curve25519-sha256@libssh.org",
+	"ecdh-sha2-nistp256",
+	"ecdh-sha2-nistp384",
+	"ecdh-sha2-nistp521",
+	"diffie-hellman-group14-sha256",
+	"diffie-hellman-group14-sha1",
+	"diffie-hellman-group1-sha1",
+}
+
+// oakleyGroup2 is the group of diffie-hellman-group1-sha1 (RFC 2409).
+var oakleyGroup2, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+// oakleyGroup14 is the group of diffie-hellman-group14-sha1 and diffie-hellman-group14-sha256 (RFC 3526).
+var oakleyGroup14, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05"+
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB"+
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718"+
+		"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+
+// GetHostKeyNative fetches the host key of algo with the native transport.
+// Unlike GetKeys it works for every host key algorithm, as long as the server supports one of NativeKexAlgorithms:
+// the key exchange only runs until the server sent its SSH_MSG_KEXDH_REPLY (or SSH_MSG_KEX_ECDH_REPLY)
+// and the host key is taken from that reply. The signature of the reply is not verified.
+// Keys that golang.org/x/crypto/ssh can not parse are returned as *RawPublicKey.
+// If the server does not advertise algo nil is returned.
+// Specify kexAlgorithms to limit the key exchanges that are tried, if unsure use NativeKexAlgorithms.
+func GetHostKeyNative(ctx context.Context, host, algo string, kexAlgorithms ...string) (ssh.PublicKey, error) {
+	key, _, err := hostKeyNative(ctx, host, algo, kexAlgorithms)
+	return key, err
+}
+
+func getHostKeyNative(ctx context.Context, host, algo string) (ssh.PublicKey, *ServerAlgorithms, error) {
+	return hostKeyNative(ctx, host, algo, nil)
+}
+
+func hostKeyNative(ctx context.Context, host, algo string, kexAlgorithms []string) (ssh.PublicKey, *ServerAlgorithms, error) {
+	t, err := dialTransport(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.Close()
+
+	if !containsString(t.serverAlgorithms.HostKeyAlgorithms, algo) {
+		return nil, t.serverAlgorithms, nil
+	}
+	if len(kexAlgorithms) == 0 {
+		kexAlgorithms = NativeKexAlgorithms
+	}
+	kex := ""
+	for _, k := range kexAlgorithms {
+		if containsString(t.serverAlgorithms.KexAlgorithms, k) {
+			kex = k
+			break
+		}
+	}
+	if kex == "" {
+		return nil, t.serverAlgorithms, fmt.Errorf("server supports none of the key exchanges %v", kexAlgorithms)
+	}
+
+	blob, err := t.exchangeHostKey(kex, algo)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, t.serverAlgorithms, ctx.Err()
+		}
+		return nil, t.serverAlgorithms, err
+	}
+	if key, err := ssh.ParsePublicKey(blob); err == nil {
+		return key, t.serverAlgorithms, nil
+	}
+	key, err := NewRawPublicKey(blob)
+	return key, t.serverAlgorithms, err
+}
+
+// exchangeHostKey starts the key exchange kex and returns the host key blob of the reply.
+func (t *transport) exchangeHostKey(kex, algo string) ([]byte, error) {
+	if err := t.writeKexInit(kex, algo); err != nil {
+		return nil, err
+	}
+	return t.keyExchange(kex)
+}
+
+// keyExchange sends the SSH_MSG_KEXDH_INIT (or SSH_MSG_KEX_ECDH_INIT) of kex after the SSH_MSG_KEXINIT was sent
+// and returns the host key blob of the reply.
+func (t *transport) keyExchange(kex string) ([]byte, error) {
+	initPayload, err := kexInitPayload(kex)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.writePacket(initPayload); err != nil {
+		return nil, err
+	}
+	payload, err := t.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	if payload[0] != msgKexDHReply {
+		return nil, fmt.Errorf("expected key exchange reply, got message %d", payload[0])
+	}
+	blob, _, ok := parseString(payload[1:])
+	if !ok {
+		return nil, errors.New("key exchange reply is malformed")
+	}
+	return blob, nil
+}
+
+// kexInitPayload creates the SSH_MSG_KEXDH_INIT or SSH_MSG_KEX_ECDH_INIT message with a new ephemeral key.
+func kexInitPayload(kex string) ([]byte, error) {
+	payload := []byte{msgKexDHInit}
+	var curve ecdh.Curve
+	var group *big.Int
+	switch kex {
+	case "curve25519-sha256", "curve25519-sha256@libssh.org":
+		curve = ecdh.X25519()
+	case "ecdh-sha2-nistp256":
+		curve = ecdh.P256()
+	case "ecdh-sha2-nistp384":
+		curve = ecdh.P384()
+	case "ecdh-sha2-nistp521":
+		curve = ecdh.P521()
+	case "diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1":
+		group = oakleyGroup14
+	case "diffie-hellman-group1-sha1":
+		group = oakleyGroup2
+	default:
+		return nil, fmt.Errorf("unsupported key exchange %s", kex)
+	}
+
+	if curve != nil {
+		key, err := curve.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(payload, key.PublicKey().Bytes()), nil
+	}
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(group, big.NewInt(3))) //nolint: gomnd // x in [2, p-2]
+	if err != nil {
+		return nil, err
+	}
+	x.Add(x, big.NewInt(2))                        //nolint: gomnd // x in [2, p-2]
+	e := new(big.Int).Exp(big.NewInt(2), x, group) //nolint: gomnd // generator
+	return appendMPInt(payload, e), nil
+}
+
+// RawPublicKey is a public key whose type is not supported by golang.org/x/crypto/ssh.
+// It can be fingerprinted and marshaled to an authorized key, but it can not verify signatures.
+type RawPublicKey struct {
+	KeyType string
+	Blob    []byte
+}
+
+// NewRawPublicKey creates a RawPublicKey from the wire format of a public key, the type is read from the blob.
+func NewRawPublicKey(blob []byte) (*RawPublicKey, error) {
+	keyType, _, ok := parseString(blob)
+	if !ok || len(keyType) == 0 {
+		return nil, errors.New("public key blob is malformed")
+	}
+	return &RawPublicKey{KeyType: string(keyType), Blob: blob}, nil
+}
+
+// Type returns the key type of the blob.
+func (k *RawPublicKey) Type() string {
+	return k.KeyType
+}
+
+// Marshal returns the blob.
+func (k *RawPublicKey) Marshal() []byte {
+	return k.Blob
+}
+
+// Verify always fails, the key type is unknown.
+func (k *RawPublicKey) Verify([]byte, *ssh.Signature) error {
+	return fmt.Errorf("unable to verify signatures with %s keys", k.KeyType)
+}
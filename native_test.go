@@ -0,0 +1,189 @@
+package sshkeys_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestGetHostKeyNative(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateRSAKey, err := createRSAKey(2048)
+	require.NoError(t, err)
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateRSAKey, privateECKey},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	algorithms, err := sshkeys.GetServerAlgorithms(context.Background(), l.Addr().String())
+	require.NoError(t, err)
+	require.Contains(t, algorithms.HostKeyAlgorithms, xssh.KeyAlgoECDSA256)
+	require.Contains(t, algorithms.HostKeyAlgorithms, xssh.KeyAlgoRSASHA256)
+	require.NotEmpty(t, algorithms.KexAlgorithms)
+
+	for _, kex := range []string{"curve25519-sha256", "ecdh-sha2-nistp384", "diffie-hellman-group14-sha256"} {
+		key, err := sshkeys.GetHostKeyNative(context.Background(), l.Addr().String(), xssh.KeyAlgoECDSA256, kex)
+		require.NoError(t, err, kex)
+		require.Equal(t, privateECKey.PublicKey().Marshal(), key.Marshal(), kex)
+	}
+
+	key, err := sshkeys.GetHostKeyNative(context.Background(), l.Addr().String(), xssh.KeyAlgoRSASHA512)
+	require.NoError(t, err)
+	require.Equal(t, privateRSAKey.PublicKey().Marshal(), key.Marshal())
+
+	key, err = sshkeys.GetHostKeyNative(context.Background(), l.Addr().String(), "ssh-ed448")
+	require.NoError(t, err)
+	require.Nil(t, key)
+}
+
+// ed448Blob is the wire format of an ssh-ed448 key, a type golang.org/x/crypto/ssh does not support.
+var ed448Blob = append(
+	[]byte{0, 0, 0, 9, 's', 's', 'h', '-', 'e', 'd', '4', '4', '8', 0, 0, 0, 57},
+	make([]byte, 57)...,
+)
+
+// serveFakeKex accepts connections on l and answers the key exchange with blob as host key.
+func serveFakeKex(l net.Listener, hostKeyAlgorithms string, blob []byte) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			_, _ = io.WriteString(conn, "SSH-2.0-Fake\r\n")
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+			kexInit := append([]byte{20}, make([]byte, 16)...)
+			for _, list := range []string{
+				"curve25519-sha256", hostKeyAlgorithms, "aes128-ctr", "aes128-ctr",
+				"hmac-sha2-256", "hmac-sha2-256", "none", "none", "", "",
+			} {
+				kexInit = appendTestString(kexInit, []byte(list))
+			}
+			kexInit = append(kexInit, 0, 0, 0, 0, 0)
+			writeTestPacket(conn, kexInit)
+
+			// the SSH_MSG_KEXINIT and SSH_MSG_KEX_ECDH_INIT of the client
+			for i := 0; i < 2; i++ {
+				if !readTestPacket(r) {
+					return
+				}
+			}
+			reply := appendTestString([]byte{31}, blob)
+			reply = appendTestString(reply, make([]byte, 32))
+			reply = appendTestString(reply, []byte("signature"))
+			writeTestPacket(conn, reply)
+			_, _ = io.Copy(io.Discard, r)
+		}()
+	}
+}
+
+func appendTestString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func writeTestPacket(w io.Writer, payload []byte) {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	packet = append(packet, make([]byte, padding)...)
+	_, _ = w.Write(packet)
+}
+
+func readTestPacket(r io.Reader) bool {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false
+	}
+	_, err := io.CopyN(io.Discard, r, int64(binary.BigEndian.Uint32(header[:])))
+	return err == nil
+}
+
+func TestGetHostKeyNativeRawKey(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveFakeKex(l, "ssh-ed448", ed448Blob)
+
+	key, err := sshkeys.GetHostKeyNative(context.Background(), l.Addr().String(), "ssh-ed448")
+	require.NoError(t, err)
+	require.IsType(t, &sshkeys.RawPublicKey{}, key)
+	require.Equal(t, "ssh-ed448", key.Type())
+	require.Equal(t, ed448Blob, key.Marshal())
+
+	authorizedKey, err := sshkeys.AuthorizedKey(key)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(authorizedKey, "ssh-ed448 AAAACXNzaC1lZDQ0OA"))
+	require.Equal(t, xssh.FingerprintSHA256(key), "SHA256:"+mustFingerprintSHA256(t, key))
+}
+
+func mustFingerprintSHA256(t *testing.T, key xssh.PublicKey) string {
+	t.Helper()
+	fingerprint, err := sshkeys.FingerprintSHA256(sshkeys.Base64Encoding, key)
+	require.NoError(t, err)
+	return fingerprint
+}
+
+func TestScanNative(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveFakeKex(l, "ssh-ed448,x509v3-ssh-ed448", ed448Blob)
+
+	result, err := sshkeys.Scan(context.Background(), l.Addr().String(), sshkeys.ScanOptions{
+		ConcurrentWorkers: 2,
+		Timeout:           10 * time.Second,
+		Algorithms:        []string{xssh.KeyAlgoED25519},
+		Native:            true,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Keys, 1)
+	require.Equal(t, []string{"ssh-ed448", "x509v3-ssh-ed448"}, result.Keys[0].Algorithms)
+	require.Equal(t, "ssh-ed448", result.Keys[0].Type)
+	require.True(t, result.Keys[0].Raw)
+
+	// raw keys survive a json round trip
+	decoded := sshkeys.KeyResult{AuthorizedKey: result.Keys[0].AuthorizedKey, Raw: true}
+	key, err := decoded.PublicKey()
+	require.NoError(t, err)
+	require.Equal(t, ed448Blob, key.Marshal())
+}
@@ -0,0 +1,82 @@
+package sshkeys
+
+import "strings"
+
+// PostQuantumKexAlgorithms are the known hybrid post-quantum key exchanges.
+var PostQuantumKexAlgorithms = []string{
+	"mlkem768x25519-sha256",
+	"mlkem768nistp256-sha256",
+	"mlkem1024nistp384-sha384",
+	"sntrup761x25519-sha512",
+	"sntrup761x25519-sha512@openssh.com",
+	"sntrup4591761x25519-sha512@tinyssh.org",
+}
+
+// postQuantumKexMarkers are parts of the names of post-quantum key exchanges that are not in PostQuantumKexAlgorithms,
+// e.g. the experimental x25519-kyber-512r3-sha256-d00@amazon.com.
+var postQuantumKexMarkers = []string{"mlkem", "kyber", "sntrup", "ntruprime", "frodokem", "mceliece", "hqc", "bike"}
+
+// IsPostQuantumKex reports whether kex is a post-quantum (hybrid) key exchange.
+func IsPostQuantumKex(kex string) bool {
+	if containsString(PostQuantumKexAlgorithms, kex) {
+		return true
+	}
+	name := strings.ToLower(kex)
+	for _, marker := range postQuantumKexMarkers {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// PostQuantumResult describes whether a server offers a post-quantum key exchange.
+type PostQuantumResult struct {
+	// Ready is set if the server offers at least one post-quantum key exchange.
+	Ready bool `json:"ready"`
+	// KexAlgorithms are the offered post-quantum key exchanges in the order of the server.
+	KexAlgorithms []string `json:"kex_algorithms"`
+}
+
+// PostQuantum checks the advertised kex algorithms for post-quantum key exchanges.
+func (a *ServerAlgorithms) PostQuantum() *PostQuantumResult {
+	result := PostQuantumResult{KexAlgorithms: []string{}}
+	for _, kex := range a.KexAlgorithms {
+		if IsPostQuantumKex(kex) {
+			result.KexAlgorithms = append(result.KexAlgorithms, kex)
+		}
+	}
+	result.Ready = len(result.KexAlgorithms) > 0
+	return &result
+}
+
+// PostQuantumSummary is the post-quantum readiness of multiple hosts.
+type PostQuantumSummary struct {
+	// Hosts is the number of hosts whose kex algorithms are known.
+	Hosts int `json:"hosts"`
+	// Ready is the number of hosts that offer a post-quantum key exchange.
+	Ready int `json:"ready"`
+	// Percent is the share of Ready in Hosts, 0 if there are no hosts.
+	Percent float64 `json:"percent"`
+}
+
+// Add counts result, hosts without a post-quantum result are ignored.
+func (s *PostQuantumSummary) Add(result *HostResult) {
+	if result.PostQuantum == nil {
+		return
+	}
+	s.Hosts++
+	if result.PostQuantum.Ready {
+		s.Ready++
+	}
+	s.Percent = float64(s.Ready) * 100 / float64(s.Hosts) //nolint: gomnd // percent
+}
+
+// NewPostQuantumSummary summarizes the post-quantum readiness of results.
+func NewPostQuantumSummary(results ...HostResult) *PostQuantumSummary {
+	var summary PostQuantumSummary
+	for i := range results {
+		summary.Add(&results[i])
+	}
+	return &summary
+}
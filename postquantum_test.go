@@ -0,0 +1,45 @@
+package sshkeys_test
+
+import (
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostQuantum(t *testing.T) {
+	t.Parallel()
+	algorithms := sshkeys.ServerAlgorithms{
+		KexAlgorithms: []string{
+			"mlkem768x25519-sha256",
+			"sntrup761x25519-sha512@openssh.com",
+			"curve25519-sha256",
+			"x25519-kyber-512r3-sha256-d00@amazon.com",
+			sshkeys.StrictKexServer,
+		},
+	}
+	require.Equal(t, &sshkeys.PostQuantumResult{
+		Ready: true,
+		KexAlgorithms: []string{
+			"mlkem768x25519-sha256",
+			"sntrup761x25519-sha512@openssh.com",
+			"x25519-kyber-512r3-sha256-d00@amazon.com",
+		},
+	}, algorithms.PostQuantum())
+
+	classic := sshkeys.ServerAlgorithms{KexAlgorithms: []string{"curve25519-sha256", "diffie-hellman-group14-sha256"}}
+	require.Equal(t, &sshkeys.PostQuantumResult{KexAlgorithms: []string{}}, classic.PostQuantum())
+}
+
+func TestPostQuantumSummary(t *testing.T) {
+	t.Parallel()
+	ready := sshkeys.HostResult{Host: "a", PostQuantum: &sshkeys.PostQuantumResult{Ready: true}}
+	notReady := sshkeys.HostResult{Host: "b", PostQuantum: &sshkeys.PostQuantumResult{}}
+	failed := sshkeys.HostResult{Host: "c", Error: "connection refused"}
+
+	report := sshkeys.NewReport(ready, notReady, notReady, ready, failed)
+	require.Equal(t, &sshkeys.PostQuantumSummary{Hosts: 4, Ready: 2, Percent: 50}, report.PostQuantum)
+
+	// single host reports have no summary
+	require.Nil(t, sshkeys.NewReport(ready).PostQuantum)
+}
@@ -0,0 +1,347 @@
+package sshkeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClientProfile describes the version and the algorithm preferences of a ssh client.
+type ClientProfile struct {
+	Name string `json:"name" yaml:"name"`
+	// Version is the version the client sends, e.g. SSH-2.0-OpenSSH_7.4.
+	Version           string   `json:"version" yaml:"version"`
+	KexAlgorithms     []string `json:"kex_algorithms" yaml:"kex_algorithms"`
+	HostKeyAlgorithms []string `json:"host_key_algorithms" yaml:"host_key_algorithms"`
+	// Ciphers and MACs are offered for both directions.
+	Ciphers []string `json:"ciphers" yaml:"ciphers"`
+	MACs    []string `json:"macs" yaml:"macs"`
+	// Compression defaults to none.
+	Compression []string `json:"compression,omitempty" yaml:"compression"`
+}
+
+// Validate reports an error if a required field of the profile is missing.
+func (p *ClientProfile) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("profile has no name")
+	case !strings.HasPrefix(p.Version, "SSH-2.0-"):
+		return fmt.Errorf("profile %s: version must start with SSH-2.0-", p.Name)
+	case len(p.KexAlgorithms) == 0:
+		return fmt.Errorf("profile %s has no kex_algorithms", p.Name)
+	case len(p.HostKeyAlgorithms) == 0:
+		return fmt.Errorf("profile %s has no host_key_algorithms", p.Name)
+	case len(p.Ciphers) == 0:
+		return fmt.Errorf("profile %s has no ciphers", p.Name)
+	case len(p.MACs) == 0:
+		return fmt.Errorf("profile %s has no macs", p.Name)
+	}
+	return nil
+}
+
+func (p *ClientProfile) compression() []string {
+	if len(p.Compression) == 0 {
+		return []string{"none"}
+	}
+	return p.Compression
+}
+
+// ClientProfiles are the predefined client profiles, the algorithms are the defaults of the clients.
+var ClientProfiles = []ClientProfile{
+	{
+		Name:    "openssh-6.6",
+		Version: "SSH-2.0-OpenSSH_6.6.1p1 Ubuntu-2ubuntu2",
+		KexAlgorithms: []string{
+			"curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+			"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		},
+		HostKeyAlgorithms: []string{
+			"ecdsa-sha2-nistp256-cert-v01@openssh.com", "ecdsa-sha2-nistp384-cert-v01@openssh.com",
+			"ecdsa-sha2-nistp521-cert-v01@openssh.com", "ssh-ed25519-cert-v01@openssh.com",
+			"ssh-rsa-cert-v01@openssh.com", "ssh-dss-cert-v01@openssh.com",
+			"ssh-rsa-cert-v00@openssh.com", "ssh-dss-cert-v00@openssh.com",
+			"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "ssh-ed25519", "ssh-rsa", "ssh-dss",
+		},
+		Ciphers: []string{
+			"aes128-ctr", "aes192-ctr", "aes256-ctr", "arcfour256", "arcfour128",
+			"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+			"aes128-cbc", "3des-cbc", "blowfish-cbc", "cast128-cbc", "aes192-cbc", "aes256-cbc",
+			"arcfour", "rijndael-cbc@lysator.liu.se",
+		},
+		MACs: []string{
+			"hmac-md5-etm@openssh.com", "hmac-sha1-etm@openssh.com", "umac-64-etm@openssh.com",
+			"umac-128-etm@openssh.com", "hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+			"hmac-ripemd160-etm@openssh.com", "hmac-sha1-96-etm@openssh.com", "hmac-md5-96-etm@openssh.com",
+			"hmac-md5", "hmac-sha1", "umac-64@openssh.com", "umac-128@openssh.com", "hmac-sha2-256", "hmac-sha2-512",
+			"hmac-ripemd160", "hmac-ripemd160@openssh.com", "hmac-sha1-96", "hmac-md5-96",
+		},
+		Compression: []string{"none", "zlib@openssh.com", "zlib"},
+	},
+	{
+		Name:    "openssh-7.4",
+		Version: "SSH-2.0-OpenSSH_7.4",
+		KexAlgorithms: []string{
+			"curve25519-sha256", "curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384",
+			"ecdh-sha2-nistp521", "diffie-hellman-group-exchange-sha256", "diffie-hellman-group16-sha512",
+			"diffie-hellman-group18-sha512", "diffie-hellman-group-exchange-sha1", "diffie-hellman-group14-sha256",
+			"diffie-hellman-group14-sha1", "ext-info-c",
+		},
+		HostKeyAlgorithms: []string{
+			"ecdsa-sha2-nistp256-cert-v01@openssh.com", "ecdsa-sha2-nistp384-cert-v01@openssh.com",
+			"ecdsa-sha2-nistp521-cert-v01@openssh.com", "ssh-ed25519-cert-v01@openssh.com",
+			"ssh-rsa-cert-v01@openssh.com", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+			"ssh-ed25519", "rsa-sha2-512", "rsa-sha2-256", "ssh-rsa",
+		},
+		Ciphers: []string{
+			"chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr",
+			"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		},
+		MACs: []string{
+			"umac-64-etm@openssh.com", "umac-128-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+			"hmac-sha2-512-etm@openssh.com", "hmac-sha1-etm@openssh.com", "umac-64@openssh.com",
+			"umac-128@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1",
+		},
+		Compression: []string{"none", "zlib@openssh.com", "zlib"},
+	},
+	{
+		Name:    "openssh-9.9",
+		Version: "SSH-2.0-OpenSSH_9.9",
+		KexAlgorithms: []string{
+			"mlkem768x25519-sha256", "sntrup761x25519-sha512", "sntrup761x25519-sha512@openssh.com",
+			"curve25519-sha256", "curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384",
+			"ecdh-sha2-nistp521", "diffie-hellman-group-exchange-sha256", "diffie-hellman-group16-sha512",
+			"diffie-hellman-group18-sha512", "diffie-hellman-group14-sha256",
+			"ext-info-c", "kex-strict-c-v00@openssh.com",
+		},
+		HostKeyAlgorithms: []string{
+			"ssh-ed25519-cert-v01@openssh.com", "ecdsa-sha2-nistp256-cert-v01@openssh.com",
+			"ecdsa-sha2-nistp384-cert-v01@openssh.com", "ecdsa-sha2-nistp521-cert-v01@openssh.com",
+			"sk-ssh-ed25519-cert-v01@openssh.com", "sk-ecdsa-sha2-nistp256-cert-v01@openssh.com",
+			"rsa-sha2-512-cert-v01@openssh.com", "rsa-sha2-256-cert-v01@openssh.com",
+			"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+			"sk-ssh-ed25519@openssh.com", "sk-ecdsa-sha2-nistp256@openssh.com", "rsa-sha2-512", "rsa-sha2-256",
+		},
+		Ciphers: []string{
+			"chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr",
+			"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		},
+		MACs: []string{
+			"umac-64-etm@openssh.com", "umac-128-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+			"hmac-sha2-512-etm@openssh.com", "hmac-sha1-etm@openssh.com", "umac-64@openssh.com",
+			"umac-128@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1",
+		},
+		Compression: []string{"none", "zlib@openssh.com"},
+	},
+	{
+		Name:    "putty-0.70",
+		Version: "SSH-2.0-PuTTY_Release_0.70",
+		KexAlgorithms: []string{
+			"curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+			"diffie-hellman-group14-sha1", "rsa2048-sha256", "rsa1024-sha1", "diffie-hellman-group1-sha1",
+		},
+		HostKeyAlgorithms: []string{
+			"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "ssh-rsa", "ssh-dss",
+		},
+		Ciphers: []string{
+			"aes256-ctr", "aes256-cbc", "rijndael-cbc@lysator.liu.se", "aes192-ctr", "aes192-cbc",
+			"aes128-ctr", "aes128-cbc", "chacha20-poly1305@openssh.com", "3des-ctr", "3des-cbc",
+			"blowfish-ctr", "blowfish-cbc", "arcfour256", "arcfour128",
+		},
+		MACs:        []string{"hmac-sha2-256", "hmac-sha1", "hmac-sha1-96", "hmac-md5"},
+		Compression: []string{"none", "zlib"},
+	},
+	{
+		Name:    "paramiko-2.4",
+		Version: "SSH-2.0-paramiko_2.4.2",
+		KexAlgorithms: []string{
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+			"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		},
+		HostKeyAlgorithms: []string{
+			"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "ssh-ed25519", "ssh-rsa", "ssh-dss",
+		},
+		Ciphers: []string{
+			"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-cbc", "aes192-cbc", "aes256-cbc",
+			"blowfish-cbc", "3des-cbc",
+		},
+		MACs: []string{"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-md5", "hmac-sha1-96", "hmac-md5-96"},
+	},
+	{
+		Name: "jsch-0.1.55",
+		// JSch 0.1.55 still sends the version of 0.1.54
+		Version: "SSH-2.0-JSCH-0.1.54",
+		KexAlgorithms: []string{
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521", "diffie-hellman-group14-sha1",
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1",
+		},
+		HostKeyAlgorithms: []string{
+			"ssh-rsa", "ssh-dss", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+		},
+		Ciphers: []string{
+			"aes128-ctr", "aes128-cbc", "3des-ctr", "3des-cbc", "blowfish-cbc",
+			"aes192-ctr", "aes192-cbc", "aes256-ctr", "aes256-cbc",
+		},
+		MACs: []string{"hmac-md5", "hmac-sha1", "hmac-sha2-256", "hmac-sha1-96", "hmac-md5-96"},
+	},
+}
+
+// GetClientProfile returns the predefined profile name, nil is returned if there is no such profile.
+func GetClientProfile(name string) *ClientProfile {
+	for i := range ClientProfiles {
+		if ClientProfiles[i].Name == name {
+			return &ClientProfiles[i]
+		}
+	}
+	return nil
+}
+
+// Negotiated are the algorithms a client and a server agree on.
+type Negotiated struct {
+	Kex                     string `json:"kex"`
+	HostKey                 string `json:"host_key"`
+	CipherClientServer      string `json:"cipher_client_server"`
+	CipherServerClient      string `json:"cipher_server_client"`
+	MACClientServer         string `json:"mac_client_server,omitempty"`
+	MACServerClient         string `json:"mac_server_client,omitempty"`
+	CompressionClientServer string `json:"compression_client_server"`
+	CompressionServerClient string `json:"compression_server_client"`
+}
+
+// NegotiationError is returned if a client and a server have no algorithm of a name-list in common.
+type NegotiationError struct {
+	// List is the name-list, e.g. kex, host key, cipher client to server.
+	List   string
+	Client []string
+	Server []string
+}
+
+func (e *NegotiationError) Error() string {
+	return fmt.Sprintf("no matching %s algorithm, client offers %s, server offers %s",
+		e.List, strings.Join(e.Client, ","), strings.Join(e.Server, ","))
+}
+
+// isAEAD reports whether cipher authenticates the data itself, the MAC is not negotiated for such ciphers.
+func isAEAD(cipher string) bool {
+	return cipher == ChaCha20Poly1305 || strings.HasSuffix(cipher, "-gcm@openssh.com")
+}
+
+// Negotiate runs the algorithm negotiation of RFC 4253 section 7.1 for profile:
+// for each name-list the first algorithm of the client that the server also supports is chosen.
+func (a *ServerAlgorithms) Negotiate(profile *ClientProfile) (*Negotiated, error) {
+	var result Negotiated
+	var err error
+	choose := func(name string, client, server []string) string {
+		if err != nil {
+			return ""
+		}
+		for _, c := range client {
+			if containsString(server, c) {
+				return c
+			}
+		}
+		err = &NegotiationError{List: name, Client: client, Server: server}
+		return ""
+	}
+	result.Kex = choose("kex", profile.KexAlgorithms, a.KexAlgorithms)
+	result.HostKey = choose("host key", profile.HostKeyAlgorithms, a.HostKeyAlgorithms)
+	result.CipherClientServer = choose("cipher client to server", profile.Ciphers, a.CiphersClientServer)
+	result.CipherServerClient = choose("cipher server to client", profile.Ciphers, a.CiphersServerClient)
+	if !isAEAD(result.CipherClientServer) {
+		result.MACClientServer = choose("mac client to server", profile.MACs, a.MACsClientServer)
+	}
+	if !isAEAD(result.CipherServerClient) {
+		result.MACServerClient = choose("mac server to client", profile.MACs, a.MACsServerClient)
+	}
+	result.CompressionClientServer = choose("compression client to server", profile.compression(), a.CompressionClientServer)
+	result.CompressionServerClient = choose("compression server to client", profile.compression(), a.CompressionServerClient)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ProfileResult is the outcome of the handshake of a client profile.
+type ProfileResult struct {
+	Profile string `json:"profile"`
+	Version string `json:"version"`
+	// Negotiated are the algorithms that would be used, it is nil if the negotiation failed.
+	Negotiated *Negotiated `json:"negotiated,omitempty"`
+	// KeyExchange is set if the key exchange was run and the server replied with its host key.
+	// The key exchange only runs for NativeKexAlgorithms.
+	KeyExchange bool `json:"key_exchange"`
+	// Error describes why the handshake failed.
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether a client with the profile can connect.
+func (r *ProfileResult) OK() bool {
+	return r.Error == "" && r.Negotiated != nil
+}
+
+// CheckClientProfile runs the handshake with host as profile: the version of the profile is sent,
+// the algorithms are negotiated and the key exchange is run if the negotiated kex is one of NativeKexAlgorithms.
+// Failures of the handshake are reported in the result, errors are only returned if the server can not be reached.
+func CheckClientProfile(ctx context.Context, host string, profile *ClientProfile) (*ProfileResult, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	result := ProfileResult{
+		Profile: profile.Name,
+		Version: profile.Version,
+	}
+	t, err := dialTransportVersion(ctx, host, profile.Version)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, err
+		}
+		// the server rejected the version or closed the connection
+		result.Error = err.Error()
+		return &result, nil
+	}
+	defer t.Close()
+
+	negotiated, err := t.serverAlgorithms.Negotiate(profile)
+	if err != nil {
+		result.Error = err.Error()
+		return &result, nil
+	}
+	result.Negotiated = negotiated
+	if !containsString(NativeKexAlgorithms, negotiated.Kex) {
+		return &result, nil
+	}
+
+	compression := profile.compression()
+	if err := t.writeKexInitLists([][]string{
+		profile.KexAlgorithms,
+		profile.HostKeyAlgorithms,
+		profile.Ciphers,
+		profile.Ciphers,
+		profile.MACs,
+		profile.MACs,
+		compression,
+		compression,
+		nil,
+		nil,
+	}); err != nil {
+		result.Error = err.Error()
+		return &result, nil
+	}
+	if _, err := t.keyExchange(negotiated.Kex); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result.Error = err.Error()
+		return &result, nil
+	}
+	result.KeyExchange = true
+	return &result, nil
+}
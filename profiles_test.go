@@ -0,0 +1,101 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+	algorithms := sshkeys.ServerAlgorithms{
+		KexAlgorithms:           []string{"curve25519-sha256", "diffie-hellman-group14-sha256", sshkeys.StrictKexServer},
+		HostKeyAlgorithms:       []string{"rsa-sha2-512", "ssh-ed25519"},
+		CiphersClientServer:     []string{"aes256-gcm@openssh.com", "aes128-ctr"},
+		CiphersServerClient:     []string{"aes128-ctr"},
+		MACsClientServer:        []string{"hmac-sha2-256"},
+		MACsServerClient:        []string{"hmac-sha2-256", "hmac-sha1"},
+		CompressionClientServer: []string{"none"},
+		CompressionServerClient: []string{"none"},
+	}
+
+	negotiated, err := algorithms.Negotiate(&sshkeys.ClientProfile{
+		KexAlgorithms:     []string{"ecdh-sha2-nistp256", "diffie-hellman-group14-sha256", "curve25519-sha256"},
+		HostKeyAlgorithms: []string{"ssh-ed25519", "rsa-sha2-512"},
+		Ciphers:           []string{"aes256-gcm@openssh.com", "aes128-ctr"},
+		MACs:              []string{"hmac-sha1", "hmac-sha2-256"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &sshkeys.Negotiated{
+		Kex:                     "diffie-hellman-group14-sha256",
+		HostKey:                 "ssh-ed25519",
+		CipherClientServer:      "aes256-gcm@openssh.com",
+		CipherServerClient:      "aes128-ctr",
+		MACServerClient:         "hmac-sha1",
+		CompressionClientServer: "none",
+		CompressionServerClient: "none",
+	}, negotiated)
+
+	_, err = algorithms.Negotiate(&sshkeys.ClientProfile{
+		KexAlgorithms:     []string{"curve25519-sha256"},
+		HostKeyAlgorithms: []string{"ssh-rsa", "ssh-dss"},
+		Ciphers:           []string{"aes128-ctr"},
+		MACs:              []string{"hmac-sha2-256"},
+	})
+	var negotiationErr *sshkeys.NegotiationError
+	require.ErrorAs(t, err, &negotiationErr)
+	require.Equal(t, "host key", negotiationErr.List)
+}
+
+func TestCheckClientProfile(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateECKey},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	for _, name := range []string{"openssh-7.4", "openssh-9.9", "jsch-0.1.55"} {
+		result, err := sshkeys.CheckClientProfile(context.Background(), l.Addr().String(), sshkeys.GetClientProfile(name))
+		require.NoError(t, err, name)
+		require.True(t, result.OK(), "%s: %s", name, result.Error)
+		require.True(t, result.KeyExchange, name)
+		require.Equal(t, "ecdsa-sha2-nistp256", result.Negotiated.HostKey, name)
+	}
+
+	result, err := sshkeys.CheckClientProfile(context.Background(), l.Addr().String(), &sshkeys.ClientProfile{
+		Name:              "dss-only",
+		Version:           "SSH-2.0-Legacy",
+		KexAlgorithms:     []string{"diffie-hellman-group1-sha1"},
+		HostKeyAlgorithms: []string{"ssh-dss"},
+		Ciphers:           []string{"3des-cbc"},
+		MACs:              []string{"hmac-md5"},
+	})
+	require.NoError(t, err)
+	require.False(t, result.OK())
+	require.Contains(t, result.Error, "no matching kex algorithm")
+
+	_, err = sshkeys.CheckClientProfile(context.Background(), l.Addr().String(), &sshkeys.ClientProfile{Name: "empty"})
+	require.Error(t, err)
+}
@@ -0,0 +1,600 @@
+package sshkeys
+
+import (
+	"bytes"
+	"context"
+	"crypto/dsa" //nolint: staticcheck // dsa keys are still served by some hosts
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SchemaVersion is the version of the Report json schema.
+// It is increased whenever a field is removed or its meaning changes.
+const SchemaVersion = 1
+
+// Report is the versioned json document that contains the results of one or more hosts.
+type Report struct {
+	SchemaVersion int          `json:"schema_version"`
+	Hosts         []HostResult `json:"hosts"`
+	// PostQuantum is the post-quantum readiness of the hosts, it is only set for reports of multiple hosts.
+	PostQuantum *PostQuantumSummary `json:"post_quantum,omitempty"`
+	// CertAuthorities are the host certificates of the hosts grouped by their CA, see GroupCertAuthorities.
+	CertAuthorities []CertAuthorityGroup `json:"cert_authorities,omitempty"`
+}
+
+// NewReport creates a Report for the provided results.
+func NewReport(results ...HostResult) *Report {
+	if results == nil {
+		results = []HostResult{}
+	}
+	report := Report{
+		SchemaVersion:   SchemaVersion,
+		Hosts:           results,
+		CertAuthorities: GroupCertAuthorities(results...),
+	}
+	if len(results) > 1 {
+		report.PostQuantum = NewPostQuantumSummary(results...)
+	}
+	return &report
+}
+
+// HostResult is the result of scanning a single host.
+type HostResult struct {
+	// Host is the host as it was specified by the user.
+	Host string `json:"host"`
+	// Address is the host:port address that was scanned.
+	Address string `json:"address"`
+	// Target describes how the address was derived from Host, it is nil if Scan was called directly.
+	Target *Target `json:"target,omitempty"`
+	// HostKeyAlias is the name of the host in known_hosts, it is set if it was configured in ssh_config.
+	HostKeyAlias string `json:"host_key_alias,omitempty"`
+	// Banner is the ssh version the host reported.
+	Banner string `json:"banner,omitempty"`
+	// Keys contains every distinct key the host returned.
+	Keys []KeyResult `json:"keys"`
+	// Errors contains the algorithms that failed with their error.
+	Errors map[string]string `json:"errors,omitempty"`
+	// ServerAlgorithms are the algorithms the server advertised in its SSH_MSG_KEXINIT.
+	ServerAlgorithms *ServerAlgorithms `json:"server_algorithms,omitempty"`
+	// HASSHServer is the HASSHServer fingerprint of ServerAlgorithms.
+	HASSHServer string `json:"hassh_server,omitempty"`
+	// HASSHServerAlgorithms is the algorithm string HASSHServer is computed from.
+	HASSHServerAlgorithms string `json:"hassh_server_algorithms,omitempty"`
+	// VerifiedAlgorithms are the advertised algorithms and whether a handshake with them completes,
+	// it is only set if ScanOptions.VerifyAlgorithms is enabled.
+	VerifiedAlgorithms *VerifiedAlgorithms `json:"verified_algorithms,omitempty"`
+	// GEX are the groups the server returned for the Diffie-Hellman group exchange,
+	// it is only set if ScanOptions.ProbeGEX is enabled and the server offers a group exchange.
+	GEX *GEXResult `json:"dh_gex,omitempty"`
+	// PostQuantum describes whether ServerAlgorithms contain a post-quantum key exchange.
+	PostQuantum *PostQuantumResult `json:"post_quantum,omitempty"`
+	// Terrapin is the result of the Terrapin check of ServerAlgorithms.
+	Terrapin *TerrapinResult `json:"terrapin,omitempty"`
+	// AuthMethods are the authentication methods the server allows, see ScanOptions.AuthMethodsUser.
+	AuthMethods *AuthMethods `json:"auth_methods,omitempty"`
+	// Error is set if the host could not be scanned at all.
+	Error   string  `json:"error,omitempty"`
+	Timings Timings `json:"timings"`
+}
+
+// NewFailedResult creates the result of a host that could not be scanned.
+func NewFailedResult(host, address string, err error) *HostResult {
+	return &HostResult{
+		Host:    host,
+		Address: address,
+		Keys:    []KeyResult{},
+		Error:   err.Error(),
+		Timings: Timings{
+			Started: time.Now().UTC(),
+		},
+	}
+}
+
+// Timings contains the durations of a scan in milliseconds.
+type Timings struct {
+	Started    time.Time        `json:"started"`
+	TotalMS    int64            `json:"total_ms"`
+	BannerMS   int64            `json:"banner_ms"`
+	Algorithms map[string]int64 `json:"algorithms_ms,omitempty"`
+}
+
+// KeyResult is a distinct key together with the algorithms that returned it.
+type KeyResult struct {
+	Algorithms    []string         `json:"algorithms"`
+	Type          string           `json:"type"`
+	Bits          int              `json:"bits,omitempty"`
+	AuthorizedKey string           `json:"authorized_key"`
+	Fingerprints  Fingerprints     `json:"fingerprints"`
+	Certificate   *CertificateInfo `json:"certificate,omitempty"`
+	// Raw is set if the key type is not supported by golang.org/x/crypto/ssh (see RawPublicKey),
+	// only the fingerprints and the authorized key are available.
+	Raw bool `json:"raw,omitempty"`
+	// Announced is set if the server announced the key with hostkeys-00@openssh.com, see GetAnnouncedKeys.
+	// Keys that were only announced have no Algorithms.
+	Announced bool `json:"announced,omitempty"`
+	// Proven is set if the server proved the possession of the private key with hostkeys-prove-00@openssh.com,
+	// see GetAnnouncedKeys.
+	Proven bool `json:"proven,omitempty"`
+	// Revoked is the reason why the key is revoked by the KRL of ScanOptions.KRL, see KRL.IsRevoked.
+	Revoked string `json:"revoked,omitempty"`
+
+	key ssh.PublicKey
+}
+
+// Fingerprints contains the fingerprints of a key in every supported hash and encoding.
+type Fingerprints struct {
+	MD5    EncodedFingerprint `json:"md5"`
+	SHA1   EncodedFingerprint `json:"sha1"`
+	SHA256 EncodedFingerprint `json:"sha256"`
+}
+
+// EncodedFingerprint contains a fingerprint in every supported encoding.
+type EncodedFingerprint struct {
+	Hex    string `json:"hex"`
+	Base32 string `json:"base32"`
+	Base64 string `json:"base64"`
+}
+
+// CertificateInfo describes a certificate that was returned as host key.
+type CertificateInfo struct {
+	// CertType is either host or user.
+	CertType    string    `json:"cert_type"`
+	KeyID       string    `json:"key_id"`
+	Serial      uint64    `json:"serial"`
+	Principals  []string  `json:"principals"`
+	ValidAfter  time.Time `json:"valid_after"`
+	ValidBefore time.Time `json:"valid_before"`
+	// Forever is set if the certificate does not expire.
+	Forever bool `json:"forever,omitempty"`
+	// KeyType and KeyFingerprintSHA256 describe the certified key.
+	KeyType              string `json:"key_type"`
+	KeyFingerprintSHA256 string `json:"key_fingerprint_sha256"`
+	// CAType and CAFingerprintSHA256 describe the key that signed the certificate.
+	CAType              string `json:"ca_type"`
+	CAFingerprintSHA256 string `json:"ca_fingerprint_sha256"`
+}
+
+// NewKeyResult creates a KeyResult for key, the algorithms have to be added by the caller.
+func NewKeyResult(key ssh.PublicKey) (KeyResult, error) {
+	authorizedKey, err := AuthorizedKey(key)
+	if err != nil {
+		return KeyResult{}, err
+	}
+	result := KeyResult{
+		Type:          key.Type(),
+		Bits:          KeyBits(key),
+		AuthorizedKey: authorizedKey,
+		key:           key,
+	}
+	if result.Fingerprints, err = NewFingerprints(key); err != nil {
+		return KeyResult{}, err
+	}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		result.Certificate = NewCertificateInfo(cert)
+	}
+	if _, ok := key.(*RawPublicKey); ok {
+		result.Raw = true
+	}
+	return result, nil
+}
+
+// PublicKey returns the key of the result.
+// For results that were decoded from json the key is parsed from the AuthorizedKey field.
+func (k *KeyResult) PublicKey() (ssh.PublicKey, error) {
+	if k.key != nil {
+		return k.key, nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k.AuthorizedKey))
+	if err != nil {
+		if !k.Raw {
+			return nil, err
+		}
+		if key, err = parseRawAuthorizedKey(k.AuthorizedKey); err != nil {
+			return nil, err
+		}
+	}
+	k.key = key
+	return key, nil
+}
+
+// parseRawAuthorizedKey parses an authorized key of a type that golang.org/x/crypto/ssh does not support.
+func parseRawAuthorizedKey(authorizedKey string) (ssh.PublicKey, error) {
+	fields := strings.Fields(authorizedKey)
+	if len(fields) < 2 { //nolint: gomnd // type and key
+		return nil, errors.New("authorized key is malformed")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	return NewRawPublicKey(blob)
+}
+
+// NewFingerprints creates the fingerprints of key.
+func NewFingerprints(key ssh.PublicKey) (Fingerprints, error) {
+	var fp Fingerprints
+	for _, f := range []struct {
+		dst         *EncodedFingerprint
+		fingerprint func(Encoding, ssh.PublicKey) (string, error)
+	}{
+		{&fp.MD5, FingerprintMD5},
+		{&fp.SHA1, FingerprintSHA1},
+		{&fp.SHA256, FingerprintSHA256},
+	} {
+		var err error
+		if f.dst.Hex, err = f.fingerprint(HexEncoding, key); err != nil {
+			return Fingerprints{}, err
+		}
+		if f.dst.Base32, err = f.fingerprint(Base32Encoding, key); err != nil {
+			return Fingerprints{}, err
+		}
+		if f.dst.Base64, err = f.fingerprint(Base64Encoding, key); err != nil {
+			return Fingerprints{}, err
+		}
+	}
+	return fp, nil
+}
+
+// NewCertificateInfo describes the provided certificate.
+func NewCertificateInfo(cert *ssh.Certificate) *CertificateInfo {
+	info := &CertificateInfo{
+		CertType:             "user",
+		KeyID:                cert.KeyId,
+		Serial:               cert.Serial,
+		Principals:           cert.ValidPrincipals,
+		ValidAfter:           time.Unix(int64(cert.ValidAfter), 0).UTC(),
+		Forever:              cert.ValidBefore == ssh.CertTimeInfinity,
+		KeyType:              cert.Key.Type(),
+		KeyFingerprintSHA256: ssh.FingerprintSHA256(cert.Key),
+		CAType:               cert.SignatureKey.Type(),
+		CAFingerprintSHA256:  ssh.FingerprintSHA256(cert.SignatureKey),
+	}
+	if cert.CertType == ssh.HostCert {
+		info.CertType = "host"
+	}
+	if info.Principals == nil {
+		info.Principals = []string{}
+	}
+	if !info.Forever {
+		info.ValidBefore = time.Unix(int64(cert.ValidBefore), 0).UTC()
+	}
+	return info
+}
+
+// KeyBits returns the size of key in bits, 0 is returned for unknown key types.
+// For certificates the size of the certified key is returned.
+func KeyBits(key ssh.PublicKey) int {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *dsa.PublicKey:
+		return k.P.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256 //nolint: gomnd // ed25519 keys are always 256 bits
+	default:
+		return 0
+	}
+}
+
+// DefaultTimeout is the timeout Scan uses if no timeout was specified.
+const DefaultTimeout = time.Minute
+
+// ScanOptions configures Scan.
+type ScanOptions struct {
+	// ConcurrentWorkers is the number of connections that are made at the same time.
+	ConcurrentWorkers int
+	// Timeout is the timeout of each worker, DefaultTimeout is used if zero.
+	Timeout time.Duration
+	// Algorithms to request, DefaultKeyAlgorithms is used if empty.
+	Algorithms []string
+	// Native fetches the keys of the host key algorithms the server advertises,
+	// but that are not in Algorithms, with GetHostKeyNative.
+	// This finds keys of types golang.org/x/crypto/ssh does not support (e.g. ssh-ed448 or x509v3-*).
+	Native bool
+	// Auth enables the authenticated scan, the keys of GetAnnouncedKeys are merged into the result.
+	Auth *AuthOptions
+	// AuthMethodsUser enables the discovery of the authentication methods (see GetAuthMethods) for this user.
+	AuthMethodsUser string
+	// VerifyAlgorithms checks each advertised kex, cipher and MAC algorithm with its own handshake (see VerifyAlgorithms).
+	VerifyAlgorithms bool
+	// ProbeGEX probes the Diffie-Hellman group exchange with DefaultGEXRequests (see ProbeGEX).
+	ProbeGEX bool
+	// KRL flags the keys and certificates it revokes in KeyResult.Revoked.
+	KRL *KRL
+}
+
+// AuthMethodsError is the key in HostResult.Errors that is used if the authentication methods could not be discovered.
+const AuthMethodsError = "auth-methods"
+
+// VerifyAlgorithmsError is the key in HostResult.Errors that is used if the algorithms could not be verified.
+const VerifyAlgorithmsError = "verify-algorithms"
+
+// GEXError is the key in HostResult.Errors that is used if the group exchange could not be probed.
+const GEXError = "dh-gex"
+
+// KRLError is the key in HostResult.Errors that is used if the keys could not be checked against ScanOptions.KRL.
+const KRLError = "krl"
+
+// ServerAlgorithmsError is the key in HostResult.Errors that is used if the advertised algorithms could not be read.
+const ServerAlgorithmsError = "server-algorithms"
+
+// nativeKeyAlgorithms returns the host key algorithms the server advertises that are not in algorithms.
+func nativeKeyAlgorithms(serverAlgorithms *ServerAlgorithms, algorithms []string) []string {
+	var nativeAlgorithms []string
+	for _, algo := range serverAlgorithms.HostKeyAlgorithms {
+		if !containsString(algorithms, algo) {
+			nativeAlgorithms = append(nativeAlgorithms, algo)
+		}
+	}
+	return nativeAlgorithms
+}
+
+// Scan fetches the banner and the keys of host.
+// Unlike GetKeys it does not stop on the first error, failed algorithms are reported in HostResult.Errors.
+// The returned error is also stored in HostResult.Error.
+func Scan(ctx context.Context, host string, options ScanOptions) (*HostResult, error) {
+	result := &HostResult{
+		Host:    host,
+		Address: host,
+		Keys:    []KeyResult{},
+		Timings: Timings{
+			Started: time.Now().UTC(),
+		},
+	}
+	defer func() {
+		result.Timings.TotalMS = time.Since(result.Timings.Started).Milliseconds()
+	}()
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	bannerCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+	banner, err := GetVersion(bannerCtx, host)
+	cancel()
+	result.Timings.BannerMS = time.Since(result.Timings.Started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	result.Banner = banner
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	algorithms := keyAlgorithms(options.Algorithms)
+	keys := make(map[string]ssh.PublicKey)
+	result.Timings.Algorithms = make(map[string]int64, len(algorithms))
+	collect := func(resultChan <-chan workerResult, count int) {
+		for i := 0; i < count; i++ {
+			r := <-resultChan
+			result.Timings.Algorithms[r.algo] = r.duration.Milliseconds()
+			if result.ServerAlgorithms == nil {
+				result.ServerAlgorithms = r.serverAlgorithms
+			}
+			if r.err != nil {
+				result.setError(r.algo, r.err.Error())
+				continue
+			}
+			if r.key != nil {
+				keys[r.algo] = r.key
+			}
+		}
+	}
+	collect(fetchKeys(workerCtx, host, options.ConcurrentWorkers, options.Timeout, algorithms, getPublicKey), len(algorithms))
+
+	if result.ServerAlgorithms == nil {
+		// none of the connections received the SSH_MSG_KEXINIT of the server
+		algorithmsCtx, cancel := context.WithTimeout(workerCtx, options.Timeout)
+		result.ServerAlgorithms, err = GetServerAlgorithms(algorithmsCtx, host)
+		cancel()
+		if err != nil {
+			result.setError(ServerAlgorithmsError, err.Error())
+		}
+	}
+	if result.ServerAlgorithms != nil {
+		result.HASSHServer, result.HASSHServerAlgorithms = result.ServerAlgorithms.HASSHServer()
+		result.Terrapin = result.ServerAlgorithms.Terrapin()
+		result.PostQuantum = result.ServerAlgorithms.PostQuantum()
+	}
+
+	if options.Native && result.ServerAlgorithms != nil {
+		nativeAlgorithms := nativeKeyAlgorithms(result.ServerAlgorithms, algorithms)
+		collect(
+			fetchKeys(workerCtx, host, options.ConcurrentWorkers, options.Timeout, nativeAlgorithms, getHostKeyNative),
+			len(nativeAlgorithms),
+		)
+	}
+
+	result.Keys, err = GroupKeys(keys)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	if options.Auth != nil {
+		authCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+		announcedKeys, err := GetAnnouncedKeys(authCtx, host, *options.Auth)
+		cancel()
+		if err == nil {
+			err = result.MergeAnnouncedKeys(announcedKeys)
+		}
+		if err != nil {
+			result.setError(HostKeysRequest, err.Error())
+		}
+	}
+
+	if options.AuthMethodsUser != "" {
+		authCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+		result.AuthMethods, err = GetAuthMethods(authCtx, host, options.AuthMethodsUser)
+		cancel()
+		if err != nil {
+			result.setError(AuthMethodsError, err.Error())
+		}
+	}
+
+	if options.VerifyAlgorithms && result.ServerAlgorithms != nil {
+		result.VerifiedAlgorithms, err = VerifyAlgorithms(ctx, host, options.ConcurrentWorkers, options.Timeout, result.ServerAlgorithms)
+		if err != nil {
+			result.setError(VerifyAlgorithmsError, err.Error())
+		}
+	}
+
+	if options.ProbeGEX && result.ServerAlgorithms != nil {
+		result.GEX, err = probeGEX(ctx, host, result.ServerAlgorithms, options.Timeout, nil)
+		if err != nil {
+			result.setError(GEXError, err.Error())
+		}
+	}
+
+	if options.KRL != nil {
+		if _, err := result.CheckRevoked(options.KRL); err != nil {
+			result.setError(KRLError, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// setError stores msg as the error of algo in r.Errors.
+func (r *HostResult) setError(algo, msg string) {
+	if r.Errors == nil {
+		r.Errors = make(map[string]string)
+	}
+	r.Errors[algo] = msg
+}
+
+// CheckRevoked sets KeyResult.Revoked of the keys krl revokes and reports whether any key is revoked.
+// Keys that can not be parsed are skipped, the first parse error is returned.
+func (r *HostResult) CheckRevoked(krl *KRL) (bool, error) {
+	anyRevoked := false
+	var firstErr error
+	for i := range r.Keys {
+		key, err := r.Keys[i].PublicKey()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		revoked, reason := krl.IsRevoked(key)
+		r.Keys[i].Revoked = reason
+		anyRevoked = anyRevoked || revoked
+	}
+	return anyRevoked, firstErr
+}
+
+// MergeAnnouncedKeys adds the keys of GetAnnouncedKeys to the result and marks the announced and proven keys.
+// Keys that were not returned by any algorithm are added without algorithms.
+func (r *HostResult) MergeAnnouncedKeys(keys []AnnouncedKey) error {
+	for _, announced := range keys {
+		blob := announced.Key.Marshal()
+		found := false
+		for i := range r.Keys {
+			key, err := r.Keys[i].PublicKey()
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(key.Marshal(), blob) {
+				r.Keys[i].Announced = true
+				r.Keys[i].Proven = r.Keys[i].Proven || announced.Proven
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		kr, err := NewKeyResult(announced.Key)
+		if err != nil {
+			return err
+		}
+		kr.Algorithms = []string{}
+		kr.Announced = true
+		kr.Proven = announced.Proven
+		r.Keys = append(r.Keys, kr)
+	}
+	sortKeyResults(r.Keys)
+	return nil
+}
+
+// GroupKeys creates a KeyResult for every distinct key in keys, the map of algorithms and keys returned by GetKeys.
+// The results are sorted by type and key.
+func GroupKeys(keys map[string]ssh.PublicKey) ([]KeyResult, error) {
+	algorithms := make([]string, 0, len(keys))
+	for algo := range keys {
+		algorithms = append(algorithms, algo)
+	}
+	sort.Strings(algorithms)
+
+	results := []KeyResult{}
+	for _, algo := range algorithms {
+		key := keys[algo]
+		found := false
+		for i := range results {
+			if bytes.Equal(results[i].key.Marshal(), key.Marshal()) {
+				results[i].Algorithms = append(results[i].Algorithms, algo)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		kr, err := NewKeyResult(key)
+		if err != nil {
+			return nil, err
+		}
+		kr.Algorithms = []string{algo}
+		results = append(results, kr)
+	}
+
+	sortKeyResults(results)
+	return results, nil
+}
+
+// sortKeyResults sorts the results by type and key.
+func sortKeyResults(results []KeyResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Type != results[j].Type {
+			return results[i].Type < results[j].Type
+		}
+		return results[i].AuthorizedKey < results[j].AuthorizedKey
+	})
+}
+
+// KeysByAlgorithm returns the authorized key of each algorithm.
+func (r *HostResult) KeysByAlgorithm() map[string]string {
+	keys := make(map[string]string)
+	for _, key := range r.Keys {
+		for _, algo := range key.Algorithms {
+			keys[algo] = key.AuthorizedKey
+		}
+	}
+	return keys
+}
+
+// HostScan converts the result to a HostScan that can be used with DiffScans.
+// Keys are represented by their authorized key.
+func (r *HostResult) HostScan() HostScan {
+	return HostScan{
+		Host:   r.Host,
+		Banner: r.Banner,
+		Keys:   r.KeysByAlgorithm(),
+		Error:  r.Error,
+	}
+}
@@ -0,0 +1,92 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateRSAKey, err := createRSAKey(2048)
+	require.NoError(t, err)
+
+	privateECKey, err := createECDSAKey(elliptic.P384())
+	require.NoError(t, err)
+
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateRSAKey, privateECKey},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	result, err := sshkeys.Scan(context.Background(), l.Addr().String(), sshkeys.ScanOptions{
+		ConcurrentWorkers: 4,
+		Timeout:           time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, l.Addr().String(), result.Address)
+	require.Equal(t, "SSH-2.0-Go", result.Banner)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.Timings.Algorithms, len(sshkeys.DefaultKeyAlgorithms()))
+
+	require.Len(t, result.Keys, 2)
+	ecKey := result.Keys[0]
+	require.Equal(t, []string{xssh.KeyAlgoECDSA384}, ecKey.Algorithms)
+	require.Equal(t, xssh.KeyAlgoECDSA384, ecKey.Type)
+	require.Equal(t, 384, ecKey.Bits)
+	require.Equal(t, xssh.FingerprintSHA256(privateECKey.PublicKey()), "SHA256:"+ecKey.Fingerprints.SHA256.Base64)
+	require.Equal(t, xssh.FingerprintLegacyMD5(privateECKey.PublicKey()), ecKey.Fingerprints.MD5.Hex)
+
+	rsaKey := result.Keys[1]
+	require.Equal(t, []string{xssh.KeyAlgoRSASHA256, xssh.KeyAlgoRSASHA512, xssh.KeyAlgoRSA}, rsaKey.Algorithms)
+	require.Equal(t, xssh.KeyAlgoRSA, rsaKey.Type)
+	require.Equal(t, 2048, rsaKey.Bits)
+	require.Nil(t, rsaKey.Certificate)
+
+	// a decoded report must describe the same keys
+	buf, err := json.Marshal(sshkeys.NewReport(*result))
+	require.NoError(t, err)
+	var report sshkeys.Report
+	require.NoError(t, json.Unmarshal(buf, &report))
+	require.Equal(t, sshkeys.SchemaVersion, report.SchemaVersion)
+	require.Len(t, report.Hosts, 1)
+	key, err := report.Hosts[0].Keys[1].PublicKey()
+	require.NoError(t, err)
+	require.Equal(t, privateRSAKey.PublicKey().Marshal(), key.Marshal())
+	require.Equal(t, result.KeysByAlgorithm(), report.Hosts[0].HostScan().Keys)
+}
+
+func TestScanUnreachable(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	result, err := sshkeys.Scan(context.Background(), addr, sshkeys.ScanOptions{})
+	require.Error(t, err)
+	require.Equal(t, err.Error(), result.Error)
+	require.Empty(t, result.Keys)
+}
@@ -0,0 +1,314 @@
+package sshkeys
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth limits the nesting of Include directives.
+const maxIncludeDepth = 16
+
+// SSHConfig is a parsed ssh_config file.
+// Only the keywords that are needed to find the address of a host are evaluated:
+// HostName, Port, HostKeyAlias and User. Match blocks are not supported and never match.
+type SSHConfig struct {
+	blocks []sshConfigBlock
+}
+
+type sshConfigBlock struct {
+	// patterns of the Host line, nil for the options before the first Host line.
+	patterns []string
+	// match is set for Match blocks, they are skipped.
+	match   bool
+	options [][2]string
+}
+
+// SSHHostConfig contains the settings of a single host.
+type SSHHostConfig struct {
+	// Host is the host (or alias) the settings were resolved for.
+	Host         string
+	HostName     string
+	Port         string
+	HostKeyAlias string
+	User         string
+}
+
+// Address returns the host:port address that ssh would connect to.
+func (c *SSHHostConfig) Address() string {
+	hostName := c.HostName
+	if hostName == "" {
+		hostName = c.Host
+	}
+	port := c.Port
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(hostName, port)
+}
+
+// LoadSSHConfig reads and parses the ssh_config file name.
+// A leading ~ is replaced with the home directory, relative Include paths are resolved relative to ~/.ssh.
+func LoadSSHConfig(name string) (*SSHConfig, error) {
+	p := sshConfigParser{}
+	if err := p.parseFile(expandHome(name), nil, 0); err != nil {
+		return nil, err
+	}
+	return &SSHConfig{blocks: p.blocks}, nil
+}
+
+// ParseSSHConfig parses a ssh_config file from r.
+func ParseSSHConfig(r io.Reader) (*SSHConfig, error) {
+	p := sshConfigParser{}
+	if err := p.parse(r, nil, 0); err != nil {
+		return nil, err
+	}
+	return &SSHConfig{blocks: p.blocks}, nil
+}
+
+// Resolve returns the settings for host. Like ssh the first obtained value of each keyword is used.
+func (c *SSHConfig) Resolve(host string) SSHHostConfig {
+	result := SSHHostConfig{Host: host}
+	for _, block := range c.blocks {
+		if block.match || (block.patterns != nil && !matchHostPatterns(block.patterns, host)) {
+			continue
+		}
+		for _, option := range block.options {
+			var dst *string
+			switch option[0] {
+			case "hostname":
+				dst = &result.HostName
+			case "port":
+				dst = &result.Port
+			case "hostkeyalias":
+				dst = &result.HostKeyAlias
+			case "user":
+				dst = &result.User
+			default:
+				continue
+			}
+			if *dst == "" {
+				*dst = option[1]
+			}
+		}
+	}
+	result.HostName = expandHostTokens(result.HostName, host)
+	return result
+}
+
+type sshConfigParser struct {
+	blocks []sshConfigBlock
+}
+
+func (p *sshConfigParser) parseFile(name string, patterns []string, depth int) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.parse(f, patterns, depth)
+}
+
+// parse parses the config in r, options before the first Host line belong to patterns.
+func (p *sshConfigParser) parse(r io.Reader, patterns []string, depth int) error {
+	if depth > maxIncludeDepth {
+		return errors.New("ssh config: too many nested includes")
+	}
+	p.blocks = append(p.blocks, sshConfigBlock{patterns: patterns})
+	current := &p.blocks[len(p.blocks)-1]
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		keyword, args, err := splitSSHConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("ssh config: line %d: %w", lineNumber, err)
+		}
+		switch keyword {
+		case "":
+			continue
+		case "host":
+			p.blocks = append(p.blocks, sshConfigBlock{patterns: args})
+			current = &p.blocks[len(p.blocks)-1]
+		case "match":
+			p.blocks = append(p.blocks, sshConfigBlock{match: true})
+			current = &p.blocks[len(p.blocks)-1]
+		case "include":
+			// the included options belong to the current block
+			includePatterns, match := current.patterns, current.match
+			for _, arg := range args {
+				if err := p.include(arg, includePatterns, match, depth); err != nil {
+					return fmt.Errorf("ssh config: line %d: %w", lineNumber, err)
+				}
+			}
+			p.blocks = append(p.blocks, sshConfigBlock{patterns: includePatterns, match: match})
+			current = &p.blocks[len(p.blocks)-1]
+		default:
+			if len(args) == 0 {
+				return fmt.Errorf("ssh config: line %d: %s has no value", lineNumber, keyword)
+			}
+			current.options = append(current.options, [2]string{keyword, args[0]})
+		}
+	}
+	return scanner.Err()
+}
+
+func (p *sshConfigParser) include(pattern string, patterns []string, match bool, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(expandHome("~/.ssh"), pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if match {
+			continue
+		}
+		if err := p.parseFile(file, patterns, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine splits a line into the lower case keyword and its arguments.
+// Both "Keyword value" and "Keyword=value" are supported, arguments can be quoted.
+func splitSSHConfigLine(line string) (keyword string, args []string, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", nil, nil
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword = strings.ToLower(line[:i])
+	rest := strings.TrimLeft(line[i:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	var sb strings.Builder
+	inQuotes := false
+	hasArg := false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case !inQuotes && (r == ' ' || r == '\t'):
+			if hasArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				hasArg = false
+			}
+		case !inQuotes && r == '#' && !hasArg:
+			return keyword, args, nil
+		default:
+			sb.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if inQuotes {
+		return "", nil, errors.New("unterminated quote")
+	}
+	if hasArg {
+		args = append(args, sb.String())
+	}
+	return keyword, args, nil
+}
+
+// matchHostPatterns reports whether host matches the patterns of a Host line.
+// A matching negated pattern (!pattern) always prevents the match.
+func matchHostPatterns(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "!"))
+		if !matchWildcard(pattern, host) {
+			continue
+		}
+		if negate {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchWildcard matches s against pattern, * matches any sequence and ? any single character.
+func matchWildcard(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for pattern != "" && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchWildcard(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return s == ""
+}
+
+// expandHostTokens replaces the %h and %% tokens of a HostName value.
+func expandHostTokens(hostName, host string) string {
+	if !strings.Contains(hostName, "%") {
+		return hostName
+	}
+	var sb strings.Builder
+	for i := 0; i < len(hostName); i++ {
+		if hostName[i] != '%' || i+1 >= len(hostName) {
+			sb.WriteByte(hostName[i])
+			continue
+		}
+		i++
+		switch hostName[i] {
+		case 'h':
+			sb.WriteString(host)
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hostName[i])
+		}
+	}
+	return sb.String()
+}
+
+func expandHome(name string) string {
+	if name != "~" && !strings.HasPrefix(name, "~/") {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, name[1:])
+}
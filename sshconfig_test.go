@@ -0,0 +1,107 @@
+package sshkeys_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHConfigResolve(t *testing.T) {
+	t.Parallel()
+	config, err := sshkeys.ParseSSHConfig(strings.NewReader(`
+# global options
+Port 2200
+
+Host prod-db
+  HostName db1.internal.example.com
+  HostKeyAlias "db.example.com"
+  Port 2222
+
+Host *.example.com !secret.example.com
+  HostName=%h.internal
+  User admin
+
+Match host something
+  HostName match.example.com
+
+Host *
+  User root
+  Port 22
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		host     string
+		expected sshkeys.SSHHostConfig
+		address  string
+	}{
+		{
+			host: "prod-db",
+			expected: sshkeys.SSHHostConfig{
+				Host:         "prod-db",
+				HostName:     "db1.internal.example.com",
+				Port:         "2200",
+				HostKeyAlias: "db.example.com",
+				User:         "root",
+			},
+			address: "db1.internal.example.com:2200",
+		},
+		{
+			host: "web.example.com",
+			expected: sshkeys.SSHHostConfig{
+				Host:     "web.example.com",
+				HostName: "web.example.com.internal",
+				Port:     "2200",
+				User:     "admin",
+			},
+			address: "web.example.com.internal:2200",
+		},
+		{
+			host: "secret.example.com",
+			expected: sshkeys.SSHHostConfig{
+				Host: "secret.example.com",
+				Port: "2200",
+				User: "root",
+			},
+			address: "secret.example.com:2200",
+		},
+	}
+	for _, test := range tests {
+		hostConfig := config.Resolve(test.host)
+		require.Equal(t, test.expected, hostConfig, test.host)
+		require.Equal(t, test.address, hostConfig.Address(), test.host)
+	}
+}
+
+func TestLoadSSHConfigInclude(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts.conf"), []byte(`
+HostName included.example.com
+Port 2022
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte(`
+Host included
+  Include `+filepath.Join(dir, "*.conf")+`
+Host other
+  HostName other.example.com
+`), 0o600))
+
+	config, err := sshkeys.LoadSSHConfig(filepath.Join(dir, "config"))
+	require.NoError(t, err)
+
+	hostConfig := config.Resolve("included")
+	require.Equal(t, "included.example.com:2022", hostConfig.Address())
+	hostConfig = config.Resolve("other")
+	require.Equal(t, "other.example.com:22", hostConfig.Address())
+}
+
+func TestParseSSHConfigError(t *testing.T) {
+	t.Parallel()
+	_, err := sshkeys.ParseSSHConfig(strings.NewReader("Host a\n  HostName \"unterminated\n"))
+	require.Error(t, err)
+}
@@ -53,27 +53,11 @@ func GetKeys(
 	timeout time.Duration,
 	algorithms ...string,
 ) (map[string]ssh.PublicKey, error) {
-	if len(algorithms) == 0 {
-		algorithms = DefaultKeyAlgorithms()
-	}
-
-	if concurrentWorkers < 0 {
-		concurrentWorkers = 1
-	}
-
 	workerCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	algoChan := make(chan string, len(algorithms))
-	for _, algo := range algorithms {
-		algoChan <- algo
-	}
-
-	resultChan := make(chan workerResult, len(algorithms))
-
-	for i := 0; i < concurrentWorkers; i++ {
-		go worker(workerCtx, host, timeout, algoChan, resultChan)
-	}
+	algorithms = keyAlgorithms(algorithms)
+	resultChan := fetchKeys(workerCtx, host, concurrentWorkers, timeout, algorithms, getPublicKey)
 
 	keys := make(map[string]ssh.PublicKey)
 	for range algorithms {
@@ -88,43 +72,110 @@ func GetKeys(
 	return keys, nil
 }
 
+func keyAlgorithms(algorithms []string) []string {
+	if len(algorithms) == 0 {
+		return DefaultKeyAlgorithms()
+	}
+	return algorithms
+}
+
+// keyProbe fetches the key of a single algorithm, nil is returned if the server does not support the algorithm.
+// The algorithms the server advertised are returned if they are known.
+type keyProbe func(ctx context.Context, host, algo string) (ssh.PublicKey, *ServerAlgorithms, error)
+
+// fetchKeys starts the workers, the returned channel receives exactly one result per algorithm.
+func fetchKeys(
+	ctx context.Context,
+	host string,
+	concurrentWorkers int,
+	timeout time.Duration,
+	algorithms []string,
+	probe keyProbe,
+) <-chan workerResult {
+	if concurrentWorkers < 1 {
+		concurrentWorkers = 1
+	}
+
+	algoChan := make(chan string, len(algorithms))
+	for _, algo := range algorithms {
+		algoChan <- algo
+	}
+	close(algoChan)
+
+	resultChan := make(chan workerResult, len(algorithms))
+
+	for i := 0; i < concurrentWorkers; i++ {
+		go worker(ctx, host, timeout, probe, algoChan, resultChan)
+	}
+	return resultChan
+}
+
 type workerResult struct {
-	algo string
-	key  ssh.PublicKey
-	err  error
+	algo             string
+	key              ssh.PublicKey
+	serverAlgorithms *ServerAlgorithms
+	err              error
+	duration         time.Duration
 }
 
-func worker(ctx context.Context, host string, timeout time.Duration, algoChan chan string, resultChan chan workerResult) {
+func worker(
+	ctx context.Context,
+	host string,
+	timeout time.Duration,
+	probe keyProbe,
+	algoChan <-chan string,
+	resultChan chan<- workerResult,
+) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case algo := <-algoChan:
-			key, err := getPublicKey(ctx, host, algo)
-			resultChan <- workerResult{algo, key, err}
+	for algo := range algoChan {
+		// report the remaining algorithms as failed once the context is done
+		if err := ctx.Err(); err != nil {
+			resultChan <- workerResult{algo: algo, err: err}
+			continue
 		}
+		start := time.Now()
+		key, serverAlgorithms, err := probe(ctx, host, algo)
+		resultChan <- workerResult{algo: algo, key: key, serverAlgorithms: serverAlgorithms, err: err, duration: time.Since(start)}
 	}
 }
 
-func getPublicKey(ctx context.Context, host, algo string) (key ssh.PublicKey, err error) {
+func getPublicKey(ctx context.Context, host, algo string) (ssh.PublicKey, *ServerAlgorithms, error) {
+	key, recorder, err := offerHostKeyAlgorithms(ctx, host, []string{algo})
+	return key, recorder.ServerAlgorithms(), err
+}
+
+// GetHostKey connects once to host and offers all algorithms in a single SSH_MSG_KEXINIT, like ssh-keyscan does
+// for the algorithms of a key type. The server chooses the first of the algorithms it supports.
+// It returns the key, nil if the server supports none of the algorithms, and the version of the server,
+// the version is also returned if the key exchange failed after the versions were exchanged.
+func GetHostKey(ctx context.Context, host string, algorithms ...string) (ssh.PublicKey, string, error) {
+	key, recorder, err := offerHostKeyAlgorithms(ctx, host, algorithms)
+	return key, recorder.Version(), err
+}
+
+// offerHostKeyAlgorithms connects to host and returns the host key of the first algorithm the server supports,
+// the returned recorder contains what the server sent before the key exchange.
+func offerHostKeyAlgorithms(ctx context.Context, host string, algorithms []string) (ssh.PublicKey, *kexInitRecorder, error) {
+	recorder := &kexInitRecorder{}
 	var d net.Dialer
 	conn, err := d.DialContext(ctx, "tcp", host)
 	if err != nil {
-		return nil, err
+		return nil, recorder, err
 	}
 	defer conn.Close()
+	recorder.Conn = conn
 
+	var key ssh.PublicKey
 	id := uuid.NewString()
 	config := ssh.ClientConfig{
 		Auth:              nil,
-		HostKeyAlgorithms: []string{algo},
+		HostKeyAlgorithms: algorithms,
 		HostKeyCallback:   hostKeyCallback(id, &key),
 	}
 	ch := make(chan error)
 	go func() {
-		sshconn, _, _, err := ssh.NewClientConn(conn, host, &config)
+		sshconn, _, _, err := ssh.NewClientConn(recorder, host, &config)
 		if err != nil {
 			if strings.Contains(err.Error(), "no common algorithm for host key") {
 				ch <- nil
@@ -143,9 +194,9 @@ func getPublicKey(ctx context.Context, host, algo string) (key ssh.PublicKey, er
 
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, recorder, ctx.Err()
 	case err := <-ch:
-		return key, err
+		return key, recorder, err
 	}
 }
 
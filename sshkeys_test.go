@@ -95,3 +95,43 @@ func TestGetKeys(t *testing.T) {
 		xssh.KeyAlgoECDSA256:  xssh.FingerprintSHA256(privateECKey.PublicKey()),
 	}, fingerprints)
 }
+
+func TestGetHostKey(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	expectedVersion := "SSH-2.0-" + strconv.FormatInt(time.Now().Unix(), 36)
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateECKey},
+		ServerConfigCallback: func(ctx ssh.Context) *xssh.ServerConfig {
+			return &xssh.ServerConfig{ServerVersion: expectedVersion}
+		},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	// the server chooses the algorithm it supports out of all offered algorithms
+	key, version, err := sshkeys.GetHostKey(context.Background(), l.Addr().String(),
+		xssh.KeyAlgoECDSA521, xssh.KeyAlgoECDSA384, xssh.KeyAlgoECDSA256)
+	require.NoError(t, err)
+	require.Equal(t, expectedVersion, version)
+	require.Equal(t, xssh.FingerprintSHA256(privateECKey.PublicKey()), xssh.FingerprintSHA256(key))
+
+	// the version is known even if the server supports none of the algorithms
+	key, version, err = sshkeys.GetHostKey(context.Background(), l.Addr().String(), xssh.KeyAlgoED25519)
+	require.NoError(t, err)
+	require.Equal(t, expectedVersion, version)
+	require.Nil(t, key)
+}
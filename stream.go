@@ -0,0 +1,38 @@
+package sshkeys
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// HostRecord is a single line of a NDJSON stream, it is a HostResult together with the schema version.
+// Failed hosts use the same record with the Error field set.
+type HostRecord struct {
+	SchemaVersion int `json:"schema_version"`
+	HostResult
+}
+
+// NDJSONEncoder writes one HostRecord per line.
+// It is safe to use from multiple goroutines, so results can be written as soon as a host was scanned.
+type NDJSONEncoder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewNDJSONEncoder creates a NDJSONEncoder that writes to w.
+func NewNDJSONEncoder(w io.Writer) *NDJSONEncoder {
+	return &NDJSONEncoder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Encode writes result as a single line.
+func (e *NDJSONEncoder) Encode(result *HostResult) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(HostRecord{
+		SchemaVersion: SchemaVersion,
+		HostResult:    *result,
+	})
+}
@@ -0,0 +1,46 @@
+package sshkeys_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONEncoder(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	enc := sshkeys.NewNDJSONEncoder(&buf)
+
+	require.NoError(t, enc.Encode(&sshkeys.HostResult{
+		Host:    "example.com",
+		Address: "example.com:22",
+		Banner:  "SSH-2.0-OpenSSH_9.6",
+		Keys:    []sshkeys.KeyResult{{Algorithms: []string{"ssh-ed25519"}, Type: "ssh-ed25519"}},
+	}))
+	require.NoError(t, enc.Encode(sshkeys.NewFailedResult("example.org", "example.org:22", errors.New("connection refused"))))
+
+	scanner := bufio.NewScanner(&buf)
+	var records []sshkeys.HostRecord
+	for scanner.Scan() {
+		var record sshkeys.HostRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, records, 2)
+
+	require.Equal(t, sshkeys.SchemaVersion, records[0].SchemaVersion)
+	require.Equal(t, "example.com", records[0].Host)
+	require.Equal(t, "SSH-2.0-OpenSSH_9.6", records[0].Banner)
+	require.Equal(t, "ssh-ed25519", records[0].Keys[0].Type)
+
+	require.Equal(t, sshkeys.SchemaVersion, records[1].SchemaVersion)
+	require.Equal(t, "example.org", records[1].Host)
+	require.Equal(t, "connection refused", records[1].Error)
+	require.Empty(t, records[1].Keys)
+}
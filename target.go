@@ -0,0 +1,174 @@
+package sshkeys
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// DefaultPort is the port that is used if a target does not specify one.
+const DefaultPort = "22"
+
+// Target is a parsed host specification.
+// It is derived from the input by stripping the scheme, user and path.
+type Target struct {
+	// Input is the specification as it was passed to ParseTarget.
+	Input string `json:"input"`
+	// Scheme is set for URIs (e.g. ssh).
+	Scheme string `json:"scheme,omitempty"`
+	// User is the user of user@host specifications, it is not used for scanning.
+	User string `json:"user,omitempty"`
+	// Host is the hostname or ip, ipv6 addresses are not enclosed in brackets but can contain a zone.
+	Host string `json:"host"`
+	Port string `json:"port"`
+	// DefaultPort is set if the input did not contain a port.
+	DefaultPort bool `json:"default_port,omitempty"`
+	// Path is the path of URIs and scp like specifications (host:path), it is not used for scanning.
+	Path string `json:"path,omitempty"`
+}
+
+var targetSchemes = map[string]struct{}{
+	"ssh":     {},
+	"git+ssh": {},
+	"ssh+git": {},
+	"sftp":    {},
+	"scp":     {},
+}
+
+// ParseTarget parses a host specification, supported are
+//
+//	host, host:port, user@host, [ipv6%zone]:port, ipv6%zone
+//	user@host:path (scp like)
+//	ssh://user@host:port/path (also git+ssh, ssh+git, sftp and scp)
+func ParseTarget(s string) (Target, error) {
+	t := Target{Input: s}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return t, errors.New("empty host")
+	}
+
+	isURI := false
+	if i := strings.Index(s, "://"); i >= 0 {
+		t.Scheme = strings.ToLower(s[:i])
+		if _, ok := targetSchemes[t.Scheme]; !ok {
+			return t, fmt.Errorf("'%s' has an unsupported scheme %q", t.Input, t.Scheme)
+		}
+		isURI = true
+		s = s[i+3:]
+		if j := strings.IndexAny(s, "/?#"); j >= 0 {
+			t.Path = s[j:]
+			s = s[:j]
+		}
+	}
+
+	// the user is everything before the first @ that is not part of the path
+	if i := strings.IndexByte(s, '@'); i >= 0 && !strings.ContainsAny(s[:i], "[:/") {
+		t.User = s[:i]
+		s = s[i+1:]
+	}
+
+	var rest string
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return t, fmt.Errorf("'%s' has a missing ]", t.Input)
+		}
+		t.Host = strings.ReplaceAll(s[1:end], "%25", "%")
+		rest = s[end+1:]
+		if rest != "" && rest[0] != ':' {
+			return t, fmt.Errorf("'%s' has unexpected characters after ]", t.Input)
+		}
+		rest = strings.TrimPrefix(rest, ":")
+	case strings.Count(s, ":") > 1:
+		// ipv6 address without brackets, it cannot have a port
+		t.Host = s
+	default:
+		t.Host = s
+		if i := strings.IndexByte(s, ':'); i >= 0 {
+			t.Host = s[:i]
+			rest = s[i+1:]
+		}
+	}
+
+	switch {
+	case rest == "":
+		t.Port = DefaultPort
+		t.DefaultPort = true
+	case isDigits(rest):
+		t.Port = rest
+	case isURI:
+		return t, fmt.Errorf("'%s' has an invalid port", t.Input)
+	default:
+		// scp like host:path
+		t.Path = rest
+		t.Port = DefaultPort
+		t.DefaultPort = true
+	}
+
+	if err := validateTargetHost(t.Host); err != nil {
+		return t, fmt.Errorf("'%s' is not a valid hostname", t.Input)
+	}
+	if port, err := strconv.Atoi(t.Port); err != nil || port < 1 || port > 65535 {
+		return t, fmt.Errorf("'%s' has an invalid port", t.Input)
+	}
+	return t, nil
+}
+
+func validateTargetHost(host string) error {
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		// zones are only allowed for ipv6 addresses
+		ip := net.ParseIP(host[:i])
+		if ip == nil || ip.To4() != nil || i == len(host)-1 {
+			return errors.New("invalid zone")
+		}
+		return nil
+	}
+	if !govalidator.IsHost(host) {
+		return errors.New("invalid host")
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Address returns the host:port address of the target.
+func (t *Target) Address() string {
+	return net.JoinHostPort(t.Host, t.Port)
+}
+
+// Stripped reports whether parts of the input (scheme, user or path) are not used for scanning.
+func (t *Target) Stripped() bool {
+	return t.Scheme != "" || t.User != "" || t.Path != ""
+}
+
+// Description describes how the address was derived from the input,
+// e.g. ssh://git@example.com/repo.git -> example.com:22 (ignored user "git", path "/repo.git").
+func (t *Target) Description() string {
+	var ignored []string
+	if t.Scheme != "" {
+		ignored = append(ignored, fmt.Sprintf("scheme %q", t.Scheme))
+	}
+	if t.User != "" {
+		ignored = append(ignored, fmt.Sprintf("user %q", t.User))
+	}
+	if t.Path != "" {
+		ignored = append(ignored, fmt.Sprintf("path %q", t.Path))
+	}
+	s := t.Input + " -> " + t.Address()
+	if len(ignored) > 0 {
+		s += " (ignored " + strings.Join(ignored, ", ") + ")"
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package sshkeys_test
+
+import (
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input   string
+		address string
+		user    string
+		path    string
+	}{
+		{input: "example.com", address: "example.com:22"},
+		{input: "example.com:2222", address: "example.com:2222"},
+		{input: "root@example.com", address: "example.com:22", user: "root"},
+		{input: "root@example.com:2222", address: "example.com:2222", user: "root"},
+		{input: "git@github.com:org/repo.git", address: "github.com:22", user: "git", path: "org/repo.git"},
+		{input: "ssh://git@example.com:7999/repo.git", address: "example.com:7999", user: "git", path: "/repo.git"},
+		{input: "ssh://example.com", address: "example.com:22"},
+		{input: "git+ssh://git@example.com/repo.git", address: "example.com:22", user: "git", path: "/repo.git"},
+		{input: "10.0.0.1", address: "10.0.0.1:22"},
+		{input: "::1", address: "[::1]:22"},
+		{input: "[::1]", address: "[::1]:22"},
+		{input: "[::1]:2222", address: "[::1]:2222"},
+		{input: "[fe80::1%eth0]:22", address: "[fe80::1%eth0]:22"},
+		{input: "fe80::1%eth0", address: "[fe80::1%eth0]:22"},
+		{input: "root@[fe80::1%eth0]:2222", address: "[fe80::1%eth0]:2222", user: "root"},
+		{input: "ssh://root@[fe80::1%25eth0]:2222/", address: "[fe80::1%eth0]:2222", user: "root", path: "/"},
+	}
+	for _, test := range tests {
+		target, err := sshkeys.ParseTarget(test.input)
+		require.NoError(t, err, test.input)
+		require.Equal(t, test.input, target.Input)
+		require.Equal(t, test.address, target.Address(), test.input)
+		require.Equal(t, test.user, target.User, test.input)
+		require.Equal(t, test.path, target.Path, test.input)
+	}
+}
+
+func TestParseTargetInvalid(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{
+		"",
+		"exa mple.com",
+		"example.com:0",
+		"example.com:65536",
+		"http://example.com",
+		"ssh://example.com:port",
+		"[::1",
+		"[::1]x",
+		"10.0.0.1%eth0",
+	} {
+		_, err := sshkeys.ParseTarget(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestTargetDescription(t *testing.T) {
+	t.Parallel()
+	target, err := sshkeys.ParseTarget("ssh://git@example.com:7999/repo.git")
+	require.NoError(t, err)
+	require.True(t, target.Stripped())
+	require.Equal(t,
+		`ssh://git@example.com:7999/repo.git -> example.com:7999 (ignored scheme "ssh", user "git", path "/repo.git")`,
+		target.Description(),
+	)
+
+	target, err = sshkeys.ParseTarget("example.com")
+	require.NoError(t, err)
+	require.False(t, target.Stripped())
+	require.True(t, target.DefaultPort)
+}
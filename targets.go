@@ -0,0 +1,28 @@
+package sshkeys
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ReadTargets reads the hosts to scan from r.
+// Every line can contain one or more hosts (see ParseTarget) separated by whitespace or commas,
+// everything after a # is a comment.
+func ReadTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		targets = append(targets, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
@@ -0,0 +1,22 @@
+package sshkeys_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Eun/sshkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTargets(t *testing.T) {
+	t.Parallel()
+	targets, err := sshkeys.ReadTargets(strings.NewReader(`# production
+example.com
+example.org:2222 # git server
+
+ 10.0.0.1, 10.0.0.2
+[::1]:22
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com", "example.org:2222", "10.0.0.1", "10.0.0.2", "[::1]:22"}, targets)
+}
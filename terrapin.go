@@ -0,0 +1,83 @@
+package sshkeys
+
+import (
+	"context"
+	"strings"
+)
+
+// StrictKexServer is the pseudo kex algorithm a server advertises if it supports strict key exchange.
+const StrictKexServer = "kex-strict-s-v00@openssh.com"
+
+// ChaCha20Poly1305 is the cipher that is vulnerable to Terrapin without strict key exchange.
+const ChaCha20Poly1305 = "chacha20-poly1305@openssh.com"
+
+// cbcCiphers are the CBC mode ciphers of RFC 4253, RFC 4344 and the implementations that offer them.
+var cbcCiphers = []string{
+	"3des-cbc", "aes128-cbc", "aes192-cbc", "aes256-cbc", "blowfish-cbc", "cast128-cbc", "des-cbc",
+	"des-cbc@ssh.com", "idea-cbc", "rijndael-cbc@lysator.liu.se", "serpent128-cbc", "serpent192-cbc",
+	"serpent256-cbc", "twofish-cbc", "twofish128-cbc", "twofish192-cbc", "twofish256-cbc",
+}
+
+// TerrapinResult describes whether a server is vulnerable to the Terrapin attack (CVE-2023-48795).
+type TerrapinResult struct {
+	// StrictKex is set if the server advertises kex-strict-s-v00@openssh.com.
+	StrictKex bool `json:"strict_kex"`
+	// ChaCha20Poly1305 is set if the server offers chacha20-poly1305@openssh.com.
+	ChaCha20Poly1305 bool `json:"chacha20_poly1305"`
+	// CBCEtM is set if the server offers a CBC cipher together with an encrypt-then-mac MAC.
+	CBCEtM bool `json:"cbc_etm"`
+	// VulnerableModes are the offered vulnerable modes, e.g. chacha20-poly1305@openssh.com
+	// or aes128-cbc+hmac-sha2-256-etm@openssh.com.
+	VulnerableModes []string `json:"vulnerable_modes"`
+	// Vulnerable is set if the server offers a vulnerable mode and does not support strict key exchange.
+	Vulnerable bool `json:"vulnerable"`
+}
+
+// Terrapin checks the advertised algorithms for the Terrapin attack (CVE-2023-48795).
+// Both directions are checked, a mode is vulnerable if it is offered in either direction.
+func (a *ServerAlgorithms) Terrapin() *TerrapinResult {
+	result := TerrapinResult{
+		StrictKex:       containsString(a.KexAlgorithms, StrictKexServer),
+		VulnerableModes: []string{},
+	}
+	addMode := func(mode string) {
+		if !containsString(result.VulnerableModes, mode) {
+			result.VulnerableModes = append(result.VulnerableModes, mode)
+		}
+	}
+	for _, direction := range []struct {
+		ciphers []string
+		macs    []string
+	}{
+		{a.CiphersClientServer, a.MACsClientServer},
+		{a.CiphersServerClient, a.MACsServerClient},
+	} {
+		for _, cipher := range direction.ciphers {
+			if cipher == ChaCha20Poly1305 {
+				result.ChaCha20Poly1305 = true
+				addMode(cipher)
+				continue
+			}
+			if !containsString(cbcCiphers, cipher) {
+				continue
+			}
+			for _, mac := range direction.macs {
+				if strings.HasSuffix(mac, "-etm@openssh.com") {
+					result.CBCEtM = true
+					addMode(cipher + "+" + mac)
+				}
+			}
+		}
+	}
+	result.Vulnerable = !result.StrictKex && len(result.VulnerableModes) > 0
+	return &result
+}
+
+// CheckTerrapin reads the algorithms host advertises and checks them for the Terrapin attack.
+func CheckTerrapin(ctx context.Context, host string) (*TerrapinResult, error) {
+	algorithms, err := GetServerAlgorithms(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return algorithms.Terrapin(), nil
+}
@@ -0,0 +1,141 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerrapin(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		algorithms sshkeys.ServerAlgorithms
+		expected   sshkeys.TerrapinResult
+	}{
+		{
+			name: "chacha20-poly1305 without strict kex",
+			algorithms: sshkeys.ServerAlgorithms{
+				KexAlgorithms:       []string{"curve25519-sha256"},
+				CiphersClientServer: []string{"chacha20-poly1305@openssh.com", "aes128-ctr"},
+				CiphersServerClient: []string{"chacha20-poly1305@openssh.com", "aes128-ctr"},
+				MACsClientServer:    []string{"hmac-sha2-256"},
+				MACsServerClient:    []string{"hmac-sha2-256"},
+			},
+			expected: sshkeys.TerrapinResult{
+				ChaCha20Poly1305: true,
+				VulnerableModes:  []string{"chacha20-poly1305@openssh.com"},
+				Vulnerable:       true,
+			},
+		},
+		{
+			name: "cbc with etm",
+			algorithms: sshkeys.ServerAlgorithms{
+				KexAlgorithms:       []string{"curve25519-sha256"},
+				CiphersClientServer: []string{"aes128-ctr", "aes256-cbc"},
+				CiphersServerClient: []string{"aes128-ctr"},
+				MACsClientServer:    []string{"hmac-sha2-256", "hmac-sha2-256-etm@openssh.com"},
+				MACsServerClient:    []string{"hmac-sha2-256-etm@openssh.com"},
+			},
+			expected: sshkeys.TerrapinResult{
+				CBCEtM:          true,
+				VulnerableModes: []string{"aes256-cbc+hmac-sha2-256-etm@openssh.com"},
+				Vulnerable:      true,
+			},
+		},
+		{
+			name: "rijndael-cbc with etm",
+			algorithms: sshkeys.ServerAlgorithms{
+				KexAlgorithms:       []string{"curve25519-sha256"},
+				CiphersClientServer: []string{"aes128-gcm@openssh.com"},
+				CiphersServerClient: []string{"rijndael-cbc@lysator.liu.se", "3des-cbc"},
+				MACsClientServer:    []string{"hmac-sha2-256-etm@openssh.com"},
+				MACsServerClient:    []string{"umac-64-etm@openssh.com"},
+			},
+			expected: sshkeys.TerrapinResult{
+				CBCEtM: true,
+				VulnerableModes: []string{
+					"rijndael-cbc@lysator.liu.se+umac-64-etm@openssh.com",
+					"3des-cbc+umac-64-etm@openssh.com",
+				},
+				Vulnerable: true,
+			},
+		},
+		{
+			name: "strict kex",
+			algorithms: sshkeys.ServerAlgorithms{
+				KexAlgorithms:       []string{"curve25519-sha256", sshkeys.StrictKexServer},
+				CiphersClientServer: []string{"chacha20-poly1305@openssh.com"},
+				CiphersServerClient: []string{"chacha20-poly1305@openssh.com"},
+			},
+			expected: sshkeys.TerrapinResult{
+				StrictKex:        true,
+				ChaCha20Poly1305: true,
+				VulnerableModes:  []string{"chacha20-poly1305@openssh.com"},
+			},
+		},
+		{
+			name: "no vulnerable modes",
+			algorithms: sshkeys.ServerAlgorithms{
+				KexAlgorithms:       []string{"curve25519-sha256"},
+				CiphersClientServer: []string{"aes128-ctr", "aes256-cbc"},
+				CiphersServerClient: []string{"aes256-gcm@openssh.com"},
+				MACsClientServer:    []string{"hmac-sha2-256"},
+				MACsServerClient:    []string{"hmac-sha2-256-etm@openssh.com"},
+			},
+			expected: sshkeys.TerrapinResult{
+				VulnerableModes: []string{},
+			},
+		},
+	}
+	for _, test := range tests {
+		require.Equal(t, &test.expected, test.algorithms.Terrapin(), test.name)
+	}
+}
+
+func TestCheckTerrapin(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateECKey},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	// golang.org/x/crypto/ssh supports strict kex
+	result, err := sshkeys.CheckTerrapin(context.Background(), l.Addr().String())
+	require.NoError(t, err)
+	require.True(t, result.StrictKex)
+	require.False(t, result.Vulnerable)
+
+	// the algorithms are also recorded while the keys are scanned
+	scan, err := sshkeys.Scan(context.Background(), l.Addr().String(), sshkeys.ScanOptions{
+		ConcurrentWorkers: 2,
+		Timeout:           10 * time.Second,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, scan.ServerAlgorithms)
+	require.Contains(t, scan.ServerAlgorithms.KexAlgorithms, sshkeys.StrictKexServer)
+	require.Equal(t, result, scan.Terrapin)
+}
@@ -0,0 +1,423 @@
+package sshkeys
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ClientVersion is the version the native transport sends to the server.
+const ClientVersion = "SSH-2.0-sshkeys"
+
+// message numbers of RFC 4253, RFC 4252 and RFC 5656.
+const (
+	msgDisconnect    = 1
+	msgIgnore        = 2
+	msgUnimplemented = 3
+	msgDebug         = 4
+	msgKexInit       = 20
+	msgKexDHInit     = 30
+	msgKexDHReply    = 31
+)
+
+const (
+	// maxPacketLength limits the size of the packets the native transport accepts.
+	maxPacketLength = 256 * 1024
+	// maxVersionLines limits the lines a server can send before its version.
+	maxVersionLines = 1024
+	// packetBlockSize is the block size of unencrypted packets.
+	packetBlockSize  = 8
+	minPaddingLength = 4
+	kexCookieLength  = 16
+)
+
+// ServerAlgorithms are the algorithms a server advertises in its SSH_MSG_KEXINIT.
+type ServerAlgorithms struct {
+	KexAlgorithms           []string `json:"kex_algorithms"`
+	HostKeyAlgorithms       []string `json:"host_key_algorithms"`
+	CiphersClientServer     []string `json:"ciphers_client_server"`
+	CiphersServerClient     []string `json:"ciphers_server_client"`
+	MACsClientServer        []string `json:"macs_client_server"`
+	MACsServerClient        []string `json:"macs_server_client"`
+	CompressionClientServer []string `json:"compression_client_server"`
+	CompressionServerClient []string `json:"compression_server_client"`
+	LanguagesClientServer   []string `json:"languages_client_server,omitempty"`
+	LanguagesServerClient   []string `json:"languages_server_client,omitempty"`
+	FirstKexPacketFollows   bool     `json:"first_kex_packet_follows,omitempty"`
+}
+
+// nameLists returns pointers to the name-lists in the order of SSH_MSG_KEXINIT.
+func (a *ServerAlgorithms) nameLists() []*[]string {
+	return []*[]string{
+		&a.KexAlgorithms,
+		&a.HostKeyAlgorithms,
+		&a.CiphersClientServer,
+		&a.CiphersServerClient,
+		&a.MACsClientServer,
+		&a.MACsServerClient,
+		&a.CompressionClientServer,
+		&a.CompressionServerClient,
+		&a.LanguagesClientServer,
+		&a.LanguagesServerClient,
+	}
+}
+
+// GetServerAlgorithms returns the algorithms host advertises, the connection is closed after the SSH_MSG_KEXINIT was read.
+func GetServerAlgorithms(ctx context.Context, host string) (*ServerAlgorithms, error) {
+	t, err := dialTransport(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return t.serverAlgorithms, nil
+}
+
+// transport is a minimal ssh transport that only supports unencrypted packets,
+// it is used to talk to the server before and during the first key exchange.
+type transport struct {
+	conn net.Conn
+	r    *bufio.Reader
+	stop func()
+
+	serverVersion    string
+	serverAlgorithms *ServerAlgorithms
+}
+
+// dialTransport connects to host, exchanges the versions and reads the SSH_MSG_KEXINIT of the server.
+// The connection is closed when ctx is done.
+func dialTransport(ctx context.Context, host string) (*transport, error) {
+	return dialTransportVersion(ctx, host, ClientVersion)
+}
+
+// dialTransportVersion is dialTransport with a custom client version, e.g. SSH-2.0-OpenSSH_7.4.
+func dialTransportVersion(ctx context.Context, host, version string) (*transport, error) {
+	conn, stop, err := dialContext(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	t := &transport{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		stop: stop,
+	}
+	if err := t.handshake(version); err != nil {
+		t.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// dialContext connects to host, the connection is closed when ctx is done.
+// The returned function closes the connection and must be called once the connection is not needed anymore.
+func dialContext(ctx context.Context, host string) (net.Conn, func(), error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return conn, func() {
+		once.Do(func() {
+			close(done)
+			_ = conn.Close()
+		})
+	}, nil
+}
+
+func (t *transport) handshake(version string) error {
+	if _, err := io.WriteString(t.conn, version+"\r\n"); err != nil {
+		return err
+	}
+	if err := t.readVersion(); err != nil {
+		return err
+	}
+	payload, err := t.readMessage()
+	if err != nil {
+		return err
+	}
+	if payload[0] != msgKexInit {
+		return fmt.Errorf("expected SSH_MSG_KEXINIT, got message %d", payload[0])
+	}
+	t.serverAlgorithms, err = parseKexInit(payload)
+	return err
+}
+
+// readVersion reads the version of the server, lines before the version are skipped.
+func (t *transport) readVersion() error {
+	for i := 0; i < maxVersionLines; i++ {
+		line, err := t.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "SSH-") {
+			t.serverVersion = line
+			return nil
+		}
+	}
+	return errors.New("server did not send a version")
+}
+
+// Close closes the connection.
+func (t *transport) Close() {
+	t.stop()
+}
+
+// readPacket reads the payload of the next unencrypted packet.
+func (t *transport) readPacket() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(t.r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 2 || length > maxPacketLength {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(t.r, packet); err != nil {
+		return nil, err
+	}
+	padding := int(packet[0])
+	if padding >= len(packet)-1 {
+		return nil, errors.New("invalid padding length")
+	}
+	return packet[1 : len(packet)-padding], nil
+}
+
+// readMessage reads the next message, SSH_MSG_IGNORE, SSH_MSG_DEBUG and SSH_MSG_UNIMPLEMENTED are skipped.
+// SSH_MSG_DISCONNECT is returned as error.
+func (t *transport) readMessage() ([]byte, error) {
+	for {
+		payload, err := t.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		switch payload[0] {
+		case msgIgnore, msgDebug, msgUnimplemented:
+			continue
+		case msgDisconnect:
+			return nil, parseDisconnect(payload)
+		default:
+			return payload, nil
+		}
+	}
+}
+
+// writePacket writes payload as unencrypted packet.
+func (t *transport) writePacket(payload []byte) error {
+	padding := packetBlockSize - (5+len(payload))%packetBlockSize
+	if padding < minPaddingLength {
+		padding += packetBlockSize
+	}
+	packet := make([]byte, 5+len(payload)+padding)
+	binary.BigEndian.PutUint32(packet, uint32(1+len(payload)+padding))
+	packet[4] = byte(padding)
+	copy(packet[5:], payload)
+	if _, err := rand.Read(packet[5+len(payload):]); err != nil {
+		return err
+	}
+	_, err := t.conn.Write(packet)
+	return err
+}
+
+// writeKexInit sends a SSH_MSG_KEXINIT that only offers kex and hostKey,
+// the ciphers, macs and compressions of the server are offered so that the negotiation succeeds.
+func (t *transport) writeKexInit(kex, hostKey string) error {
+	a := t.serverAlgorithms
+	return t.writeKexInitLists([][]string{
+		{kex},
+		{hostKey},
+		a.CiphersClientServer,
+		a.CiphersServerClient,
+		a.MACsClientServer,
+		a.MACsServerClient,
+		a.CompressionClientServer,
+		a.CompressionServerClient,
+		nil,
+		nil,
+	})
+}
+
+// writeKexInitLists sends a SSH_MSG_KEXINIT with the name-lists in the order of the message.
+func (t *transport) writeKexInitLists(lists [][]string) error {
+	cookie := make([]byte, kexCookieLength)
+	if _, err := rand.Read(cookie); err != nil {
+		return err
+	}
+	payload := append([]byte{msgKexInit}, cookie...)
+	for _, list := range lists {
+		payload = appendString(payload, []byte(strings.Join(list, ",")))
+	}
+	// first_kex_packet_follows and reserved
+	payload = append(payload, 0, 0, 0, 0, 0)
+	return t.writePacket(payload)
+}
+
+// kexInitRecorder parses the SSH_MSG_KEXINIT of the server from the data that is read from the connection,
+// it allows to learn the server algorithms from a connection that is used by golang.org/x/crypto/ssh.
+type kexInitRecorder struct {
+	net.Conn
+
+	mu         sync.Mutex
+	buf        []byte
+	done       bool
+	version    string
+	algorithms *ServerAlgorithms
+}
+
+func (r *kexInitRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	if n > 0 {
+		r.mu.Lock()
+		if !r.done {
+			r.buf = append(r.buf, p[:n]...)
+			r.parse()
+		}
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// Version returns the recorded version of the server, it is empty if the version was not read (yet).
+func (r *kexInitRecorder) Version() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.version
+}
+
+// ServerAlgorithms returns the recorded algorithms, nil is returned if the SSH_MSG_KEXINIT was not read (yet).
+func (r *kexInitRecorder) ServerAlgorithms() *ServerAlgorithms {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.algorithms
+}
+
+func (r *kexInitRecorder) parse() {
+	rest := r.buf
+	// skip the version and the lines before it
+	for lines := 0; ; lines++ {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 || lines > maxVersionLines {
+			r.done = lines > maxVersionLines || len(r.buf) > maxPacketLength
+			return
+		}
+		line := rest[:i]
+		rest = rest[i+1:]
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			r.version = string(bytes.TrimSuffix(line, []byte("\r")))
+			break
+		}
+	}
+	if len(rest) < 4 {
+		return
+	}
+	length := binary.BigEndian.Uint32(rest)
+	if length < 2 || length > maxPacketLength {
+		r.done = true
+		r.buf = nil
+		return
+	}
+	if uint32(len(rest)-4) < length {
+		return
+	}
+	packet := rest[4 : 4+length]
+	if padding := int(packet[0]); padding < len(packet)-1 && packet[1] == msgKexInit {
+		r.algorithms, _ = parseKexInit(packet[1 : len(packet)-padding])
+	}
+	r.done = true
+	r.buf = nil
+}
+
+func parseKexInit(payload []byte) (*ServerAlgorithms, error) {
+	if len(payload) < 1+kexCookieLength {
+		return nil, errors.New("SSH_MSG_KEXINIT is too short")
+	}
+	rest := payload[1+kexCookieLength:]
+	var a ServerAlgorithms
+	for _, list := range a.nameLists() {
+		var s []byte
+		var ok bool
+		if s, rest, ok = parseString(rest); !ok {
+			return nil, errors.New("SSH_MSG_KEXINIT is malformed")
+		}
+		*list = splitNameList(string(s))
+	}
+	if len(rest) < 1 {
+		return nil, errors.New("SSH_MSG_KEXINIT is malformed")
+	}
+	a.FirstKexPacketFollows = rest[0] != 0
+	return &a, nil
+}
+
+func parseDisconnect(payload []byte) error {
+	if len(payload) < 5 {
+		return errors.New("server disconnected")
+	}
+	reason := binary.BigEndian.Uint32(payload[1:5])
+	description, _, _ := parseString(payload[5:])
+	return fmt.Errorf("server disconnected (%d): %s", reason, description)
+}
+
+func splitNameList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func parseString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(b)
+	if uint64(length) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+length], b[4+length:], true
+}
+
+func appendU32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func appendString(b, s []byte) []byte {
+	return append(appendU32(b, uint32(len(s))), s...)
+}
+
+// appendMPInt appends the positive integer n in the mpint format of RFC 4251.
+func appendMPInt(b []byte, n *big.Int) []byte {
+	buf := n.Bytes()
+	if len(buf) > 0 && buf[0]&0x80 != 0 {
+		buf = append([]byte{0}, buf...)
+	}
+	return appendString(b, buf)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package sshkeys
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Status of an AlgorithmCheck.
+const (
+	// AlgorithmWorking is used if the handshake with the algorithm completed.
+	AlgorithmWorking = "working"
+	// AlgorithmFailed is used if the server advertises the algorithm, but the handshake with it failed.
+	AlgorithmFailed = "failed"
+	// AlgorithmUntested is used if golang.org/x/crypto/ssh does not support the algorithm.
+	AlgorithmUntested = "untested"
+)
+
+// verifiableKexAlgorithms, verifiableCiphers and verifiableMACs are the algorithms golang.org/x/crypto/ssh
+// can complete a handshake with.
+var (
+	verifiableKexAlgorithms = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	verifiableCiphers = []string{
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", ChaCha20Poly1305,
+		"arcfour256", "arcfour128", "arcfour",
+		"aes128-cbc", "3des-cbc",
+	}
+	verifiableMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+)
+
+// AlgorithmCheck is the result of the handshake that was restricted to a single advertised algorithm.
+type AlgorithmCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// VerifiedAlgorithms are the advertised kex, cipher and MAC algorithms and whether a handshake with them completes.
+type VerifiedAlgorithms struct {
+	KexAlgorithms []AlgorithmCheck `json:"kex_algorithms"`
+	Ciphers       []AlgorithmCheck `json:"ciphers"`
+	MACs          []AlgorithmCheck `json:"macs"`
+}
+
+// Failed reports whether an advertised algorithm did not work.
+func (v *VerifiedAlgorithms) Failed() bool {
+	for _, checks := range [][]AlgorithmCheck{v.KexAlgorithms, v.Ciphers, v.MACs} {
+		for _, check := range checks {
+			if check.Status == AlgorithmFailed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPseudoKexAlgorithm reports whether name is an extension marker of the kex list, e.g. ext-info-s.
+func isPseudoKexAlgorithm(name string) bool {
+	return strings.HasPrefix(name, "ext-info-") || strings.HasPrefix(name, "kex-strict-")
+}
+
+func intersectStrings(list, filter []string) []string {
+	var result []string
+	for _, s := range list {
+		if containsString(filter, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func unionStrings(lists ...[]string) []string {
+	var result []string
+	for _, list := range lists {
+		for _, s := range list {
+			if !containsString(result, s) {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// algorithmTask is a handshake restricted to a single algorithm, the result is written to check.
+type algorithmTask struct {
+	check  *AlgorithmCheck
+	config ssh.Config
+}
+
+// VerifyAlgorithms opens one handshake per advertised kex, cipher and MAC algorithm,
+// each restricted to that algorithm, and records which handshakes complete.
+// advertised are the algorithms of the server, they are read with GetServerAlgorithms if nil.
+// The handshakes use the host key algorithms of DefaultKeyAlgorithms.
+// If the server can not be reached for some handshakes, only their checks are failed and the result is returned
+// together with the dial error.
+func VerifyAlgorithms(
+	ctx context.Context,
+	host string,
+	concurrentWorkers int,
+	timeout time.Duration,
+	advertised *ServerAlgorithms,
+) (*VerifiedAlgorithms, error) {
+	if advertised == nil {
+		var err error
+		if advertised, err = GetServerAlgorithms(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	hostKeyAlgorithms := intersectStrings(DefaultKeyAlgorithms(), advertised.HostKeyAlgorithms)
+	if len(hostKeyAlgorithms) == 0 {
+		return nil, errors.New("server supports none of the host key algorithms of the handshake")
+	}
+	if concurrentWorkers < 1 {
+		concurrentWorkers = 1
+	}
+
+	var result VerifiedAlgorithms
+	var tasks []algorithmTask
+	newChecks := func(names []string, config func(name string) (ssh.Config, string)) []AlgorithmCheck {
+		checks := make([]AlgorithmCheck, len(names))
+		for i, name := range names {
+			checks[i].Name = name
+			c, untested := config(name)
+			if untested != "" {
+				checks[i].Status = AlgorithmUntested
+				checks[i].Error = untested
+				continue
+			}
+			tasks = append(tasks, algorithmTask{check: &checks[i], config: c})
+		}
+		return checks
+	}
+
+	var kexAlgorithms []string
+	for _, kex := range advertised.KexAlgorithms {
+		if !isPseudoKexAlgorithm(kex) {
+			kexAlgorithms = append(kexAlgorithms, kex)
+		}
+	}
+	result.KexAlgorithms = newChecks(kexAlgorithms, func(kex string) (ssh.Config, string) {
+		if !containsString(verifiableKexAlgorithms, kex) {
+			return ssh.Config{}, "not supported by the client"
+		}
+		return ssh.Config{KeyExchanges: []string{kex}, Ciphers: verifiableCiphers, MACs: verifiableMACs}, ""
+	})
+	result.Ciphers = newChecks(
+		unionStrings(advertised.CiphersClientServer, advertised.CiphersServerClient),
+		func(cipher string) (ssh.Config, string) {
+			if !containsString(verifiableCiphers, cipher) {
+				return ssh.Config{}, "not supported by the client"
+			}
+			return ssh.Config{KeyExchanges: verifiableKexAlgorithms, Ciphers: []string{cipher}, MACs: verifiableMACs}, ""
+		},
+	)
+	// the MAC is only used with ciphers that do not authenticate the data themselves
+	var macCiphers []string
+	for _, cipher := range intersectStrings(verifiableCiphers, advertised.CiphersClientServer) {
+		if !isAEAD(cipher) && containsString(advertised.CiphersServerClient, cipher) {
+			macCiphers = append(macCiphers, cipher)
+		}
+	}
+	result.MACs = newChecks(
+		unionStrings(advertised.MACsClientServer, advertised.MACsServerClient),
+		func(mac string) (ssh.Config, string) {
+			if !containsString(verifiableMACs, mac) {
+				return ssh.Config{}, "not supported by the client"
+			}
+			if len(macCiphers) == 0 {
+				return ssh.Config{}, "server offers no cipher that uses a MAC"
+			}
+			return ssh.Config{KeyExchanges: verifiableKexAlgorithms, Ciphers: macCiphers, MACs: []string{mac}}, ""
+		},
+	)
+
+	taskChan := make(chan *algorithmTask, len(tasks))
+	for i := range tasks {
+		taskChan <- &tasks[i]
+	}
+	close(taskChan)
+	var mu sync.Mutex
+	var dialErr error
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range taskChan {
+				handshakeCtx, cancel := context.WithTimeout(ctx, timeout)
+				err := restrictedHandshake(handshakeCtx, host, task.config, hostKeyAlgorithms)
+				cancel()
+				var opErr *net.OpError
+				if errors.As(err, &opErr) && opErr.Op == "dial" {
+					mu.Lock()
+					dialErr = err
+					mu.Unlock()
+				}
+				if err != nil {
+					task.check.Status = AlgorithmFailed
+					task.check.Error = err.Error()
+					continue
+				}
+				task.check.Status = AlgorithmWorking
+			}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if dialErr != nil {
+		return &result, dialErr
+	}
+	return &result, nil
+}
+
+// restrictedHandshake completes the handshake with config, the authentication is not required to succeed:
+// the first authentication request is already protected by the negotiated algorithms.
+func restrictedHandshake(ctx context.Context, host string, config ssh.Config, hostKeyAlgorithms []string) error {
+	conn, stop, err := dialContext(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	clientConfig := ssh.ClientConfig{
+		Config:            config,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		// the algorithms are verified, the host is not trusted
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint: gosec // allow insecure host key callback
+	}
+	sshConn, _, _, err := ssh.NewClientConn(conn, host, &clientConfig)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strings.Contains(err.Error(), "ssh: unable to authenticate") {
+			return nil
+		}
+		return err
+	}
+	return sshConn.Close()
+}
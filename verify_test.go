@@ -0,0 +1,127 @@
+package sshkeys_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Eun/sshkeys"
+	"github.com/gliderlabs/ssh"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyAlgorithms(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateECKey},
+	}
+	defer server.Close()
+	go func() {
+		if sshServerErr := server.Serve(l); sshServerErr != nil {
+			if errors.Is(sshServerErr, ssh.ErrServerClosed) {
+				return
+			}
+			log.Fatal(sshServerErr)
+		}
+	}()
+
+	// 3des-cbc is advertised here, but not supported by the server
+	advertised := &sshkeys.ServerAlgorithms{
+		KexAlgorithms:       []string{"sntrup761x25519-sha512@openssh.com", "curve25519-sha256", "ext-info-s"},
+		HostKeyAlgorithms:   []string{"ecdsa-sha2-nistp256"},
+		CiphersClientServer: []string{"aes128-ctr", "3des-cbc"},
+		CiphersServerClient: []string{"aes128-ctr", "3des-cbc"},
+		MACsClientServer:    []string{"hmac-sha2-256", "umac-64@openssh.com"},
+		MACsServerClient:    []string{"hmac-sha2-256", "umac-64@openssh.com"},
+	}
+	verified, err := sshkeys.VerifyAlgorithms(context.Background(), l.Addr().String(), 2, 10*time.Second, advertised)
+	require.NoError(t, err)
+	require.True(t, verified.Failed())
+
+	statuses := func(checks []sshkeys.AlgorithmCheck) map[string]string {
+		m := make(map[string]string)
+		for _, check := range checks {
+			m[check.Name] = check.Status
+		}
+		return m
+	}
+	require.Equal(t, map[string]string{
+		"sntrup761x25519-sha512@openssh.com": sshkeys.AlgorithmUntested,
+		"curve25519-sha256":                  sshkeys.AlgorithmWorking,
+	}, statuses(verified.KexAlgorithms))
+	require.Equal(t, map[string]string{
+		"aes128-ctr": sshkeys.AlgorithmWorking,
+		"3des-cbc":   sshkeys.AlgorithmFailed,
+	}, statuses(verified.Ciphers))
+	require.Equal(t, map[string]string{
+		"hmac-sha2-256":       sshkeys.AlgorithmWorking,
+		"umac-64@openssh.com": sshkeys.AlgorithmUntested,
+	}, statuses(verified.MACs))
+
+	// the advertised algorithms of the server all work
+	result, err := sshkeys.Scan(context.Background(), l.Addr().String(), sshkeys.ScanOptions{
+		ConcurrentWorkers: 2,
+		Timeout:           10 * time.Second,
+		VerifyAlgorithms:  true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, result.VerifiedAlgorithms)
+	require.False(t, result.VerifiedAlgorithms.Failed())
+	require.NotEmpty(t, result.VerifiedAlgorithms.Ciphers)
+}
+
+func TestVerifyAlgorithmsUnreachable(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	privateECKey, err := createECDSAKey(elliptic.P256())
+	require.NoError(t, err)
+	server := ssh.Server{
+		HostSigners: []ssh.Signer{privateECKey},
+	}
+	defer server.Close()
+	// only the first handshake reaches the server, the following ones are refused
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_ = l.Close()
+		server.HandleConn(conn)
+	}()
+
+	advertised := &sshkeys.ServerAlgorithms{
+		KexAlgorithms:       []string{"curve25519-sha256"},
+		HostKeyAlgorithms:   []string{"ecdsa-sha2-nistp256"},
+		CiphersClientServer: []string{"aes128-ctr"},
+		CiphersServerClient: []string{"aes128-ctr"},
+		MACsClientServer:    []string{"umac-64@openssh.com"},
+		MACsServerClient:    []string{"umac-64@openssh.com"},
+	}
+	verified, err := sshkeys.VerifyAlgorithms(context.Background(), l.Addr().String(), 1, 10*time.Second, advertised)
+	var opErr *net.OpError
+	require.ErrorAs(t, err, &opErr)
+	require.Equal(t, "dial", opErr.Op)
+	require.NotNil(t, verified)
+
+	require.Len(t, verified.KexAlgorithms, 1)
+	require.Equal(t, sshkeys.AlgorithmWorking, verified.KexAlgorithms[0].Status)
+	require.Len(t, verified.Ciphers, 1)
+	require.Equal(t, sshkeys.AlgorithmFailed, verified.Ciphers[0].Status)
+	require.Equal(t, err.Error(), verified.Ciphers[0].Error)
+	require.Len(t, verified.MACs, 1)
+	require.Equal(t, sshkeys.AlgorithmUntested, verified.MACs[0].Status)
+}